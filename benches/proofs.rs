@@ -0,0 +1,190 @@
+use chaum_pedersen_zkp::{Group, GroupId, Proof};
+use criterion::{criterion_group, criterion_main, BenchmarkId, Criterion};
+use std::sync::atomic::AtomicBool;
+
+fn groups() -> Vec<(&'static str, Group)> {
+    vec![
+        ("scalar", Group::Scalar),
+        ("secp256k1", Group::EllipticCurve),
+        ("modp2048", Group::named(GroupId::Modp2048)),
+        ("modp3072", Group::named(GroupId::Modp3072)),
+        ("modp4096", Group::named(GroupId::Modp4096)),
+    ]
+}
+
+fn bench_generate_key(c: &mut Criterion) {
+    let mut bench = c.benchmark_group("generate_key");
+    for (name, group) in groups() {
+        bench.bench_with_input(BenchmarkId::from_parameter(name), &group, |b, group| {
+            b.iter(|| group.generate_key().unwrap())
+        });
+    }
+    bench.finish();
+}
+
+fn bench_create_proof(c: &mut Criterion) {
+    let mut bench = c.benchmark_group("create_proof");
+    for (name, group) in groups() {
+        let (x, _, _) = group.generate_key().unwrap();
+        bench.bench_with_input(BenchmarkId::from_parameter(name), &group, |b, group| {
+            b.iter(|| group.create_proof(&x).unwrap())
+        });
+    }
+    bench.finish();
+}
+
+fn bench_verify_proof(c: &mut Criterion) {
+    let mut bench = c.benchmark_group("verify_proof");
+    for (name, group) in groups() {
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        bench.bench_with_input(BenchmarkId::from_parameter(name), &group, |b, group| {
+            b.iter(|| group.verify_proof(&y1, &y2, &proof).unwrap())
+        });
+    }
+    bench.finish();
+}
+
+fn bench_verifier(c: &mut Criterion) {
+    let mut bench = c.benchmark_group("verifier_verify");
+    for (name, group) in groups() {
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        let verifier = group.new_verifier();
+        bench.bench_with_input(
+            BenchmarkId::from_parameter(name),
+            &verifier,
+            |b, verifier| b.iter(|| verifier.verify(&y1, &y2, &proof).unwrap()),
+        );
+    }
+    bench.finish();
+}
+
+fn bench_verify_with_precomputed(c: &mut Criterion) {
+    let mut bench = c.benchmark_group("verifier_verify_with_precomputed");
+    for (name, group) in groups() {
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        let verifier = group.new_verifier();
+        let key = verifier.precompute_public_key(&y1, &y2).unwrap();
+        bench.bench_with_input(
+            BenchmarkId::from_parameter(name),
+            &verifier,
+            |b, verifier| b.iter(|| verifier.verify_with_precomputed(&key, &proof).unwrap()),
+        );
+    }
+    bench.finish();
+}
+
+fn bench_single_key_verifier(c: &mut Criterion) {
+    let mut bench = c.benchmark_group("single_key_verifier_verify");
+    for (name, group) in groups() {
+        let key = group.generate_key_pair().unwrap();
+        let proof = key.create_proof().unwrap();
+        let verifier = group.new_single_key_verifier(&key.to_public_key()).unwrap();
+        bench.bench_with_input(
+            BenchmarkId::from_parameter(name),
+            &verifier,
+            |b, verifier| b.iter(|| verifier.verify(&proof).unwrap()),
+        );
+    }
+    bench.finish();
+}
+
+fn bench_challenge_bits(c: &mut Criterion) {
+    let mut bench = c.benchmark_group("verify_proof_with_challenge_bits");
+    for (name, group) in [
+        ("secp256k1", Group::EllipticCurve),
+        ("modp2048", Group::named(GroupId::Modp2048)),
+    ] {
+        let (x, y1, y2) = group.generate_key().unwrap();
+        // bit length of the order q, the default length of the challenges
+        let q = group.params().1;
+        let full = 8 * q.len() - q[0].leading_zeros() as usize;
+        for bits in [128, full] {
+            let proof = group.create_proof_with_challenge_bits(&x, bits).unwrap();
+            bench.bench_with_input(BenchmarkId::new(name, bits), &group, |b, group| {
+                b.iter(|| {
+                    group
+                        .verify_proof_with_challenge_bits(&y1, &y2, &proof, bits)
+                        .unwrap()
+                })
+            });
+        }
+    }
+    bench.finish();
+}
+
+fn bench_serialize_deserialize(c: &mut Criterion) {
+    let mut bench = c.benchmark_group("serialize_deserialize");
+    for (name, group) in groups() {
+        let (x, _, _) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        bench.bench_with_input(BenchmarkId::from_parameter(name), &group, |b, group| {
+            b.iter(|| Proof::deserialize(proof.serialize(group), group).unwrap())
+        });
+    }
+    bench.finish();
+}
+
+fn bench_point_serialize(c: &mut Criterion) {
+    let mut bench = c.benchmark_group("point_serialize");
+    for (name, group) in groups() {
+        let (_, y1, _) = group.generate_key().unwrap();
+        bench.bench_with_input(BenchmarkId::new("serialize", name), &y1, |b, y1| {
+            b.iter(|| y1.serialize())
+        });
+        let mut buffer = Vec::new();
+        bench.bench_with_input(BenchmarkId::new("serialize_into", name), &y1, |b, y1| {
+            b.iter(|| y1.serialize_into(&mut buffer))
+        });
+        // what every log line of a proof pays
+        bench.bench_with_input(BenchmarkId::new("display", name), &y1, |b, y1| {
+            b.iter(|| y1.to_string())
+        });
+    }
+    bench.finish();
+}
+
+fn bench_verify_proof_batch_parallel(c: &mut Criterion) {
+    let group = Group::EllipticCurve;
+    let mut public_keys = Vec::new();
+    let mut proofs = Vec::new();
+    for _ in 0..64 {
+        let (x, y1, y2) = group.generate_key().unwrap();
+        proofs.push(group.create_proof(&x).unwrap());
+        public_keys.push((y1, y2));
+    }
+
+    let cancel = AtomicBool::new(false);
+    let mut bench = c.benchmark_group("verify_proof_batch_parallel");
+    for workers in [1, 2, 4, 8] {
+        bench.bench_with_input(
+            BenchmarkId::from_parameter(workers),
+            &workers,
+            |b, &workers| {
+                b.iter(|| {
+                    group
+                        .verify_proof_batch_parallel(&public_keys, &proofs, workers, &cancel)
+                        .unwrap()
+                })
+            },
+        );
+    }
+    bench.finish();
+}
+
+criterion_group!(
+    benches,
+    bench_generate_key,
+    bench_create_proof,
+    bench_verify_proof,
+    bench_verifier,
+    bench_verify_with_precomputed,
+    bench_single_key_verifier,
+    bench_challenge_bits,
+    bench_serialize_deserialize,
+    bench_point_serialize,
+    bench_verify_proof_batch_parallel
+);
+criterion_main!(benches);
@@ -3,13 +3,15 @@
 /// https://betterprogramming.pub/building-a-grpc-server-with-rust-be2c52f0860e
 
 fn main() {
-    let proto_file = "./proto/zkp_auth.proto";
+    let proto_files = ["./proto/zkp_auth.proto", "./proto/cpzkp.proto"];
 
     tonic_build::configure()
         .build_server(true)
         .out_dir("./src")
-        .compile(&[proto_file], &["."])
+        .compile(&proto_files, &["."])
         .unwrap_or_else(|e| panic!("protobuf compile error: {}", e));
 
-    println!("cargo:rerun-if-changed={}", proto_file);
+    for proto_file in proto_files {
+        println!("cargo:rerun-if-changed={}", proto_file);
+    }
 }
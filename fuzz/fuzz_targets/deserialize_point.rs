@@ -0,0 +1,19 @@
+#![no_main]
+
+use chaum_pedersen_zkp::{Group, GroupId, Point};
+use libfuzzer_sys::fuzz_target;
+
+// Points come from untrusted peers: any input must either be rejected or give
+// an element of the group, never panic.
+fuzz_target!(|data: &[u8]| {
+    for group in [
+        Group::Scalar,
+        Group::EllipticCurve,
+        Group::named(GroupId::Modp2048),
+    ] {
+        if let Ok(point) = Point::deserialize(data.to_vec(), &group) {
+            assert!(group.contains(&point));
+        }
+        let _ = Point::deserialize_unchecked(data.to_vec(), &group);
+    }
+});
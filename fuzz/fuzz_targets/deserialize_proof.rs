@@ -0,0 +1,17 @@
+#![no_main]
+
+use chaum_pedersen_zkp::{Group, Proof};
+use libfuzzer_sys::fuzz_target;
+
+// Proofs come from untrusted peers: any input must either be rejected or give
+// a proof that can be checked, never panic.
+fuzz_target!(|data: &[u8]| {
+    for group in [Group::Scalar, Group::EllipticCurve] {
+        if let Ok(proof) = Proof::deserialize(data.to_vec(), &group) {
+            let _ = group.verify_proof(&proof.r1, &proof.r2, &proof);
+            let _ = group.verify_proof_detailed(&proof.r1, &proof.r2, &proof);
+        }
+        let _ = Proof::deserialize_with_header(data.to_vec(), &group);
+        let _ = Proof::deserialize_raw(data.to_vec(), &group);
+    }
+});
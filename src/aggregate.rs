@@ -0,0 +1,513 @@
+//! Aggregation of several non-interactive proofs into a single one, e.g. to
+//! prove the knowledge of many secrets in one login. The commitments of the
+//! proofs are kept while their solutions are combined into a single random
+//! linear combination (half aggregation):
+//!
+//! s = sum(a_i * s_i) mod q
+//!
+//! where the weight `a_i` is derived from the hash of the commitments and
+//! challenges of the proofs up to `i`, so that the prover can't choose them.
+//! As a weight only depends on the proofs before it, an `AggregateVerifier`
+//! derives them in a single pass over the commitments and public values
+//! streamed to it, holding a bounded number of them.
+use num::traits::One;
+use num_bigint::BigUint;
+use sha2::{Digest, Sha256};
+
+use crate::secp256k1::Secp256k1Point;
+use crate::{
+    check_serialized_size, fiat_shamir_challenge, get_constants,
+    multi_exponentiation_elliptic_curve, multi_exponentiation_equal, multi_exponentiation_scalar,
+    read_length_prefixed, write_length_prefixed, ChallengeHash, Commitment, Error, Group, Point,
+    Proof,
+};
+
+/// Number of public values combined in each multi-exponentiation of an
+/// `AggregateVerifier`, which bounds the memory it uses.
+const AGGREGATE_VERIFIER_CHUNK: usize = 64;
+
+/// Structure holding the commitments of the aggregated proofs, in order, and
+/// their combined solution. The challenges are not stored as the verifier
+/// recomputes them from the public values.
+#[derive(Debug, Clone, PartialEq)]
+pub struct AggregateProof {
+    pub commitments: Vec<Commitment>,
+    pub s: BigUint,
+}
+
+impl AggregateProof {
+    /// Serializes the AggregateProof structure to an array of bytes: `s`
+    /// followed by the serialized commitments, each one preceded by its 4-byte
+    /// big-endian length.
+    pub fn serialize(self: &Self) -> Vec<u8> {
+        let mut v = Vec::new();
+        write_length_prefixed(&mut v, &self.s.to_bytes_be());
+        for commitment in &self.commitments {
+            write_length_prefixed(&mut v, &commitment.serialize());
+        }
+        v
+    }
+
+    /// Deserializes the AggregateProof structure from an array of bytes.
+    /// Empty, truncated inputs or inputs without commitments return an error.
+    pub fn deserialize(v: Vec<u8>, group: &Group) -> Result<AggregateProof, Error> {
+        check_serialized_size(v.len())?;
+        let mut data = &v[..];
+
+        let s = BigUint::from_bytes_be(read_length_prefixed(&mut data)?);
+
+        let mut commitments = Vec::new();
+        while !data.is_empty() {
+            let bytes = read_length_prefixed(&mut data)?;
+            commitments.push(Commitment::deserialize(bytes.to_vec(), group)?);
+        }
+
+        if commitments.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+
+        Ok(AggregateProof { commitments, s })
+    }
+}
+
+/// Derives the weights `a_i` in the range `[1, q)` of the proofs from their
+/// commitments and challenges.
+fn aggregation_weights(commitments: &[Commitment], c: &[BigUint], q: &BigUint) -> Vec<BigUint> {
+    let mut transcript = aggregation_transcript();
+    commitments
+        .iter()
+        .zip(c)
+        .enumerate()
+        .map(|(i, (commitment, c))| {
+            update_aggregation_transcript(&mut transcript, commitment, c);
+            aggregation_weight(&transcript, i, q)
+        })
+        .collect()
+}
+
+fn aggregation_transcript() -> Sha256 {
+    Sha256::new().chain_update(b"chaum-pedersen-zkp aggregate")
+}
+
+fn update_aggregation_transcript(transcript: &mut Sha256, commitment: &Commitment, c: &BigUint) {
+    let mut v = commitment.serialize();
+    write_length_prefixed(&mut v, &c.to_bytes_be());
+    transcript.update((v.len() as u32).to_be_bytes());
+    transcript.update(v);
+}
+
+/// Derives the weight of the proof `i` from the transcript of the commitments
+/// and challenges of the proofs up to `i`.
+fn aggregation_weight(transcript: &Sha256, i: usize, q: &BigUint) -> BigUint {
+    let digest = transcript
+        .clone()
+        .chain_update((i as u32).to_be_bytes())
+        .finalize();
+    BigUint::from_bytes_be(&digest) % (q - 1u32) + BigUint::one()
+}
+
+/// Computes the challenge of the aggregated proof of `(y1, y2)`.
+fn aggregation_challenge(
+    constants: &(BigUint, BigUint, Point, Point),
+    y1: &Point,
+    y2: &Point,
+    commitment: &Commitment,
+) -> BigUint {
+    let (_, q, g, h) = constants;
+    let points = [g, h, y1, y2, &commitment.r1, &commitment.r2];
+    fiat_shamir_challenge(&points, q, ChallengeHash::default(), &[])
+}
+
+impl Group {
+    /// Combines proofs created with `create_proof` into a single
+    /// AggregateProof, smaller than the proofs it replaces. The proofs are not
+    /// checked, an invalid one makes the aggregate invalid.
+    pub fn aggregate_proofs(self: &Self, proofs: &[Proof]) -> Result<AggregateProof, Error> {
+        if proofs.is_empty() {
+            return Err(Error::InvalidArguments);
+        }
+
+        let (_, q, _, _) = get_constants(self);
+
+        let commitments: Vec<Commitment> = proofs
+            .iter()
+            .map(|proof| Commitment {
+                r1: proof.r1.clone(),
+                r2: proof.r2.clone(),
+            })
+            .collect();
+        let c: Vec<BigUint> = proofs.iter().map(|proof| proof.c.clone()).collect();
+
+        let a = aggregation_weights(&commitments, &c, &q);
+        let s: BigUint = a.iter().zip(proofs).map(|(a, proof)| a * &proof.s).sum();
+
+        Ok(AggregateProof {
+            commitments,
+            s: s % q,
+        })
+    }
+
+    /// Verifies an AggregateProof against the public values `(y1, y2)` of the
+    /// aggregated proofs, given in the same order. It fails if any of the
+    /// public values is not the one the proof was created for. Public values
+    /// or commitments that are not elements of the group return
+    /// `Error::InvalidPoint`, like `AggregateVerifier::add_key`.
+    pub fn verify_aggregate(
+        self: &Self,
+        public_keys: &[(Point, Point)],
+        aggregate: &AggregateProof,
+    ) -> Result<bool, Error> {
+        if public_keys.len() != aggregate.commitments.len() {
+            return Err(Error::LengthMismatch);
+        }
+        if public_keys.is_empty() {
+            return Err(Error::InvalidArguments);
+        }
+        // an element out of the subgroup, e.g. of order 2, could vanish in the
+        // combination for some weights
+        for ((y1, y2), commitment) in public_keys.iter().zip(&aggregate.commitments) {
+            if ![y1, y2, &commitment.r1, &commitment.r2]
+                .iter()
+                .all(|point| self.contains(point))
+            {
+                return Err(Error::InvalidPoint);
+            }
+        }
+
+        let constants = get_constants(self);
+        let (p, q, g, h) = &constants;
+
+        let c: Vec<BigUint> = public_keys
+            .iter()
+            .zip(&aggregate.commitments)
+            .map(|((y1, y2), commitment)| aggregation_challenge(&constants, y1, y2, commitment))
+            .collect();
+
+        let a = aggregation_weights(&aggregate.commitments, &c, q);
+        let ac: Vec<BigUint> = a.iter().zip(&c).map(|(a, c)| (a * c) % q).collect();
+
+        // prod(r1_i^a_i) = g^s * prod(y1_i^(a_i * c_i)), and the same for h
+        let mut lhs1: Vec<(&Point, &BigUint)> = Vec::new();
+        let mut lhs2: Vec<(&Point, &BigUint)> = Vec::new();
+        let mut rhs1: Vec<(&Point, &BigUint)> = vec![(g, &aggregate.s)];
+        let mut rhs2: Vec<(&Point, &BigUint)> = vec![(h, &aggregate.s)];
+        for (i, ((y1, y2), commitment)) in
+            public_keys.iter().zip(&aggregate.commitments).enumerate()
+        {
+            lhs1.push((&commitment.r1, &a[i]));
+            lhs2.push((&commitment.r2, &a[i]));
+            rhs1.push((y1, &ac[i]));
+            rhs2.push((y2, &ac[i]));
+        }
+
+        Ok(multi_exponentiation_equal(&lhs1, &rhs1, p)?
+            && multi_exponentiation_equal(&lhs2, &rhs2, p)?)
+    }
+
+    /// Returns an AggregateVerifier of an AggregateProof whose combined
+    /// solution is `s`, to which its commitments are streamed with the
+    /// public values instead of being held in memory.
+    pub fn new_aggregate_verifier(self: &Self, s: &BigUint) -> AggregateVerifier {
+        let constants = get_constants(self);
+        let (p, _, g, h) = &constants;
+        // g^s and h^s are the first terms of the right-hand sides
+        let mut rhs = [Accumulator::new(g), Accumulator::new(h)];
+        rhs[0].multiply(&[(g, s)], p);
+        rhs[1].multiply(&[(h, s)], p);
+
+        AggregateVerifier {
+            group: self.clone(),
+            lhs: [Accumulator::new(g), Accumulator::new(h)],
+            rhs,
+            constants,
+            transcript: aggregation_transcript(),
+            added: 0,
+            pending: Vec::new(),
+        }
+    }
+}
+
+/// Verifier of an AggregateProof reading its commitments and the public
+/// values one at a time, created with `Group::new_aggregate_verifier`. It
+/// holds the values of a single chunk, whatever their number, so the proof
+/// can be read as it is received: `AggregateProof::serialize` writes `s`
+/// before the commitments.
+pub struct AggregateVerifier {
+    group: Group,
+    // accumulated sides of the equations checked by verify_aggregate,
+    // for g and h
+    lhs: [Accumulator; 2],
+    rhs: [Accumulator; 2],
+    constants: (BigUint, BigUint, Point, Point),
+    // transcript of the commitments and challenges added so far, from which
+    // the weights are derived
+    transcript: Sha256,
+    added: usize,
+    // commitments and public values not accumulated yet, with their weight
+    // and the product of their weight and challenge
+    pending: Vec<(Commitment, Point, Point, BigUint, BigUint)>,
+}
+
+impl AggregateVerifier {
+    /// Adds the public values `(y1, y2)` of the next aggregated proof and its
+    /// commitment, in the order of the proofs. Values or commitments of
+    /// another group return `Error::InvalidPoint`.
+    pub fn add_key(
+        self: &mut Self,
+        y1: &Point,
+        y2: &Point,
+        commitment: &Commitment,
+    ) -> Result<(), Error> {
+        let group = &self.group;
+        if ![y1, y2, &commitment.r1, &commitment.r2]
+            .iter()
+            .all(|point| group.contains(point))
+        {
+            return Err(Error::InvalidPoint);
+        }
+
+        let q = &self.constants.1;
+        let c = aggregation_challenge(&self.constants, y1, y2, commitment);
+        update_aggregation_transcript(&mut self.transcript, commitment, &c);
+        let a = aggregation_weight(&self.transcript, self.added, q);
+        let ac = (&a * c) % q;
+        self.added += 1;
+
+        self.pending
+            .push((commitment.clone(), y1.clone(), y2.clone(), a, ac));
+        if self.pending.len() == AGGREGATE_VERIFIER_CHUNK {
+            self.accumulate();
+        }
+        Ok(())
+    }
+
+    /// Tells if the aggregate proof is valid for the public values added. It
+    /// fails with `Error::InvalidArguments` if none was.
+    pub fn finish(mut self: Self) -> Result<bool, Error> {
+        if self.added == 0 {
+            return Err(Error::InvalidArguments);
+        }
+        self.accumulate();
+        Ok(self.lhs == self.rhs)
+    }
+
+    /// Multiplies the sides of the equations by the terms of the pending
+    /// values: prod(r1_i^a_i) and prod(y1_i^(a_i * c_i)) for g, and the same
+    /// for h.
+    fn accumulate(self: &mut Self) {
+        let p = &self.constants.0;
+        let mut lhs1: Vec<(&Point, &BigUint)> = Vec::new();
+        let mut lhs2: Vec<(&Point, &BigUint)> = Vec::new();
+        let mut rhs1: Vec<(&Point, &BigUint)> = Vec::new();
+        let mut rhs2: Vec<(&Point, &BigUint)> = Vec::new();
+        for (commitment, y1, y2, a, ac) in &self.pending {
+            lhs1.push((&commitment.r1, a));
+            lhs2.push((&commitment.r2, a));
+            rhs1.push((y1, ac));
+            rhs2.push((y2, ac));
+        }
+
+        self.lhs[0].multiply(&lhs1, p);
+        self.lhs[1].multiply(&lhs2, p);
+        self.rhs[0].multiply(&rhs1, p);
+        self.rhs[1].multiply(&rhs2, p);
+        self.pending.clear();
+    }
+}
+
+/// Product of multi-exponentiations, kept in the representation of the
+/// group so that the identity can be held as well.
+#[derive(PartialEq)]
+enum Accumulator {
+    Scalar(BigUint),
+    EllipticCurve(Secp256k1Point),
+}
+
+impl Accumulator {
+    /// Returns the identity of the group of `point`.
+    fn new(point: &Point) -> Accumulator {
+        match point {
+            Point::Scalar(_) => Accumulator::Scalar(BigUint::one()),
+            Point::ECPoint(..) => Accumulator::EllipticCurve(Secp256k1Point::Zero),
+        }
+    }
+
+    /// Multiplies the accumulator by prod(base_i^exp_i), all the bases being
+    /// elements of its group.
+    fn multiply(self: &mut Self, terms: &[(&Point, &BigUint)], p: &BigUint) {
+        match self {
+            Accumulator::Scalar(n) => *n = (&*n * multi_exponentiation_scalar(terms, p)) % p,
+            Accumulator::EllipticCurve(point) => {
+                *point = point.clone() + multi_exponentiation_elliptic_curve(terms)
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_aggregate_proofs() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let keys = group.generate_keys(4).unwrap();
+            let proofs: Vec<Proof> = keys
+                .iter()
+                .map(|(x, _, _)| group.create_proof(x).unwrap())
+                .collect();
+            let public_keys: Vec<(Point, Point)> = keys
+                .iter()
+                .map(|(_, y1, y2)| (y1.clone(), y2.clone()))
+                .collect();
+
+            let aggregate = group.aggregate_proofs(&proofs).unwrap();
+            assert!(group.verify_aggregate(&public_keys, &aggregate).unwrap());
+
+            assert_eq!(
+                group.verify_aggregate(&public_keys[1..], &aggregate),
+                Err(Error::LengthMismatch)
+            );
+
+            let size: usize = proofs
+                .iter()
+                .map(|proof| proof.serialize(&group).len())
+                .sum();
+            let bytes = aggregate.serialize();
+            assert!(bytes.len() < size);
+            assert_eq!(AggregateProof::deserialize(bytes, &group), Ok(aggregate));
+        }
+
+        assert_eq!(
+            Group::Scalar.aggregate_proofs(&[]),
+            Err(Error::InvalidArguments)
+        );
+        assert!(AggregateProof::deserialize(vec![0, 0, 0, 0], &Group::Scalar).is_err());
+    }
+
+    #[test]
+    fn test_aggregate_proofs_wrong_key() {
+        let group = Group::EllipticCurve;
+        let keys = group.generate_keys(3).unwrap();
+        let proofs: Vec<Proof> = keys
+            .iter()
+            .map(|(x, _, _)| group.create_proof(x).unwrap())
+            .collect();
+        let mut public_keys: Vec<(Point, Point)> = keys
+            .iter()
+            .map(|(_, y1, y2)| (y1.clone(), y2.clone()))
+            .collect();
+
+        let aggregate = group.aggregate_proofs(&proofs).unwrap();
+        public_keys.swap(0, 1);
+        assert!(!group.verify_aggregate(&public_keys, &aggregate).unwrap());
+
+        let (_, y1, y2) = group.generate_key().unwrap();
+        public_keys.swap(0, 1);
+        public_keys[2] = (y1, y2);
+        assert!(!group.verify_aggregate(&public_keys, &aggregate).unwrap());
+    }
+
+    #[test]
+    fn test_aggregate_proofs_non_member() {
+        let group = Group::Scalar;
+        let (p, _, _, _) = get_constants(&group);
+        // times the element of order 2, out of the subgroup of order q
+        let negate = |point: &Point| match point {
+            Point::Scalar(n) => Point::Scalar(n * (&p - 1u32) % &p),
+            _ => unreachable!(),
+        };
+
+        let keys = group.generate_keys(2).unwrap();
+        let proofs: Vec<Proof> = keys
+            .iter()
+            .map(|(x, _, _)| group.create_proof(x).unwrap())
+            .collect();
+        let mut public_keys: Vec<(Point, Point)> = keys
+            .iter()
+            .map(|(_, y1, y2)| (y1.clone(), y2.clone()))
+            .collect();
+        let mut aggregate = group.aggregate_proofs(&proofs).unwrap();
+
+        aggregate.commitments[1].r1 = negate(&aggregate.commitments[1].r1);
+        assert_eq!(
+            group.verify_aggregate(&public_keys, &aggregate),
+            Err(Error::InvalidPoint)
+        );
+
+        let aggregate = group.aggregate_proofs(&proofs).unwrap();
+        public_keys[0].1 = negate(&public_keys[0].1);
+        assert_eq!(
+            group.verify_aggregate(&public_keys, &aggregate),
+            Err(Error::InvalidPoint)
+        );
+    }
+
+    fn stream_keys(
+        verifier: &mut AggregateVerifier,
+        keys: &[(Point, Point)],
+        aggregate: &AggregateProof,
+    ) {
+        for ((y1, y2), commitment) in keys.iter().zip(&aggregate.commitments) {
+            verifier.add_key(y1, y2, commitment).unwrap();
+        }
+    }
+
+    #[test]
+    fn test_aggregate_verifier() {
+        // more keys than a chunk for the integer group
+        for (group, n) in [
+            (Group::Scalar, AGGREGATE_VERIFIER_CHUNK + 3),
+            (Group::EllipticCurve, 3),
+        ] {
+            let keys = group.generate_keys(n).unwrap();
+            let proofs: Vec<Proof> = keys
+                .iter()
+                .map(|(x, _, _)| group.create_proof(x).unwrap())
+                .collect();
+            let public_keys: Vec<(Point, Point)> = keys
+                .iter()
+                .map(|(_, y1, y2)| (y1.clone(), y2.clone()))
+                .collect();
+            let aggregate = group.aggregate_proofs(&proofs).unwrap();
+
+            let mut verifier = group.new_aggregate_verifier(&aggregate.s);
+            stream_keys(&mut verifier, &public_keys, &aggregate);
+            assert_eq!(verifier.finish(), Ok(true));
+
+            let mut verifier = group.new_aggregate_verifier(&aggregate.s);
+            stream_keys(&mut verifier, &public_keys[..n - 1], &aggregate);
+            assert_eq!(verifier.finish(), Ok(false));
+
+            let verifier = group.new_aggregate_verifier(&aggregate.s);
+            assert_eq!(verifier.finish(), Err(Error::InvalidArguments));
+        }
+    }
+
+    #[test]
+    fn test_aggregate_verifier_wrong_key() {
+        let group = Group::EllipticCurve;
+        let keys = group.generate_keys(3).unwrap();
+        let proofs: Vec<Proof> = keys
+            .iter()
+            .map(|(x, _, _)| group.create_proof(x).unwrap())
+            .collect();
+        let mut public_keys: Vec<(Point, Point)> = keys
+            .iter()
+            .map(|(_, y1, y2)| (y1.clone(), y2.clone()))
+            .collect();
+        let aggregate = group.aggregate_proofs(&proofs).unwrap();
+
+        public_keys.swap(0, 1);
+        let mut verifier = group.new_aggregate_verifier(&aggregate.s);
+        stream_keys(&mut verifier, &public_keys, &aggregate);
+        assert_eq!(verifier.finish(), Ok(false));
+
+        let (_, y1, y2) = Group::Scalar.generate_key().unwrap();
+        let mut verifier = group.new_aggregate_verifier(&aggregate.s);
+        assert_eq!(
+            verifier.add_key(&y1, &y2, &aggregate.commitments[0]),
+            Err(Error::InvalidPoint)
+        );
+    }
+}
@@ -0,0 +1,220 @@
+//! The group operations themselves, for protocols built on top of the same
+//! groups. They are written additively: for integer groups `point_add` is the
+//! product modulo `p` and `scalar_mult` the exponentiation.
+//!
+//! The identity element is `1` for integer groups and the point at infinity
+//! for secp256k1. The latter is represented by the coordinates `(0, 0)`, which
+//! are not on the curve, so only these operations accept it: `contains` and
+//! the deserialization reject it.
+use num::traits::{One, Zero};
+use num_bigint::BigUint;
+
+use crate::secp256k1::Secp256k1Point;
+use crate::{get_constants, Error, Group, GroupKind, Point, Scalar};
+
+/// Converts the result of an elliptic curve operation into a Point.
+fn from_secp256k1_result(point: Secp256k1Point) -> Point {
+    match point {
+        Secp256k1Point::Zero => Point::ECPoint(BigUint::zero(), BigUint::zero()),
+        point => Point::from_secp256k1(&point),
+    }
+}
+
+/// Converts an element of secp256k1, the identity included, into a point of
+/// the `secp256k1` library.
+fn to_secp256k1(x: &BigUint, y: &BigUint) -> Secp256k1Point {
+    if x.is_zero() && y.is_zero() {
+        return Secp256k1Point::Zero;
+    }
+    Secp256k1Point::from_bigint(x, y)
+}
+
+impl Point {
+    /// Returns `true` for the identity element of the groups, see
+    /// `Group::identity`.
+    pub fn is_identity(self: &Self) -> bool {
+        match self {
+            Point::Scalar(n) => n.is_one(),
+            Point::ECPoint(x, y) => x.is_zero() && y.is_zero(),
+        }
+    }
+}
+
+impl Group {
+    /// Returns the identity element of the group, the result of multiplying
+    /// any point by zero or by the order `q`.
+    pub fn identity(self: &Self) -> Point {
+        match self.kind() {
+            GroupKind::Scalar | GroupKind::Custom(_) => Point::Scalar(BigUint::one()),
+            GroupKind::EllipticCurve => Point::ECPoint(BigUint::zero(), BigUint::zero()),
+        }
+    }
+
+    /// Checks that the point is the identity or an element of the group, see
+    /// `contains`.
+    fn check_element(self: &Self, point: &Point) -> Result<(), Error> {
+        if *point != self.identity() && !self.contains(point) {
+            return Err(Error::InvalidPoint);
+        }
+        Ok(())
+    }
+
+    /// Computes `s * point`, i.e. `point^s mod p` for integer groups.
+    pub fn scalar_mult(self: &Self, point: &Point, s: &Scalar) -> Result<Point, Error> {
+        self.check_element(point)?;
+
+        match point {
+            Point::Scalar(base) => {
+                let (p, _, _, _) = get_constants(self);
+                Ok(Point::Scalar(base.modpow(s.value(), &p)))
+            }
+            Point::ECPoint(x, y) => {
+                let point = to_secp256k1(x, y).scale(s.value().clone());
+                Ok(from_secp256k1_result(point))
+            }
+        }
+    }
+
+    /// Computes `s * g` for the generator `g` of the group.
+    pub fn scalar_mult_generator(self: &Self, s: &Scalar) -> Result<Point, Error> {
+        let (_, _, g, _) = get_constants(self);
+        self.scalar_mult(&g, s)
+    }
+
+    /// Computes `a + b`, i.e. `a * b mod p` for integer groups.
+    pub fn point_add(self: &Self, a: &Point, b: &Point) -> Result<Point, Error> {
+        self.check_element(a)?;
+        self.check_element(b)?;
+
+        match (a, b) {
+            (Point::Scalar(a), Point::Scalar(b)) => {
+                let (p, _, _, _) = get_constants(self);
+                Ok(Point::Scalar((a * b) % p))
+            }
+            (Point::ECPoint(ax, ay), Point::ECPoint(bx, by)) => {
+                let point = to_secp256k1(ax, ay) + to_secp256k1(bx, by);
+                Ok(from_secp256k1_result(point))
+            }
+            _ => Err(Error::InvalidArguments),
+        }
+    }
+
+    /// Computes `-point`, i.e. the inverse `point^(p - 2) mod p` for integer
+    /// groups and `(x, p - y)` for secp256k1.
+    pub fn point_neg(self: &Self, point: &Point) -> Result<Point, Error> {
+        self.check_element(point)?;
+        if point.is_identity() {
+            return Ok(point.clone());
+        }
+
+        let (p, _, _, _) = get_constants(self);
+        match point {
+            Point::Scalar(n) => Ok(Point::Scalar(n.modpow(&(&p - 2u32), &p))),
+            Point::ECPoint(x, y) => Ok(Point::ECPoint(x.clone(), &p - y)),
+        }
+    }
+
+    /// Computes `a - b`, i.e. `a * b^-1 mod p` for integer groups.
+    pub fn point_sub(self: &Self, a: &Point, b: &Point) -> Result<Point, Error> {
+        self.point_add(a, &self.point_neg(b)?)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_arithmetic() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (_, _, g, _) = get_constants(&group);
+            let two = Scalar::new(&BigUint::from(2u32), &group);
+            let three = Scalar::new(&BigUint::from(3u32), &group);
+            let five = Scalar::new(&BigUint::from(5u32), &group);
+
+            let g2 = group.scalar_mult_generator(&two).unwrap();
+            let g3 = group.scalar_mult(&g, &three).unwrap();
+            assert_eq!(
+                group.point_add(&g2, &g3).unwrap(),
+                group.scalar_mult_generator(&five).unwrap()
+            );
+            assert_eq!(group.point_add(&g, &g).unwrap(), g2);
+
+            // the public values are multiples of the generators
+            let (x, y1, _) = group.generate_key_from_seed(b"0123456789abcdef").unwrap();
+            let x = Scalar::new(&x, &group);
+            assert_eq!(group.scalar_mult_generator(&x).unwrap(), y1);
+        }
+
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (_, q, g, _) = get_constants(&group);
+            let identity = group.identity();
+            assert!(identity.is_identity());
+            assert!(!g.is_identity());
+
+            let zero = Scalar::new(&BigUint::zero(), &group);
+            assert!(group.scalar_mult(&g, &zero).unwrap().is_identity());
+            let order = Scalar::from_value(q.clone());
+            assert!(group.scalar_mult(&g, &order).unwrap().is_identity());
+
+            // q - 1 times g is the opposite of g
+            let minus_one = Scalar::from_value(&q - 1u32);
+            let opposite = group.scalar_mult(&g, &minus_one).unwrap();
+            assert!(group.point_add(&g, &opposite).unwrap().is_identity());
+
+            assert_eq!(group.point_add(&identity, &g).unwrap(), g);
+            assert!(group
+                .scalar_mult(&identity, &minus_one)
+                .unwrap()
+                .is_identity());
+
+            // a zero secret is rejected
+            assert_eq!(
+                group.public_key(&BigUint::zero()),
+                Err(Error::InvalidSecret)
+            );
+        }
+
+        assert!(!Group::EllipticCurve.contains(&Group::EllipticCurve.identity()));
+
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (_, q, g, h) = get_constants(&group);
+            let identity = group.identity();
+
+            let minus_g = group.point_neg(&g).unwrap();
+            assert!(group.contains(&minus_g));
+            assert!(group.point_add(&g, &minus_g).unwrap().is_identity());
+            assert_eq!(group.point_neg(&minus_g).unwrap(), g);
+            let minus_one = Scalar::from_value(&q - 1u32);
+            assert_eq!(group.scalar_mult(&g, &minus_one).unwrap(), minus_g);
+            assert_eq!(group.point_neg(&identity).unwrap(), identity);
+
+            assert!(group.point_sub(&h, &h).unwrap().is_identity());
+            assert_eq!(group.point_sub(&h, &identity).unwrap(), h);
+            assert_eq!(
+                group.point_sub(&identity, &h).unwrap(),
+                group.point_neg(&h).unwrap()
+            );
+            let sum = group.point_add(&g, &h).unwrap();
+            assert_eq!(group.point_sub(&sum, &h).unwrap(), g);
+
+            // y1 = x * g, so y1 - (x - 1) * g = g
+            let (x, y1, _) = group.generate_key().unwrap();
+            let x_minus_one = Scalar::new(&(x - 1u32), &group);
+            let rest = group.scalar_mult(&g, &x_minus_one).unwrap();
+            assert_eq!(group.point_sub(&y1, &rest).unwrap(), g);
+        }
+
+        // points of another group are rejected
+        let (_, _, g, _) = get_constants(&Group::EllipticCurve);
+        let one = Scalar::new(&BigUint::from(1u32), &Group::Scalar);
+        assert_eq!(
+            Group::Scalar.scalar_mult(&g, &one),
+            Err(Error::InvalidPoint)
+        );
+        let (_, _, h, _) = get_constants(&Group::Scalar);
+        assert_eq!(Group::Scalar.point_add(&h, &g), Err(Error::InvalidPoint));
+        assert_eq!(Group::Scalar.point_neg(&g), Err(Error::InvalidPoint));
+        assert_eq!(Group::Scalar.point_sub(&h, &g), Err(Error::InvalidPoint));
+    }
+}
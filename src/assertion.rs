@@ -0,0 +1,118 @@
+//! Challenge-response assertions in the shape of WebAuthn: the server issues a
+//! random challenge, the client answers with a proof bound to it and echoes
+//! the challenge back so the server can match the answer to what it issued.
+use crate::{
+    check_serialized_size, read_length_prefixed, write_length_prefixed, Commitment, Error, Group,
+    KeyPair, Point, Proof,
+};
+
+/// Answer of a client to a challenge: the echoed challenge and a proof whose
+/// Fiat-Shamir challenge is bound to it, like `Group::create_proof_for_nonce`.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Assertion {
+    pub challenge: Vec<u8>,
+    pub proof: Proof,
+}
+
+impl Assertion {
+    /// Returns the commitment `(r1, r2)` of the proof.
+    pub fn commitment(self: &Self) -> Commitment {
+        Commitment {
+            r1: self.proof.r1.clone(),
+            r2: self.proof.r2.clone(),
+        }
+    }
+
+    /// Serializes the Assertion structure of `group` to an array of bytes: the
+    /// challenge and the serialized proof, both preceded by their 4-byte
+    /// big-endian length.
+    pub fn serialize(self: &Self, group: &Group) -> Vec<u8> {
+        let mut v = Vec::new();
+        write_length_prefixed(&mut v, &self.challenge);
+        write_length_prefixed(&mut v, &self.proof.serialize(group));
+        v
+    }
+
+    /// Deserializes the Assertion structure from an array of bytes. Empty,
+    /// truncated or oversized inputs return an error.
+    pub fn deserialize(v: Vec<u8>, group: &Group) -> Result<Assertion, Error> {
+        check_serialized_size(v.len())?;
+        let mut data = &v[..];
+
+        let challenge = read_length_prefixed(&mut data)?.to_vec();
+        let proof = Proof::deserialize(read_length_prefixed(&mut data)?.to_vec(), group)?;
+
+        if !data.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+
+        Ok(Assertion { challenge, proof })
+    }
+}
+
+impl KeyPair {
+    /// Answers the `challenge` issued by the server, usually from
+    /// `Group::new_nonce`.
+    pub fn assert(self: &Self, challenge: &[u8]) -> Result<Assertion, Error> {
+        if challenge.is_empty() {
+            return Err(Error::InvalidArguments);
+        }
+
+        let proof = self
+            .group()
+            .create_proof_for_nonce(self.secret().value(), challenge)?;
+
+        Ok(Assertion {
+            challenge: challenge.to_vec(),
+            proof,
+        })
+    }
+}
+
+impl Group {
+    /// Verifies an Assertion created by `KeyPair::assert` against the public
+    /// values `(y1, y2)` and the `challenge` issued by the server. An echoed
+    /// challenge that differs from the issued one is rejected.
+    pub fn verify_assertion(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        assertion: &Assertion,
+        challenge: &[u8],
+    ) -> Result<bool, Error> {
+        if challenge.is_empty() || assertion.challenge != challenge {
+            return Ok(false);
+        }
+        self.verify_proof_for_nonce(y1, y2, &assertion.proof, challenge)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_assertion() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let key_pair = group.generate_key_pair().unwrap();
+            let (y1, y2) = key_pair.public_key();
+
+            let challenge = group.new_nonce();
+            let assertion = key_pair.assert(&challenge).unwrap();
+            assert!(group
+                .verify_assertion(y1, y2, &assertion, &challenge)
+                .unwrap());
+
+            let v = assertion.serialize(&group);
+            let deserialized = Assertion::deserialize(v, &group).unwrap();
+            assert_eq!(deserialized, assertion);
+            assert_eq!(deserialized.commitment().r1, assertion.proof.r1);
+
+            // an assertion answering another challenge
+            let other = group.new_nonce();
+            assert!(!group.verify_assertion(y1, y2, &assertion, &other).unwrap());
+
+            assert_eq!(key_pair.assert(&[]), Err(Error::InvalidArguments));
+        }
+    }
+}
@@ -0,0 +1,184 @@
+//! Audit log of the verification decisions of the process, for compliance.
+//! Once a sink is set with `set_audit_sink`, every proof counted as verified
+//! in the metrics appends a line to it, including the answers checked by
+//! `verify_interactive` and `Authenticator::verify_auth_response`:
+//!
+//! ```text
+//! ts=1700000000123 key=5f1c0a9e3b7d2e41 proof=a07c39d2e8b1f465 result=valid
+//! ```
+//!
+//! with the Unix time of the decision in milliseconds, the fingerprints of the
+//! public key `(y1, y2)` and of the proof, the same as in the logs, and
+//! `valid`, `invalid` or `error`. No secret is ever written. The lines are
+//! handed to a thread that writes to the sink, so a slow sink never stalls
+//! the verifications:
+//! when `AUDIT_BUFFER` lines are already waiting, the new ones are dropped
+//! and counted by `dropped_audit_records` instead. Write errors are logged and
+//! the line is lost as well.
+use std::io::{BufWriter, Write};
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::mpsc::{self, SyncSender, TrySendError};
+use std::sync::RwLock;
+use std::thread::JoinHandle;
+use std::time::{SystemTime, UNIX_EPOCH};
+
+use crate::{fingerprint, Error, Point, Proof};
+
+/// Number of lines waiting to be written after which new lines are dropped.
+pub const AUDIT_BUFFER: usize = 4096;
+
+struct AuditSink {
+    sender: SyncSender<String>,
+    thread: JoinHandle<()>,
+}
+
+static SINK: RwLock<Option<AuditSink>> = RwLock::new(None);
+static DROPPED: AtomicU64 = AtomicU64::new(0);
+
+/// Appends the audit lines of all the following verifications to `w`,
+/// replacing the previous sink which is flushed first.
+pub fn set_audit_sink<W: Write + Send + 'static>(w: W) {
+    let (sender, receiver) = mpsc::sync_channel::<String>(AUDIT_BUFFER);
+    let thread = std::thread::spawn(move || {
+        let mut w = BufWriter::new(w);
+        while let Ok(line) = receiver.recv() {
+            let mut result = w.write_all(line.as_bytes());
+            // flush once the lines already waiting are written
+            while let Ok(line) = receiver.try_recv() {
+                result = result.and(w.write_all(line.as_bytes()));
+            }
+            if let Err(error) = result.and_then(|_| w.flush()) {
+                log::warn!("could not write to the audit sink: {}", error);
+            }
+        }
+    });
+
+    let previous = SINK.write().unwrap().replace(AuditSink { sender, thread });
+    close(previous);
+}
+
+/// Stops auditing the verifications. Returns once the lines already recorded
+/// were written to the sink.
+pub fn remove_audit_sink() {
+    let previous = SINK.write().unwrap().take();
+    close(previous);
+}
+
+/// Returns the number of audit lines dropped because the sink was too slow.
+pub fn dropped_audit_records() -> u64 {
+    DROPPED.load(Ordering::Relaxed)
+}
+
+fn close(sink: Option<AuditSink>) {
+    if let Some(AuditSink { sender, thread }) = sink {
+        // the thread stops once the lines waiting are written
+        drop(sender);
+        let _ = thread.join();
+    }
+}
+
+pub(crate) fn record_verification(
+    y1: &Point,
+    y2: &Point,
+    proof: &Proof,
+    result: &Result<bool, Error>,
+) {
+    let sink = SINK.read().unwrap();
+    let Some(sink) = sink.as_ref() else {
+        return;
+    };
+
+    let now = SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .unwrap_or_default();
+    let key = [y1.serialize(), y2.serialize()].concat();
+    let result = match result {
+        Ok(true) => "valid",
+        Ok(false) => "invalid",
+        Err(_) => "error",
+    };
+    let line = format!(
+        "ts={} key={} proof={} result={}\n",
+        now.as_millis(),
+        fingerprint(&key),
+        fingerprint(&proof.serialize_compact()),
+        result
+    );
+
+    match sink.sender.try_send(line) {
+        Ok(()) => {}
+        Err(TrySendError::Full(_)) => {
+            DROPPED.fetch_add(1, Ordering::Relaxed);
+        }
+        Err(TrySendError::Disconnected(_)) => {
+            log::warn!("the audit sink stopped");
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::Group;
+    use std::sync::{Arc, Mutex};
+
+    #[derive(Clone, Default)]
+    struct SharedBuffer(Arc<Mutex<Vec<u8>>>);
+
+    impl Write for SharedBuffer {
+        fn write(&mut self, buf: &[u8]) -> std::io::Result<usize> {
+            self.0.lock().unwrap().write(buf)
+        }
+
+        fn flush(&mut self) -> std::io::Result<()> {
+            Ok(())
+        }
+    }
+
+    #[test]
+    fn test_audit_sink() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        let mut wrong = proof.clone();
+        wrong.s += 1u32;
+
+        let (k, commitment) = group.commit().unwrap();
+        let c = group.challenge();
+        let answer = group.respond(&commitment, &k, &c, &x);
+
+        let buffer = SharedBuffer::default();
+        let before = SystemTime::now().duration_since(UNIX_EPOCH).unwrap();
+        set_audit_sink(buffer.clone());
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+        assert!(!group.verify_proof(&y1, &y2, &wrong).unwrap());
+        assert!(group
+            .verify_interactive(&y1, &y2, &commitment, &c, &answer)
+            .unwrap());
+        remove_audit_sink();
+        // not recorded anymore
+        group.verify_proof(&y1, &y2, &proof).unwrap();
+
+        // the other tests running concurrently may add their own lines
+        let text = String::from_utf8(buffer.0.lock().unwrap().clone()).unwrap();
+        let key = fingerprint(&[y1.serialize(), y2.serialize()].concat());
+        let lines: Vec<&str> = text
+            .lines()
+            .filter(|line| line.contains(&format!(" key={} ", key)))
+            .collect();
+        assert_eq!(lines.len(), 3);
+
+        let id = |proof: &Proof| fingerprint(&proof.serialize_compact());
+        let valid = format!(" proof={} result=valid", id(&proof));
+        let invalid = format!(" proof={} result=invalid", id(&wrong));
+        let answered = format!(" proof={} result=valid", id(&answer));
+        assert!(lines[0].ends_with(&valid));
+        assert!(lines[1].ends_with(&invalid));
+        assert!(lines[2].ends_with(&answered));
+        for line in lines {
+            let ts = line.strip_prefix("ts=").unwrap().split(' ').next().unwrap();
+            assert!(ts.parse::<u128>().unwrap() >= before.as_millis());
+        }
+        assert!(!text.contains(&x.to_str_radix(16)));
+    }
+}
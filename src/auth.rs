@@ -0,0 +1,548 @@
+//! Password-less login flow built on top of the interactive protocol. Users
+//! register their public values `(y1, y2)` and later prove they know the
+//! secret `x` by answering a challenge to a commitment they send first:
+//!
+//! ```
+//! use chaum_pedersen_zkp::{Authenticator, Group};
+//!
+//! let group = Group::Scalar;
+//! let authenticator = Authenticator::new(group.clone());
+//!
+//! // the client keeps x and registers its public values
+//! let (x, y1, y2) = group.generate_key().unwrap();
+//! authenticator.register("alice", y1, y2).unwrap();
+//!
+//! // the client commits, the server answers with a challenge
+//! let (k, commitment) = group.commit().unwrap();
+//! let (auth_id, c) = authenticator
+//!     .create_auth_challenge("alice", commitment.clone())
+//!     .unwrap();
+//!
+//! // the client solves it and the server checks the solution
+//! let response = group.respond(&commitment, &k, &c, &x);
+//! let user = authenticator.verify_auth_response(&auth_id, &response.s);
+//! assert_eq!(user, Ok(Some("alice".to_string())));
+//!
+//! // each challenge is answered only once
+//! let again = authenticator.verify_auth_response(&auth_id, &response.s);
+//! assert!(again.is_err());
+//! ```
+use num_bigint::BigUint;
+use std::fmt;
+use std::sync::{mpsc, Arc, Weak};
+use std::thread::JoinHandle;
+use std::time::{Duration, SystemTime};
+
+use crate::store::{MemoryStore, PendingChallenge, Store};
+use crate::{get_constants, get_random_string, Commitment, Error, Group, Point, Proof};
+
+/// Length of the random identifiers of the authentication attempts.
+const AUTH_ID_LENGTH: usize = 10;
+
+/// Bits of the smallest group order in which the commitments are checked for
+/// reuse. In smaller groups the random commitments of honest logins repeat
+/// too often, e.g. after about 100 logins in the toy group of order 5003.
+const MIN_COMMITMENT_REUSE_BITS: u64 = 128;
+
+/// Limits of the outstanding challenges of an Authenticator, so that flooding
+/// it with login attempts can't exhaust its memory.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct AuthLimits {
+    /// Maximum number of outstanding challenges of a single user.
+    pub max_per_user: usize,
+    /// Maximum number of outstanding challenges of all the users.
+    pub max_total: usize,
+    /// Time after which a challenge can't be answered anymore.
+    pub ttl: Duration,
+    /// Time during which a commitment can't be sent again by the same user.
+    /// Ignored in groups of order below 2^128, see `Authenticator::with_store`.
+    pub commitment_window: Duration,
+    /// Maximum number of commitments remembered during their window. Once
+    /// reached, new challenges are refused until the oldest are forgotten.
+    pub max_commitments: usize,
+}
+
+impl Default for AuthLimits {
+    fn default() -> Self {
+        AuthLimits {
+            max_per_user: 8,
+            max_total: 100_000,
+            ttl: Duration::from_secs(300),
+            commitment_window: Duration::from_secs(3600),
+            max_commitments: 1_000_000,
+        }
+    }
+}
+
+/// Verifier side of the login flow. Registered users and outstanding
+/// challenges are kept in a `Store`, in memory unless created with
+/// `with_store`, so a single instance can be shared between the threads
+/// serving the requests.
+pub struct Authenticator {
+    group: Group,
+    limits: AuthLimits,
+    store: Box<dyn Store>,
+}
+
+impl fmt::Debug for Authenticator {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_struct("Authenticator")
+            .field("group", &self.group)
+            .field("limits", &self.limits)
+            .finish_non_exhaustive()
+    }
+}
+
+impl Default for Authenticator {
+    fn default() -> Self {
+        Authenticator::new(Group::default())
+    }
+}
+
+/// Background thread removing the expired challenges of an Authenticator,
+/// see `Authenticator::start_sweeper`. It stops when closed or dropped, and
+/// once the authenticator is dropped.
+#[derive(Debug)]
+pub struct Sweeper {
+    stop: Option<mpsc::Sender<()>>,
+    thread: Option<JoinHandle<()>>,
+}
+
+impl Sweeper {
+    /// Stops the thread and waits for it to finish.
+    pub fn close(mut self: Self) {
+        self.stop();
+    }
+
+    fn stop(self: &mut Self) {
+        // dropping the sender wakes the thread up
+        drop(self.stop.take());
+        if let Some(thread) = self.thread.take() {
+            let _ = thread.join();
+        }
+    }
+}
+
+impl Drop for Sweeper {
+    fn drop(&mut self) {
+        self.stop();
+    }
+}
+
+impl Authenticator {
+    /// Creates an Authenticator with the default limits.
+    pub fn new(group: Group) -> Authenticator {
+        Authenticator::with_limits(group, AuthLimits::default())
+    }
+
+    pub fn with_limits(group: Group, limits: AuthLimits) -> Authenticator {
+        Authenticator::with_store(group, limits, MemoryStore::new())
+    }
+
+    /// Creates an Authenticator keeping its users and challenges in `store`,
+    /// e.g. a database shared by several instances of the service.
+    ///
+    /// In groups of order below 2^128 honest users send the same commitment
+    /// again by chance, so the commitments aren't checked for reuse there.
+    pub fn with_store<S: Store + 'static>(
+        group: Group,
+        mut limits: AuthLimits,
+        store: S,
+    ) -> Authenticator {
+        let (_, q, _, _) = get_constants(&group);
+        if q.bits() < MIN_COMMITMENT_REUSE_BITS {
+            limits.commitment_window = Duration::ZERO;
+        }
+        Authenticator {
+            group,
+            limits,
+            store: Box::new(store),
+        }
+    }
+
+    pub fn group(self: &Self) -> &Group {
+        &self.group
+    }
+
+    /// Registers the public values of `user`, replacing the previous ones if
+    /// the user was already registered.
+    pub fn register(self: &Self, user: &str, y1: Point, y2: Point) -> Result<(), Error> {
+        if !self.group.contains(&y1) || !self.group.contains(&y2) {
+            return Err(Error::InvalidArguments);
+        }
+
+        self.store.save_user(user, &y1, &y2)
+    }
+
+    /// Stores the commitment of `user` and returns the identifier of the
+    /// authentication attempt together with the challenge `c` to answer.
+    /// Returns `Error::TooManyChallenges` if the user or all the users
+    /// together have reached the limits of outstanding challenges.
+    ///
+    /// Answering two challenges for the same commitment reveals the secret,
+    /// so a commitment the user already sent within the commitment window of
+    /// the limits returns `Error::CommitmentReuse`, except in small groups.
+    /// Only its SHA-256 digest is remembered, and only for the challenges
+    /// within the limits.
+    pub fn create_auth_challenge(
+        self: &Self,
+        user: &str,
+        commitment: Commitment,
+    ) -> Result<(String, BigUint), Error> {
+        if !self.group.contains(&commitment.r1) || !self.group.contains(&commitment.r2) {
+            return Err(Error::InvalidArguments);
+        }
+
+        if self.store.load_user(user)?.is_none() {
+            return Err(Error::UnknownUser);
+        }
+
+        let c = self.group.challenge();
+        let auth_id = get_random_string(AUTH_ID_LENGTH);
+        let pending = PendingChallenge {
+            user: user.to_string(),
+            commitment,
+            c: c.clone(),
+            expires_at: SystemTime::now() + self.limits.ttl,
+        };
+        self.store
+            .save_challenge(&auth_id, &pending, &self.limits)?;
+
+        Ok((auth_id, c))
+    }
+
+    /// Checks the solution `s` of the authentication attempt `auth_id` and
+    /// returns the user it belongs to if it is correct. Each challenge can
+    /// only be answered once, whatever the result, and challenges older than
+    /// the TTL return `Error::Expired`.
+    pub fn verify_auth_response(
+        self: &Self,
+        auth_id: &str,
+        s: &BigUint,
+    ) -> Result<Option<String>, Error> {
+        let pending = self
+            .store
+            .consume_challenge(auth_id)?
+            .ok_or(Error::UnknownChallenge)?;
+        if pending.expires_at <= SystemTime::now() {
+            return Err(Error::Expired);
+        }
+
+        let (y1, y2) = self
+            .store
+            .load_user(&pending.user)?
+            .ok_or(Error::UnknownUser)?;
+
+        let proof = Proof {
+            r1: pending.commitment.r1.clone(),
+            r2: pending.commitment.r2.clone(),
+            c: pending.c.clone(),
+            s: s.clone(),
+        };
+
+        let commitment = &pending.commitment;
+        let valid = self
+            .group
+            .verify_interactive(&y1, &y2, commitment, &pending.c, &proof)?;
+        Ok(valid.then_some(pending.user))
+    }
+
+    /// Returns the number of challenges not answered yet, expired ones
+    /// included until they are removed.
+    pub fn pending_challenges(self: &Self) -> Result<usize, Error> {
+        self.store.pending_challenges()
+    }
+
+    /// Removes the expired challenges and returns how many there were. The
+    /// commitments sent before the commitment window are forgotten as well.
+    pub fn remove_expired_challenges(self: &Self) -> Result<usize, Error> {
+        self.store.remove_expired_challenges(SystemTime::now())
+    }
+
+    /// Starts a thread calling `remove_expired_challenges` every `interval`
+    /// until the returned Sweeper is closed.
+    pub fn start_sweeper(self: &Arc<Self>, interval: Duration) -> Sweeper {
+        let (stop, stopped) = mpsc::channel::<()>();
+        let authenticator: Weak<Authenticator> = Arc::downgrade(self);
+
+        let thread = std::thread::spawn(move || {
+            while let Err(mpsc::RecvTimeoutError::Timeout) = stopped.recv_timeout(interval) {
+                let Some(authenticator) = authenticator.upgrade() else {
+                    break;
+                };
+                if let Err(error) = authenticator.remove_expired_challenges() {
+                    log::warn!("could not remove the expired challenges: {}", error);
+                }
+            }
+        });
+
+        Sweeper {
+            stop: Some(stop),
+            thread: Some(thread),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::time::Instant;
+
+    #[test]
+    fn test_login() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let authenticator = Authenticator::new(group.clone());
+
+            let (x, y1, y2) = group.generate_key().unwrap();
+            authenticator.register("alice", y1, y2).unwrap();
+
+            let (k, commitment) = group.commit().unwrap();
+            let (auth_id, c) = authenticator
+                .create_auth_challenge("alice", commitment.clone())
+                .unwrap();
+            let proof = group.respond(&commitment, &k, &c, &x);
+            assert_eq!(
+                authenticator.verify_auth_response(&auth_id, &proof.s),
+                Ok(Some("alice".to_string()))
+            );
+
+            // the challenge can't be answered twice
+            assert_eq!(
+                authenticator.verify_auth_response(&auth_id, &proof.s),
+                Err(Error::UnknownChallenge)
+            );
+
+            // a wrong secret doesn't log in
+            let (k, commitment) = group.commit().unwrap();
+            let (auth_id, c) = authenticator
+                .create_auth_challenge("alice", commitment.clone())
+                .unwrap();
+            let proof = group.respond(&commitment, &k, &c, &(&x + 1u32));
+            assert_eq!(
+                authenticator.verify_auth_response(&auth_id, &proof.s),
+                Ok(None)
+            );
+        }
+    }
+
+    #[test]
+    fn test_challenge_limits() {
+        let limits = AuthLimits {
+            max_per_user: 2,
+            max_total: 3,
+            ..Default::default()
+        };
+        let authenticator = Authenticator::with_limits(Group::Scalar, limits);
+        for user in ["alice", "bob"] {
+            let (_, y1, y2) = Group::Scalar.generate_key().unwrap();
+            authenticator.register(user, y1, y2).unwrap();
+        }
+
+        let challenge = |user| {
+            let (_, commitment) = Group::Scalar.commit().unwrap();
+            authenticator.create_auth_challenge(user, commitment)
+        };
+        challenge("alice").unwrap();
+        let (auth_id, _) = challenge("alice").unwrap();
+        assert_eq!(challenge("alice"), Err(Error::TooManyChallenges));
+
+        challenge("bob").unwrap();
+        assert_eq!(challenge("bob"), Err(Error::TooManyChallenges));
+
+        // answering a challenge frees its slot
+        let _ = authenticator.verify_auth_response(&auth_id, &BigUint::from(1u32));
+        challenge("bob").unwrap();
+        assert_eq!(authenticator.pending_challenges(), Ok(3));
+    }
+
+    #[test]
+    fn test_challenge_expiry() {
+        let limits = AuthLimits {
+            ttl: Duration::ZERO,
+            ..Default::default()
+        };
+        let authenticator = Arc::new(Authenticator::with_limits(Group::Scalar, limits));
+        let (x, y1, y2) = Group::Scalar.generate_key().unwrap();
+        authenticator.register("alice", y1, y2).unwrap();
+
+        let (k, commitment) = Group::Scalar.commit().unwrap();
+        let (auth_id, c) = authenticator
+            .create_auth_challenge("alice", commitment.clone())
+            .unwrap();
+        let proof = Group::Scalar.respond(&commitment, &k, &c, &x);
+        assert_eq!(
+            authenticator.verify_auth_response(&auth_id, &proof.s),
+            Err(Error::Expired)
+        );
+
+        let (_, commitment) = Group::Scalar.commit().unwrap();
+        authenticator
+            .create_auth_challenge("alice", commitment)
+            .unwrap();
+        assert_eq!(authenticator.remove_expired_challenges(), Ok(1));
+        assert_eq!(authenticator.pending_challenges(), Ok(0));
+
+        let sweeper = authenticator.start_sweeper(Duration::from_millis(1));
+        let (_, commitment) = Group::Scalar.commit().unwrap();
+        authenticator
+            .create_auth_challenge("alice", commitment)
+            .unwrap();
+        let start = Instant::now();
+        while authenticator.pending_challenges() != Ok(0) {
+            assert!(start.elapsed() < Duration::from_secs(10));
+            std::thread::sleep(Duration::from_millis(1));
+        }
+        sweeper.close();
+    }
+
+    /// Store whose backend is down.
+    struct FailingStore;
+
+    impl Store for FailingStore {
+        fn save_user(self: &Self, _: &str, _: &Point, _: &Point) -> Result<(), Error> {
+            Err(Error::StoreFailure)
+        }
+
+        fn load_user(self: &Self, _: &str) -> Result<Option<(Point, Point)>, Error> {
+            Err(Error::StoreFailure)
+        }
+
+        fn save_challenge(
+            self: &Self,
+            _: &str,
+            _: &PendingChallenge,
+            _: &AuthLimits,
+        ) -> Result<(), Error> {
+            Err(Error::StoreFailure)
+        }
+
+        fn consume_challenge(self: &Self, _: &str) -> Result<Option<PendingChallenge>, Error> {
+            Err(Error::StoreFailure)
+        }
+
+        fn pending_challenges(self: &Self) -> Result<usize, Error> {
+            Err(Error::StoreFailure)
+        }
+
+        fn remove_expired_challenges(self: &Self, _: SystemTime) -> Result<usize, Error> {
+            Err(Error::StoreFailure)
+        }
+    }
+
+    #[test]
+    fn test_with_store() {
+        let group = Group::Scalar;
+        let authenticator =
+            Authenticator::with_store(group.clone(), AuthLimits::default(), FailingStore);
+        let (_, y1, y2) = group.generate_key().unwrap();
+        let (_, commitment) = group.commit().unwrap();
+
+        assert_eq!(
+            authenticator.register("alice", y1, y2),
+            Err(Error::StoreFailure)
+        );
+        assert_eq!(
+            authenticator.create_auth_challenge("alice", commitment),
+            Err(Error::StoreFailure)
+        );
+        assert_eq!(
+            authenticator.verify_auth_response("id", &BigUint::from(1u32)),
+            Err(Error::StoreFailure)
+        );
+        assert_eq!(
+            authenticator.remove_expired_challenges(),
+            Err(Error::StoreFailure)
+        );
+    }
+
+    #[test]
+    fn test_commitment_reuse() {
+        let limits = AuthLimits {
+            commitment_window: Duration::from_secs(60),
+            ..Default::default()
+        };
+        let group = Group::EllipticCurve;
+        let authenticator = Authenticator::with_limits(group.clone(), limits);
+        for user in ["alice", "bob"] {
+            let (_, y1, y2) = group.generate_key().unwrap();
+            authenticator.register(user, y1, y2).unwrap();
+        }
+
+        let (_, commitment) = group.commit().unwrap();
+        let (auth_id, _) = authenticator
+            .create_auth_challenge("alice", commitment.clone())
+            .unwrap();
+        assert_eq!(
+            authenticator.create_auth_challenge("alice", commitment.clone()),
+            Err(Error::CommitmentReuse)
+        );
+
+        // answering the challenge doesn't make the commitment reusable
+        let _ = authenticator.verify_auth_response(&auth_id, &BigUint::from(1u32));
+        assert_eq!(
+            authenticator.create_auth_challenge("alice", commitment.clone()),
+            Err(Error::CommitmentReuse)
+        );
+        authenticator
+            .create_auth_challenge("bob", commitment.clone())
+            .unwrap();
+
+        // the commitments are forgotten after the window
+        let authenticator = Authenticator::with_limits(
+            group.clone(),
+            AuthLimits {
+                commitment_window: Duration::ZERO,
+                ..Default::default()
+            },
+        );
+        let (_, y1, y2) = group.generate_key().unwrap();
+        authenticator.register("alice", y1, y2).unwrap();
+        for _ in 0..2 {
+            authenticator
+                .create_auth_challenge("alice", commitment.clone())
+                .unwrap();
+        }
+    }
+
+    #[test]
+    fn test_commitment_reuse_small_group() {
+        // about 25 commitments repeat by chance in 500 logins
+        let group = Group::Scalar;
+        let authenticator = Authenticator::new(group.clone());
+        let (x, y1, y2) = group.generate_key().unwrap();
+        authenticator.register("alice", y1, y2).unwrap();
+
+        for _ in 0..500 {
+            let (k, commitment) = group.commit().unwrap();
+            let (auth_id, c) = authenticator
+                .create_auth_challenge("alice", commitment.clone())
+                .unwrap();
+            let proof = group.respond(&commitment, &k, &c, &x);
+            assert_eq!(
+                authenticator.verify_auth_response(&auth_id, &proof.s),
+                Ok(Some("alice".to_string()))
+            );
+        }
+    }
+
+    #[test]
+    fn test_login_invalid_input() {
+        let authenticator = Authenticator::new(Group::Scalar);
+        let (_, commitment) = Group::Scalar.commit().unwrap();
+
+        assert_eq!(
+            authenticator.create_auth_challenge("bob", commitment),
+            Err(Error::UnknownUser)
+        );
+        assert_eq!(
+            authenticator.verify_auth_response("unknown", &BigUint::from(1u32)),
+            Err(Error::UnknownChallenge)
+        );
+
+        let (_, y1, y2) = Group::EllipticCurve.generate_key().unwrap();
+        assert_eq!(
+            authenticator.register("bob", y1, y2),
+            Err(Error::InvalidArguments)
+        );
+    }
+}
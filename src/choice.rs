@@ -0,0 +1,162 @@
+//! Results of verification to be consumed without branching, for callers
+//! that want the whole decision path to be timing-safe and not only the
+//! comparisons of the verification. A `Choice` is combined and turned into
+//! values with bit masks instead of `if`, e.g. to pick the status of a
+//! response:
+//!
+//! ```
+//! use chaum_pedersen_zkp::Group;
+//!
+//! const DENIED: u32 = 403;
+//! const GRANTED: u32 = 200;
+//!
+//! let group = Group::Scalar;
+//! let (x, y1, y2) = group.generate_key().unwrap();
+//! let proof = group.create_proof(&x).unwrap();
+//!
+//! let valid = group.verify_proof_ct(&y1, &y2, &proof).unwrap();
+//! assert_eq!(valid.select(DENIED, GRANTED), GRANTED);
+//! ```
+//!
+//! Converting a Choice into a `bool` gives back a value the compiler may
+//! branch on, so only do it where timing doesn't matter anymore.
+use std::hint::black_box;
+use std::ops::{BitAnd, BitOr, Not};
+
+use crate::{timeout, ChallengeParams, Error, Group, Operation, Point, Proof};
+
+/// A boolean held as the byte 0 or 1, see the module documentation.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct Choice(u8);
+
+impl Choice {
+    /// Returns 1 for true and 0 for false.
+    pub fn unwrap_u8(self: &Self) -> u8 {
+        self.0
+    }
+
+    /// Returns `if_true` when the Choice is true, `if_false` otherwise,
+    /// selecting with a mask rather than a branch.
+    pub fn select(self: &Self, if_false: u32, if_true: u32) -> u32 {
+        // 0 for false, all ones for true
+        let mask = (black_box(self.0) as u32).wrapping_neg();
+        if_false ^ (mask & (if_false ^ if_true))
+    }
+}
+
+impl From<bool> for Choice {
+    fn from(value: bool) -> Choice {
+        Choice(black_box(value as u8))
+    }
+}
+
+impl From<Choice> for bool {
+    fn from(choice: Choice) -> bool {
+        choice.0 == 1
+    }
+}
+
+impl BitAnd for Choice {
+    type Output = Choice;
+
+    fn bitand(self, rhs: Choice) -> Choice {
+        Choice(self.0 & rhs.0)
+    }
+}
+
+impl BitOr for Choice {
+    type Output = Choice;
+
+    fn bitor(self, rhs: Choice) -> Choice {
+        Choice(self.0 | rhs.0)
+    }
+}
+
+impl Not for Choice {
+    type Output = Choice;
+
+    fn not(self) -> Choice {
+        Choice(self.0 ^ 1)
+    }
+}
+
+impl Group {
+    /// Same as `verify_proof` but returns the result as a Choice, to be
+    /// consumed without branching on it. The comparisons of the verification
+    /// are combined into the Choice as bytes, never as a `bool`. Errors are
+    /// still returned early, they only depend on the public inputs.
+    ///
+    /// The decision is not counted in `metrics()` nor written to the audit
+    /// log, which would branch on it.
+    pub fn verify_proof_ct(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+    ) -> Result<Choice, Error> {
+        let timeout = self.operation_timeout(Operation::Verify);
+        if timeout.is_zero() {
+            return self
+                .check_proof_u8(y1, y2, proof, ChallengeParams::default())
+                .map(|valid| Choice(black_box(valid)));
+        }
+
+        let (group, y1, y2, proof) = (self.clone(), y1.clone(), y2.clone(), proof.clone());
+        timeout::run_with_timeout(timeout, move || {
+            group
+                .check_proof_u8(&y1, &y2, &proof, ChallengeParams::default())
+                .map(|valid| Choice(black_box(valid)))
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_choice() {
+        let (yes, no) = (Choice::from(true), Choice::from(false));
+        assert_eq!((yes.unwrap_u8(), no.unwrap_u8()), (1, 0));
+        assert_eq!((yes & no, yes | no, !no), (no, yes, yes));
+        assert_eq!((yes.select(7, 9), no.select(7, 9)), (9, 7));
+        assert!(bool::from(yes) && !bool::from(no));
+    }
+
+    #[test]
+    fn test_verify_proof_ct() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        assert_eq!(
+            group.verify_proof_ct(&y1, &y2, &proof),
+            Ok(Choice::from(true))
+        );
+
+        let mut tampered = proof.clone();
+        tampered.s += 1u32;
+        assert_eq!(
+            group.verify_proof_ct(&y1, &y2, &tampered),
+            Ok(Choice::from(false))
+        );
+        // a proof of other public values, with a challenge that doesn't match
+        assert_eq!(
+            group.verify_proof_ct(&y2, &y1, &proof),
+            Ok(Choice::from(false))
+        );
+    }
+
+    #[test]
+    fn test_verify_proof_ct_scalar() {
+        let group = Group::Scalar;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        let valid = group.verify_proof_ct(&y1, &y2, &proof).unwrap();
+        assert_eq!(valid.unwrap_u8(), 1);
+
+        let mut tampered = proof.clone();
+        tampered.c += 1u32;
+        let valid = group.verify_proof_ct(&y1, &y2, &tampered).unwrap();
+        assert_eq!(valid.unwrap_u8(), 0);
+    }
+}
@@ -23,7 +23,7 @@ async fn main() -> Result<(), Box<dyn std::error::Error>> {
     let server_addr = "http://127.0.0.1:50051";
 
     println!(
-        "Running client connecting to {} ZKP: {:?}",
+        "Running client connecting to {} ZKP: {}",
         server_addr, group
     );
 
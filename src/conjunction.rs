@@ -0,0 +1,291 @@
+//! Conjunctive proofs: the prover shows they know the secrets of all of
+//! several public keys at once, e.g. one per factor of a multi-factor login.
+//! The proofs of the keys share a single Fiat-Shamir challenge computed over
+//! all the keys and commitments (AND-composition), so the proof holds one
+//! challenge and one solution per key instead of a full proof per key. It
+//! can't shrink further: the verifier needs a solution for every secret.
+//!
+//! The rotation proofs are the conjunctive proofs of an old and a new key,
+//! showing that the party rotating its key controls both.
+use num_bigint::BigUint;
+
+use crate::{
+    check_serialized_size, get_constants, read_length_prefixed, solve_zk_challenge_s,
+    write_length_prefixed, Error, Group, Point, PrivateKey, PublicKey, Scalar,
+};
+
+/// Labels of the challenges, so that a rotation proof can't be passed off as
+/// a conjunctive proof of the same keys or the other way around.
+const CONJUNCTION_LABEL: &[u8] = b"conjunction";
+const ROTATION_LABEL: &[u8] = b"rotation";
+
+/// Structure holding the shared challenge `c` and the solutions `s` of the
+/// keys, in the order of the keys. The commitments are not stored as the
+/// verifier recomputes them.
+#[derive(Debug, Clone, PartialEq)]
+pub struct ConjunctiveProof {
+    pub c: BigUint,
+    pub s: Vec<BigUint>,
+}
+
+impl ConjunctiveProof {
+    /// Serializes the ConjunctiveProof structure to an array of bytes: `c`
+    /// followed by the solutions, each one preceded by its 4-byte big-endian
+    /// length.
+    pub fn serialize(self: &Self) -> Vec<u8> {
+        let mut v = Vec::new();
+        write_length_prefixed(&mut v, &self.c.to_bytes_be());
+        for s in &self.s {
+            write_length_prefixed(&mut v, &s.to_bytes_be());
+        }
+        v
+    }
+
+    /// Deserializes the ConjunctiveProof structure from an array of bytes.
+    /// Empty, truncated inputs or inputs without solutions return an error.
+    pub fn deserialize(v: Vec<u8>) -> Result<ConjunctiveProof, Error> {
+        check_serialized_size(v.len())?;
+        let mut data = &v[..];
+
+        let c = read_length_prefixed(&mut data)?;
+        let mut s = Vec::new();
+        while !data.is_empty() {
+            s.push(read_length_prefixed(&mut data)?);
+        }
+
+        if c.is_empty() || s.is_empty() || s.iter().any(|s| s.is_empty()) {
+            return Err(Error::InvalidSerialization);
+        }
+
+        Ok(ConjunctiveProof {
+            c: BigUint::from_bytes_be(c),
+            s: s.into_iter().map(BigUint::from_bytes_be).collect(),
+        })
+    }
+}
+
+impl Group {
+    /// Creates a ConjunctiveProof of the knowledge of all the `secrets`, which
+    /// verifies with their public values `(y1, y2)` in the same order. No
+    /// secret returns `Error::InvalidKeyCount`.
+    pub fn create_conjunctive_proof(
+        self: &Self,
+        secrets: &[BigUint],
+    ) -> Result<ConjunctiveProof, Error> {
+        self.prove_conjunction(CONJUNCTION_LABEL, secrets)
+    }
+
+    /// Verifies a ConjunctiveProof created with `create_conjunctive_proof`
+    /// against the public values of the secrets, in the same order. A number
+    /// of keys different from the one of the proof returns
+    /// `Error::LengthMismatch`.
+    pub fn verify_conjunctive_proof(
+        self: &Self,
+        keys: &[(Point, Point)],
+        proof: &ConjunctiveProof,
+    ) -> Result<bool, Error> {
+        self.check_conjunction(CONJUNCTION_LABEL, keys, proof)
+    }
+
+    /// Creates a proof that the party rotating its key from `old` to `new`
+    /// knows both secrets, so that stealing only the new key isn't enough to
+    /// complete a rotation. The proof is bound to the order of the keys.
+    pub fn create_rotation_proof(
+        self: &Self,
+        old: &PrivateKey,
+        new: &PrivateKey,
+    ) -> Result<ConjunctiveProof, Error> {
+        let secrets = [old.secret().value().clone(), new.secret().value().clone()];
+        self.prove_conjunction(ROTATION_LABEL, &secrets)
+    }
+
+    /// Verifies a proof created with `create_rotation_proof` for the public
+    /// keys `old` and `new`.
+    pub fn verify_rotation_proof(
+        self: &Self,
+        old: &PublicKey,
+        new: &PublicKey,
+        proof: &ConjunctiveProof,
+    ) -> Result<bool, Error> {
+        let keys = [
+            (old.y1.clone(), old.y2.clone()),
+            (new.y1.clone(), new.y2.clone()),
+        ];
+        self.check_conjunction(ROTATION_LABEL, &keys, proof)
+    }
+
+    fn prove_conjunction(
+        self: &Self,
+        label: &[u8],
+        secrets: &[BigUint],
+    ) -> Result<ConjunctiveProof, Error> {
+        if secrets.is_empty() {
+            return Err(Error::InvalidKeyCount);
+        }
+
+        let (_, q, g, h) = get_constants(self);
+
+        let mut keys = Vec::with_capacity(secrets.len());
+        let mut k = Vec::with_capacity(secrets.len());
+        let mut commitments = Vec::with_capacity(secrets.len());
+        for x in secrets {
+            keys.push(self.public_key(x)?);
+            let k_i = self.random_scalar();
+            commitments.push((self.scalar_mult(&g, &k_i)?, self.scalar_mult(&h, &k_i)?));
+            k.push(k_i);
+        }
+
+        let c = self.composite_challenge(label, &keys, &commitments, &q);
+        let s = secrets
+            .iter()
+            .zip(&k)
+            .map(|(x, k_i)| solve_zk_challenge_s(x, k_i.value(), &c, &q))
+            .collect();
+
+        Ok(ConjunctiveProof { c, s })
+    }
+
+    fn check_conjunction(
+        self: &Self,
+        label: &[u8],
+        keys: &[(Point, Point)],
+        proof: &ConjunctiveProof,
+    ) -> Result<bool, Error> {
+        if keys.is_empty() {
+            return Err(Error::InvalidKeyCount);
+        }
+        if keys.len() != proof.s.len() {
+            return Err(Error::LengthMismatch);
+        }
+
+        let (_, q, g, h) = get_constants(self);
+        // a challenge out of range would give another encoding of the proof
+        if proof.c >= q {
+            return Ok(false);
+        }
+
+        let c = Scalar::new(&proof.c, self);
+        let mut commitments = Vec::with_capacity(keys.len());
+        for ((y1, y2), s) in keys.iter().zip(&proof.s) {
+            let s = Scalar::new(s, self);
+            commitments.push((
+                self.simulated_commitment(&g, y1, &c, &s)?,
+                self.simulated_commitment(&h, y2, &c, &s)?,
+            ));
+        }
+
+        let challenge = self.composite_challenge(label, keys, &commitments, &q);
+        Ok(challenge == proof.c)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn new_keys(group: &Group, n: usize) -> (Vec<BigUint>, Vec<(Point, Point)>) {
+        let keys = group.generate_keys(n).unwrap();
+        let secrets = keys.iter().map(|(x, _, _)| x.clone()).collect();
+        let public_keys = keys.into_iter().map(|(_, y1, y2)| (y1, y2)).collect();
+        (secrets, public_keys)
+    }
+
+    #[test]
+    fn test_conjunctive_proof() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (secrets, keys) = new_keys(&group, 3);
+            let proof = group.create_conjunctive_proof(&secrets).unwrap();
+            assert!(group.verify_conjunctive_proof(&keys, &proof).unwrap());
+
+            let v = proof.serialize();
+            assert_eq!(ConjunctiveProof::deserialize(v), Ok(proof.clone()));
+
+            assert_eq!(
+                group.verify_conjunctive_proof(&keys[1..], &proof),
+                Err(Error::LengthMismatch)
+            );
+        }
+
+        assert_eq!(
+            Group::Scalar.create_conjunctive_proof(&[]),
+            Err(Error::InvalidKeyCount)
+        );
+        assert!(ConjunctiveProof::deserialize(vec![0, 0, 0, 1, 1]).is_err());
+    }
+
+    #[test]
+    fn test_conjunctive_proof_invalid() {
+        let group = Group::EllipticCurve;
+        let (secrets, keys) = new_keys(&group, 3);
+        let (_, others) = new_keys(&group, 1);
+        let proof = group.create_conjunctive_proof(&secrets).unwrap();
+
+        let mut wrong = keys.clone();
+        wrong[1] = others[0].clone();
+        assert!(!group.verify_conjunctive_proof(&wrong, &proof).unwrap());
+
+        let mut swapped = keys.clone();
+        swapped.swap(0, 2);
+        assert!(!group.verify_conjunctive_proof(&swapped, &proof).unwrap());
+
+        let mut tampered = proof.clone();
+        tampered.s[2] += 1u32;
+        assert!(!group.verify_conjunctive_proof(&keys, &tampered).unwrap());
+
+        let mut large = proof.clone();
+        large.c += get_constants(&group).1;
+        assert!(!group.verify_conjunctive_proof(&keys, &large).unwrap());
+    }
+
+    #[test]
+    fn test_rotation_proof() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let old = group.generate_private_key().unwrap();
+            let new = group.generate_private_key().unwrap();
+            let (old_public, new_public) = (
+                old.public_key(&group).unwrap(),
+                new.public_key(&group).unwrap(),
+            );
+
+            let proof = group.create_rotation_proof(&old, &new).unwrap();
+            assert!(group
+                .verify_rotation_proof(&old_public, &new_public, &proof)
+                .unwrap());
+        }
+    }
+
+    #[test]
+    fn test_rotation_proof_invalid() {
+        let group = Group::EllipticCurve;
+        let old = group.generate_private_key().unwrap();
+        let new = group.generate_private_key().unwrap();
+        let (old_public, new_public) = (
+            old.public_key(&group).unwrap(),
+            new.public_key(&group).unwrap(),
+        );
+        let proof = group.create_rotation_proof(&old, &new).unwrap();
+
+        assert!(!group
+            .verify_rotation_proof(&new_public, &old_public, &proof)
+            .unwrap());
+
+        // an attacker holding only the new key
+        let other = group.generate_private_key().unwrap();
+        let forged = group.create_rotation_proof(&other, &new).unwrap();
+        assert!(!group
+            .verify_rotation_proof(&old_public, &new_public, &forged)
+            .unwrap());
+
+        // rotation and conjunctive proofs are not interchangeable
+        let keys = [
+            (old_public.y1.clone(), old_public.y2.clone()),
+            (new_public.y1.clone(), new_public.y2.clone()),
+        ];
+        assert!(!group.verify_conjunctive_proof(&keys, &proof).unwrap());
+        let secrets = [old.secret().value().clone(), new.secret().value().clone()];
+        let conjunctive = group.create_conjunctive_proof(&secrets).unwrap();
+        assert!(!group
+            .verify_rotation_proof(&old_public, &new_public, &conjunctive)
+            .unwrap());
+    }
+}
@@ -0,0 +1,152 @@
+//! Proofs of equality of discrete logarithms (DLEQ) for any two bases of the
+//! group: the prover shows that `y1 = x * base1` and `y2 = x * base2` share the
+//! same secret `x` without revealing it, e.g. for verifiable random functions
+//! or to attest a Diffie-Hellman key exchange. It is the statement of the
+//! Chaum-Pedersen protocol itself, `create_proof` being the case of the
+//! generators `g` and `h` of the group.
+use num::traits::Zero;
+use num_bigint::BigUint;
+
+use crate::{
+    ct_eq_biguint, exponentiates_points, fiat_shamir_challenge, get_constants,
+    solve_zk_challenge_s, verify, ChallengeHash, Error, Group, Point, Proof,
+};
+
+impl Group {
+    /// Creates a proof that the values `x * base1` and `x * base2` share the
+    /// secret `x`. Bases that are not elements of the group, or the identity,
+    /// return `Error::InvalidPoint`. With the generators of the group, the
+    /// proof is the one of `create_proof` and also verifies with
+    /// `verify_proof`.
+    pub fn create_dleq_proof(
+        self: &Self,
+        x: &BigUint,
+        base1: &Point,
+        base2: &Point,
+    ) -> Result<Proof, Error> {
+        self.check_base(base1)?;
+        self.check_base(base2)?;
+        let (p, q, _, _) = get_constants(self);
+
+        let (y1, y2) = exponentiates_points(x, base1, base2, &p)?;
+        // a zero k can't be committed to on the curve
+        let k = loop {
+            let k = self.random_scalar();
+            if !k.value().is_zero() {
+                break k;
+            }
+        };
+        let (r1, r2) = exponentiates_points(k.value(), base1, base2, &p)?;
+
+        let points = [base1, base2, &y1, &y2, &r1, &r2];
+        let c = fiat_shamir_challenge(&points, &q, ChallengeHash::default(), &[]);
+        let s = solve_zk_challenge_s(x, k.value(), &c, &q);
+        Ok(Proof { r1, r2, c, s })
+    }
+
+    /// Verifies a proof created with `create_dleq_proof` that `y1` and `y2`
+    /// have the same discrete logarithm in the bases `base1` and `base2`.
+    pub fn verify_dleq_proof(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        base1: &Point,
+        base2: &Point,
+        proof: &Proof,
+    ) -> Result<bool, Error> {
+        self.check_base(base1)?;
+        self.check_base(base2)?;
+        let (p, q, _, _) = get_constants(self);
+
+        let points = [base1, base2, y1, y2, &proof.r1, &proof.r2];
+        let c = fiat_shamir_challenge(&points, &q, ChallengeHash::default(), &[]);
+
+        let valid = verify(
+            &proof.r1, &proof.r2, y1, y2, base1, base2, &proof.c, &proof.s, &p,
+        )?;
+        Ok(ct_eq_biguint(&c, &proof.c) & valid)
+    }
+
+    fn check_base(self: &Self, base: &Point) -> Result<(), Error> {
+        if base.is_identity() || !self.contains(base) {
+            return Err(Error::InvalidPoint);
+        }
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::Scalar;
+
+    /// Returns two random bases of the group.
+    fn new_bases(group: &Group) -> (Point, Point) {
+        let (_, base1, base2) = group.generate_key().unwrap();
+        (base1, base2)
+    }
+
+    #[test]
+    fn test_dleq_proof() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (base1, base2) = new_bases(&group);
+            let (x, _, _) = group.generate_key().unwrap();
+            let secret = Scalar::new(&x, &group);
+            let y1 = group.scalar_mult(&base1, &secret).unwrap();
+            let y2 = group.scalar_mult(&base2, &secret).unwrap();
+
+            let proof = group.create_dleq_proof(&x, &base1, &base2).unwrap();
+            assert!(group
+                .verify_dleq_proof(&y1, &y2, &base1, &base2, &proof)
+                .unwrap());
+
+            // the generators give the proofs of create_proof
+            let (_, _, g, h) = get_constants(&group);
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let proof = group.create_dleq_proof(&x, &g, &h).unwrap();
+            assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+            let proof = group.create_proof(&x).unwrap();
+            assert!(group.verify_dleq_proof(&y1, &y2, &g, &h, &proof).unwrap());
+
+            let identity = group.identity();
+            assert_eq!(
+                group.create_dleq_proof(&x, &identity, &h),
+                Err(Error::InvalidPoint)
+            );
+            assert_eq!(
+                group.verify_dleq_proof(&y1, &y2, &g, &identity, &proof),
+                Err(Error::InvalidPoint)
+            );
+        }
+    }
+
+    #[test]
+    fn test_dleq_proof_invalid() {
+        let group = Group::EllipticCurve;
+        let (base1, base2) = new_bases(&group);
+        let (x, _, _) = group.generate_key().unwrap();
+        let secret = Scalar::new(&x, &group);
+        let y1 = group.scalar_mult(&base1, &secret).unwrap();
+        let y2 = group.scalar_mult(&base2, &secret).unwrap();
+        let proof = group.create_dleq_proof(&x, &base1, &base2).unwrap();
+
+        // the bases are bound to the proof
+        assert!(!group
+            .verify_dleq_proof(&y1, &y2, &base2, &base1, &proof)
+            .unwrap());
+
+        // y2 with another secret
+        let (other, _, _) = group.generate_key().unwrap();
+        let other = Scalar::new(&other, &group);
+        let wrong = group.scalar_mult(&base2, &other).unwrap();
+        assert!(!group
+            .verify_dleq_proof(&y1, &wrong, &base1, &base2, &proof)
+            .unwrap());
+
+        let mut tampered = proof.clone();
+        tampered.s += 1u32;
+        assert!(!group
+            .verify_dleq_proof(&y1, &y2, &base1, &base2, &tampered)
+            .unwrap());
+    }
+}
@@ -0,0 +1,113 @@
+//! Textual representations of points and proofs: the hex or standard base64
+//! encoding of their serialized bytes.
+use base64::{engine::general_purpose::STANDARD, Engine as _};
+
+use crate::{check_serialized_size, Error, Group, Point, Proof};
+
+impl Point {
+    /// Encodes the serialized Point as a lowercase hex string.
+    pub fn to_hex(self: &Self) -> String {
+        hex::encode(self.serialize())
+    }
+
+    /// Decodes a Point of `group` from a hex string.
+    pub fn from_hex(s: &str, group: &Group) -> Result<Point, Error> {
+        check_serialized_size(s.len() / 2)?;
+        let v = hex::decode(s).map_err(|_| Error::InvalidSerialization)?;
+        Point::deserialize(v, group)
+    }
+
+    /// Encodes the serialized Point as a standard base64 string.
+    pub fn to_base64(self: &Self) -> String {
+        STANDARD.encode(self.serialize())
+    }
+
+    /// Decodes a Point of `group` from a standard base64 string.
+    pub fn from_base64(s: &str, group: &Group) -> Result<Point, Error> {
+        check_serialized_size(s.len() / 4 * 3)?;
+        let v = STANDARD
+            .decode(s)
+            .map_err(|_| Error::InvalidSerialization)?;
+        Point::deserialize(v, group)
+    }
+}
+
+impl Proof {
+    /// Encodes the serialized Proof of `group` as a lowercase hex string.
+    pub fn to_hex(self: &Self, group: &Group) -> String {
+        hex::encode(self.serialize(group))
+    }
+
+    /// Decodes a Proof of `group` from a hex string.
+    pub fn from_hex(s: &str, group: &Group) -> Result<Proof, Error> {
+        check_serialized_size(s.len() / 2)?;
+        let v = hex::decode(s).map_err(|_| Error::InvalidSerialization)?;
+        Proof::deserialize(v, group)
+    }
+
+    /// Encodes the serialized Proof of `group` as a standard base64 string.
+    pub fn to_base64(self: &Self, group: &Group) -> String {
+        STANDARD.encode(self.serialize(group))
+    }
+
+    /// Decodes a Proof of `group` from a standard base64 string.
+    pub fn from_base64(s: &str, group: &Group) -> Result<Proof, Error> {
+        check_serialized_size(s.len() / 4 * 3)?;
+        let v = STANDARD
+            .decode(s)
+            .map_err(|_| Error::InvalidSerialization)?;
+        Proof::deserialize(v, group)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use num_bigint::BigUint;
+
+    #[test]
+    fn test_point_encoding() {
+        let group = Group::Scalar;
+        let point = Point::Scalar(BigUint::from(3210u32));
+
+        assert_eq!(point.to_hex(), "0c8a");
+        assert_eq!(point.to_base64(), "DIo=");
+        assert_eq!(Point::from_hex("0c8a", &group).unwrap(), point);
+        assert_eq!(Point::from_hex("0C8A", &group).unwrap(), point);
+        assert_eq!(Point::from_base64("DIo=", &group).unwrap(), point);
+
+        assert_eq!(
+            Point::from_hex("fee", &group),
+            Err(Error::InvalidSerialization)
+        );
+        assert_eq!(
+            Point::from_base64("/u*=", &group),
+            Err(Error::InvalidSerialization)
+        );
+        assert_eq!(
+            Point::from_hex("", &group),
+            Err(Error::InvalidSerialization)
+        );
+    }
+
+    #[test]
+    fn test_proof_encoding() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, _, _) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+
+            assert_eq!(
+                Proof::from_hex(&proof.to_hex(&group), &group).unwrap(),
+                proof
+            );
+            assert_eq!(
+                Proof::from_base64(&proof.to_base64(&group), &group).unwrap(),
+                proof
+            );
+            assert_eq!(
+                Proof::from_hex("zz", &group),
+                Err(Error::InvalidSerialization)
+            );
+        }
+    }
+}
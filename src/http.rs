@@ -0,0 +1,237 @@
+//! Verification of proofs over HTTP with a JSON body, independent of the
+//! server framework: the server hands the method, content type and body of
+//! the request to `VerifyHandler::handle` and sends back the response it
+//! returns. The request is a POST of
+//!
+//! ```text
+//! {"y1": <point>, "y2": <point>, "proof": <proof>}
+//! ```
+//!
+//! with the points and the proof in the JSON representation of the library
+//! (base64 fields), and the response is `{"valid": <bool>}` with the status
+//! 200 whatever the decision, or `{"error": <message>}` with a 4xx status
+//! for requests that can't be verified and a 5xx one when the verification
+//! failed on the side of the server.
+use serde::{Deserialize, Serialize};
+
+use crate::{Error, Group, Point, Proof};
+
+/// Default of `VerifyHandler::max_body_size`, enough for the proofs of the
+/// largest groups with their public values.
+pub const DEFAULT_MAX_BODY_SIZE: usize = 64 * 1024;
+
+/// Response of `VerifyHandler::handle`, in JSON.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct HttpResponse {
+    pub status: u16,
+    pub content_type: &'static str,
+    pub body: Vec<u8>,
+}
+
+impl HttpResponse {
+    fn json<T: Serialize>(status: u16, value: &T) -> HttpResponse {
+        HttpResponse {
+            status,
+            content_type: "application/json",
+            body: serde_json::to_vec(value).expect("The response can't be encoded"),
+        }
+    }
+
+    fn error(status: u16, message: &str) -> HttpResponse {
+        HttpResponse::json(status, &ErrorBody { error: message })
+    }
+}
+
+#[derive(Deserialize)]
+#[serde(deny_unknown_fields)]
+struct VerifyRequest {
+    y1: Point,
+    y2: Point,
+    proof: Proof,
+}
+
+#[derive(Serialize)]
+struct VerifyBody {
+    valid: bool,
+}
+
+#[derive(Serialize)]
+struct ErrorBody<'a> {
+    error: &'a str,
+}
+
+/// Handler of the verification requests of a group, see the module
+/// documentation.
+#[derive(Debug, Clone)]
+pub struct VerifyHandler {
+    group: Group,
+    max_body_size: usize,
+}
+
+impl Group {
+    /// Returns a handler verifying the proofs of the group sent over HTTP,
+    /// with a body limit of `DEFAULT_MAX_BODY_SIZE`.
+    pub fn verify_handler(self: &Self) -> VerifyHandler {
+        VerifyHandler {
+            group: self.clone(),
+            max_body_size: DEFAULT_MAX_BODY_SIZE,
+        }
+    }
+}
+
+impl VerifyHandler {
+    /// Sets the largest body accepted, larger ones get the status 413. The
+    /// server should stop reading the body past this size as well.
+    pub fn with_max_body_size(mut self: Self, max_body_size: usize) -> VerifyHandler {
+        self.max_body_size = max_body_size;
+        self
+    }
+
+    pub fn max_body_size(self: &Self) -> usize {
+        self.max_body_size
+    }
+
+    /// Handles a request: 405 if it is not a POST, 415 if the content type is
+    /// not JSON, 413 if the body is too large, 400 if it is malformed or
+    /// holds points of another group, and 200 with the decision otherwise.
+    /// A verification that timed out (see `Group::set_operation_timeout`)
+    /// gets 503 so that the client retries later, and the other failures of
+    /// the server 500.
+    pub fn handle(
+        self: &Self,
+        method: &str,
+        content_type: Option<&str>,
+        body: &[u8],
+    ) -> HttpResponse {
+        if method != "POST" {
+            return HttpResponse::error(405, "only POST is allowed");
+        }
+        // parameters like the charset may follow the media type
+        let media_type = content_type.and_then(|value| value.split(';').next());
+        if media_type.map(str::trim) != Some("application/json") {
+            return HttpResponse::error(415, "the content type must be application/json");
+        }
+        if body.len() > self.max_body_size {
+            return HttpResponse::error(413, "the body is too large");
+        }
+
+        let request: VerifyRequest = match serde_json::from_slice(body) {
+            Ok(request) => request,
+            Err(_) => return HttpResponse::error(400, "malformed request"),
+        };
+        if !self.group.contains(&request.y1) || !self.group.contains(&request.y2) {
+            return HttpResponse::error(400, "the public values are not elements of the group");
+        }
+        match self
+            .group
+            .verify_proof(&request.y1, &request.y2, &request.proof)
+        {
+            Ok(valid) => HttpResponse::json(200, &VerifyBody { valid }),
+            Err(error) => match error_status(error) {
+                500 => {
+                    log::warn!("verification failed: {}", error);
+                    HttpResponse::error(500, "internal error")
+                }
+                status => HttpResponse::error(status, &error.to_string()),
+            },
+        }
+    }
+}
+
+/// Status of the response to a verification that returned `error`.
+fn error_status(error: Error) -> u16 {
+    match error {
+        Error::InvalidArguments
+        | Error::InvalidSerialization
+        | Error::InvalidPoint
+        | Error::InvalidProof
+        | Error::UnsupportedVersion
+        | Error::GroupMismatch
+        | Error::SizeLimitExceeded => 400,
+        Error::Timeout => 503,
+        _ => 500,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::Operation;
+    use std::time::Duration;
+
+    const JSON: Option<&str> = Some("application/json");
+
+    fn request(y1: &Point, y2: &Point, proof: &Proof) -> Vec<u8> {
+        let value = serde_json::json!({ "y1": y1, "y2": y2, "proof": proof });
+        serde_json::to_vec(&value).unwrap()
+    }
+
+    #[test]
+    fn test_verify_handler() {
+        let group = Group::EllipticCurve;
+        let handler = group.verify_handler();
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+
+        let response = handler.handle("POST", JSON, &request(&y1, &y2, &proof));
+        assert_eq!(response.status, 200);
+        assert_eq!(response.content_type, "application/json");
+        assert_eq!(response.body, br#"{"valid":true}"#);
+
+        let mut tampered = proof.clone();
+        tampered.s += 1u32;
+        let response = handler.handle("POST", JSON, &request(&y1, &y2, &tampered));
+        assert_eq!(
+            (response.status, &response.body[..]),
+            (200, &br#"{"valid":false}"#[..])
+        );
+
+        let charset = Some("application/json; charset=utf-8");
+        let response = handler.handle("POST", charset, &request(&y1, &y2, &proof));
+        assert_eq!(response.status, 200);
+    }
+
+    #[test]
+    fn test_verify_handler_invalid_requests() {
+        let group = Group::Scalar;
+        let handler = group.verify_handler().with_max_body_size(4096);
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        let body = request(&y1, &y2, &proof);
+
+        assert_eq!(handler.handle("GET", JSON, &body).status, 405);
+        assert_eq!(handler.handle("POST", None, &body).status, 415);
+        assert_eq!(
+            handler.handle("POST", Some("text/plain"), &body).status,
+            415
+        );
+        assert_eq!(handler.handle("POST", JSON, &[b' '; 4097]).status, 413);
+        assert_eq!(handler.handle("POST", JSON, b"{}").status, 400);
+        assert_eq!(
+            handler.handle("POST", JSON, &body[..body.len() - 1]).status,
+            400
+        );
+
+        // public values of another group
+        let (_, y1, y2) = Group::EllipticCurve.generate_key().unwrap();
+        let response = handler.handle("POST", JSON, &request(&y1, &y2, &proof));
+        assert_eq!(response.status, 400);
+        assert!(String::from_utf8(response.body).unwrap().contains("error"));
+    }
+
+    #[test]
+    fn test_verify_handler_server_errors() {
+        let mut group = Group::Scalar;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        group.set_operation_timeout(Operation::Verify, Duration::from_nanos(1));
+        let response = group
+            .verify_handler()
+            .handle("POST", JSON, &request(&y1, &y2, &proof));
+        assert_eq!(response.status, 503);
+
+        assert_eq!(error_status(Error::InvalidPoint), 400);
+        assert_eq!(error_status(Error::CrossCheckFailed), 500);
+        assert_eq!(error_status(Error::RandomnessFailure), 500);
+    }
+}
@@ -0,0 +1,111 @@
+//! Structure of serialized proofs for debugging tools, read without the group
+//! of the proof and without parsing the numbers themselves.
+use crate::{
+    check_serialized_size, interop, read_length_prefixed, Error, Proof, ProofHeader,
+    INTEROP_VERSION, PROOF_VERSION,
+};
+
+/// Layout of a proof serialized with `Proof::serialize`, see `Proof::inspect`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ProofInfo {
+    /// Version, timestamp and group fingerprint of the header.
+    pub header: ProofHeader,
+    /// Lengths in bytes of the serialized `r1`, `r2`, `c` and `s`.
+    pub r1_len: usize,
+    pub r2_len: usize,
+    pub c_len: usize,
+    pub s_len: usize,
+    /// Whether the proof is in the current version of the native format, the
+    /// two points have the same length, and so do `c` and `s`, and nothing
+    /// follows the proof. The lengths themselves depend on the group, use
+    /// `Proof::is_canonical` to check them as well.
+    pub canonical: bool,
+}
+
+impl Proof {
+    /// Reads the layout of the serialized proof `v` without deserializing it,
+    /// so it needs no group, e.g. to dump the proofs found in the field. The
+    /// versions read by `upgrade_encoding` are accepted as well. Truncated
+    /// inputs and unknown versions return the errors of `deserialize`.
+    /// Trailing bytes after a proof of the native format don't and only clear
+    /// the canonical flag.
+    pub fn inspect(v: &[u8]) -> Result<ProofInfo, Error> {
+        check_serialized_size(v.len())?;
+        if interop::is_interop(v) {
+            let (version, [r1, r2, c, s]) = interop::read_interop(v)?;
+            debug_assert_eq!(version, INTEROP_VERSION);
+            let header = ProofHeader {
+                version,
+                ..Default::default()
+            };
+            return Ok(ProofInfo::new(header, [r1, r2, c, s], true));
+        }
+
+        let mut data = v;
+        let header = ProofHeader::deserialize(&mut data)?;
+        let r1 = read_length_prefixed(&mut data)?;
+        let r2 = read_length_prefixed(&mut data)?;
+        let c = read_length_prefixed(&mut data)?;
+        let s = read_length_prefixed(&mut data)?;
+        Ok(ProofInfo::new(header, [r1, r2, c, s], data.is_empty()))
+    }
+}
+
+impl ProofInfo {
+    /// `complete` tells if nothing follows the proof.
+    fn new(header: ProofHeader, [r1, r2, c, s]: [&[u8]; 4], complete: bool) -> ProofInfo {
+        let current = header.version == PROOF_VERSION;
+        ProofInfo {
+            header,
+            r1_len: r1.len(),
+            r2_len: r2.len(),
+            c_len: c.len(),
+            s_len: s.len(),
+            canonical: current && r1.len() == r2.len() && c.len() == s.len() && complete,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{Group, ProofFormat};
+    use std::time::{Duration, UNIX_EPOCH};
+
+    #[test]
+    fn test_inspect_proof() {
+        let group = Group::EllipticCurve;
+        let (x, _, _) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+
+        let info = Proof::inspect(&proof.serialize(&group)).unwrap();
+        assert_eq!(info.header, ProofHeader::default());
+        assert_eq!((info.r1_len, info.r2_len), (64, 64));
+        assert_eq!((info.c_len, info.s_len), (32, 32));
+        assert!(info.canonical);
+
+        let created_at = UNIX_EPOCH + Duration::from_secs(1_700_000_000);
+        let info = Proof::inspect(&proof.serialize_with_timestamp(&group, created_at)).unwrap();
+        assert_eq!(info.header.created_at, Some(created_at));
+        let info = Proof::inspect(&proof.serialize_with_group(&group)).unwrap();
+        assert_eq!(info.header.group, Some(group.fingerprint()));
+
+        let v = proof.serialize_format(ProofFormat::Interop, &group);
+        let interop = Proof::inspect(&v).unwrap();
+        assert_eq!(interop.header.version, INTEROP_VERSION);
+        assert_eq!(interop.c_len, proof.c.to_bytes_be().len());
+        assert!(!interop.canonical);
+
+        let mut longer = proof.serialize(&group);
+        longer.push(0);
+        assert!(!Proof::inspect(&longer).unwrap().canonical);
+
+        let v = proof.serialize(&group);
+        for len in 0..v.len() {
+            assert!(Proof::inspect(&v[..len]).is_err());
+        }
+        let mut version = v.clone();
+        version[0] += 1;
+        assert_eq!(Proof::inspect(&version), Err(Error::UnsupportedVersion));
+    }
+}
@@ -0,0 +1,186 @@
+//! A documented encoding of the proofs for implementations in other
+//! languages, selected with `ProofFormat::Interop`:
+//!
+//! ```text
+//! magic    4 bytes   "CPZK"
+//! version  1 byte    INTEROP_VERSION
+//! r1       TLV       tag 0x01
+//! r2       TLV       tag 0x02
+//! c        TLV       tag 0x03
+//! s        TLV       tag 0x04
+//! ```
+//!
+//! Every TLV is a tag byte, the length of the value as 4 big-endian bytes and
+//! the value. The fields come in the order of their tags, exactly once. The
+//! points are encoded like `Point::serialize`: the big-endian number for
+//! integer groups, and for secp256k1 the big-endian coordinates `x` then `y`
+//! padded with leading zeros to the length of the longest. `c` and `s` are
+//! big-endian numbers without leading zeros.
+//!
+//! The native format is the canonical one, so `Proof::deserialize` only reads
+//! that one: proofs in this format are read with `Proof::deserialize_format`
+//! or converted with `Proof::upgrade_encoding`. Timestamps and group
+//! fingerprints only exist in the native format.
+use crate::{
+    check_serialized_size, read_length_prefixed, write_length_prefixed, Error, Group, Proof,
+};
+
+/// First bytes of the proofs encoded in `ProofFormat::Interop`.
+pub const INTEROP_MAGIC: &[u8; 4] = b"CPZK";
+
+/// Version of `ProofFormat::Interop`, which has its own numbering.
+pub const INTEROP_VERSION: u8 = 1;
+
+/// Tags of the fields `r1`, `r2`, `c` and `s`.
+const INTEROP_TAGS: [u8; 4] = [0x01, 0x02, 0x03, 0x04];
+
+/// Encodings of `Proof::serialize_format`.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum ProofFormat {
+    /// The canonical encoding of `Proof::serialize`.
+    #[default]
+    Native,
+    /// The labeled encoding documented in this module.
+    Interop,
+}
+
+impl Proof {
+    /// Serializes the proof of `group` in `format`, read back with
+    /// `deserialize_format`.
+    pub fn serialize_format(self: &Self, format: ProofFormat, group: &Group) -> Vec<u8> {
+        match format {
+            ProofFormat::Native => self.serialize(group),
+            ProofFormat::Interop => {
+                let mut v = INTEROP_MAGIC.to_vec();
+                v.push(INTEROP_VERSION);
+                let fields = [
+                    self.r1.serialize(),
+                    self.r2.serialize(),
+                    self.c.to_bytes_be(),
+                    self.s.to_bytes_be(),
+                ];
+                for (tag, field) in INTEROP_TAGS.iter().zip(fields) {
+                    v.push(*tag);
+                    write_length_prefixed(&mut v, &field);
+                }
+                v
+            }
+        }
+    }
+
+    /// Deserializes a proof of `group` serialized in `format`. The native
+    /// format is read like `deserialize`, and only the encoding documented in
+    /// this module is accepted for the interop one.
+    pub fn deserialize_format(
+        v: Vec<u8>,
+        format: ProofFormat,
+        group: &Group,
+    ) -> Result<Proof, Error> {
+        match format {
+            ProofFormat::Native => Proof::deserialize(v, group),
+            ProofFormat::Interop => {
+                check_serialized_size(v.len())?;
+                let (_, fields) = read_interop(&v)?;
+                let mut compact = Vec::new();
+                for field in fields {
+                    write_length_prefixed(&mut compact, field);
+                }
+                Proof::deserialize_compact(compact, group)
+            }
+        }
+    }
+}
+
+/// Tells if `v` starts like a proof in `ProofFormat::Interop`.
+pub(crate) fn is_interop(v: &[u8]) -> bool {
+    v.starts_with(INTEROP_MAGIC)
+}
+
+/// Reads a proof in `ProofFormat::Interop`, returning its version and the
+/// bytes of its fields. The proof must be the whole of `v`.
+pub(crate) fn read_interop(v: &[u8]) -> Result<(u8, [&[u8]; 4]), Error> {
+    let mut data = v
+        .strip_prefix(INTEROP_MAGIC)
+        .ok_or(Error::InvalidSerialization)?;
+    let (&version, rest) = data.split_first().ok_or(Error::InvalidSerialization)?;
+    if version != INTEROP_VERSION {
+        return Err(Error::UnsupportedVersion);
+    }
+    data = rest;
+
+    let mut fields = [&[][..]; 4];
+    for (tag, field) in INTEROP_TAGS.iter().zip(fields.iter_mut()) {
+        let (&found, rest) = data.split_first().ok_or(Error::InvalidSerialization)?;
+        if found != *tag {
+            return Err(Error::InvalidSerialization);
+        }
+        data = rest;
+        *field = read_length_prefixed(&mut data)?;
+    }
+
+    if !data.is_empty() {
+        return Err(Error::InvalidSerialization);
+    }
+    Ok((version, fields))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_interop_format() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, _, _) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+
+            let native = proof.serialize_format(ProofFormat::Native, &group);
+            assert_eq!(native, proof.serialize(&group));
+            let v = proof.serialize_format(ProofFormat::Interop, &group);
+            assert!(v.starts_with(INTEROP_MAGIC));
+            let read = |v: Vec<u8>| Proof::deserialize_format(v, ProofFormat::Interop, &group);
+            assert_eq!(read(v.clone()), Ok(proof.clone()));
+            assert_eq!(
+                Proof::deserialize_format(native.clone(), ProofFormat::Native, &group),
+                Ok(proof.clone())
+            );
+            assert_eq!(Proof::upgrade_encoding(v.clone(), &group), Ok(native));
+
+            // only read when asked for
+            assert!(!Proof::is_canonical(&v, &group));
+            assert_eq!(
+                Proof::deserialize(v.clone(), &group),
+                Err(Error::UnsupportedVersion)
+            );
+
+            for len in 0..v.len() {
+                assert!(read(v[..len].to_vec()).is_err());
+            }
+            let mut longer = v.clone();
+            longer.push(0);
+            assert!(read(longer).is_err());
+        }
+    }
+
+    #[test]
+    fn test_interop_format_layout() {
+        let group = Group::Scalar;
+        let (x, _, _) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        let v = proof.serialize_format(ProofFormat::Interop, &group);
+        let read = |v: Vec<u8>| Proof::deserialize_format(v, ProofFormat::Interop, &group);
+
+        let (version, fields) = read_interop(&v).unwrap();
+        assert_eq!(version, INTEROP_VERSION);
+        assert_eq!(fields[0], &proof.r1.serialize()[..]);
+        assert_eq!(fields[3], &proof.s.to_bytes_be()[..]);
+
+        // fields out of order
+        let mut swapped = v.clone();
+        swapped[5] = 0x02;
+        assert_eq!(read(swapped), Err(Error::InvalidSerialization));
+        let mut version = v;
+        version[4] += 1;
+        assert_eq!(read(version), Err(Error::UnsupportedVersion));
+    }
+}
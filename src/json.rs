@@ -0,0 +1,138 @@
+//! JSON representation of the library types through `serde`. Points are
+//! encoded as the base64 string of their serialized bytes tagged with the
+//! cyclic group they belong to, and numbers as the base64 string of their
+//! big-endian bytes.
+use base64::{engine::general_purpose::STANDARD, Engine as _};
+use num_bigint::BigUint;
+use serde::{de, Deserialize, Deserializer, Serialize, Serializer};
+
+use crate::{check_serialized_size, Point, Proof, Scalar};
+
+#[derive(Serialize, Deserialize)]
+enum PointRepr {
+    Scalar(String),
+    ECPoint(String),
+}
+
+#[derive(Serialize, Deserialize)]
+struct ProofRepr {
+    r1: Point,
+    r2: Point,
+    c: String,
+    s: String,
+}
+
+fn decode<E: de::Error>(s: &str) -> Result<Vec<u8>, E> {
+    check_serialized_size(s.len() / 4 * 3).map_err(E::custom)?;
+    STANDARD.decode(s).map_err(E::custom)
+}
+
+fn decode_number<E: de::Error>(s: &str) -> Result<BigUint, E> {
+    let v = decode::<E>(s)?;
+    if v.is_empty() {
+        return Err(E::custom("empty number"));
+    }
+    Ok(BigUint::from_bytes_be(&v))
+}
+
+impl Serialize for Point {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        let encoded = STANDARD.encode(Point::serialize(self));
+        match self {
+            Point::Scalar(_) => PointRepr::Scalar(encoded),
+            Point::ECPoint(..) => PointRepr::ECPoint(encoded),
+        }
+        .serialize(serializer)
+    }
+}
+
+impl<'de> Deserialize<'de> for Point {
+    fn deserialize<D: Deserializer<'de>>(deserializer: D) -> Result<Self, D::Error> {
+        match PointRepr::deserialize(deserializer)? {
+            PointRepr::Scalar(s) => Point::deserialize_into_scalar(decode(&s)?),
+            PointRepr::ECPoint(s) => Point::deserialize_into_ecpoint(decode(&s)?),
+        }
+        .map_err(de::Error::custom)
+    }
+}
+
+impl Serialize for Proof {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        ProofRepr {
+            r1: self.r1.clone(),
+            r2: self.r2.clone(),
+            c: STANDARD.encode(self.c.to_bytes_be()),
+            s: STANDARD.encode(self.s.to_bytes_be()),
+        }
+        .serialize(serializer)
+    }
+}
+
+impl<'de> Deserialize<'de> for Proof {
+    fn deserialize<D: Deserializer<'de>>(deserializer: D) -> Result<Self, D::Error> {
+        let repr = ProofRepr::deserialize(deserializer)?;
+        Ok(Proof {
+            r1: repr.r1,
+            r2: repr.r2,
+            c: decode_number(&repr.c)?,
+            s: decode_number(&repr.s)?,
+        })
+    }
+}
+
+impl Serialize for Scalar {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        STANDARD
+            .encode(self.value().to_bytes_be())
+            .serialize(serializer)
+    }
+}
+
+impl<'de> Deserialize<'de> for Scalar {
+    fn deserialize<D: Deserializer<'de>>(deserializer: D) -> Result<Self, D::Error> {
+        let s = String::deserialize(deserializer)?;
+        Ok(Scalar::from_value(decode_number(&s)?))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::Group;
+
+    #[test]
+    fn test_point_json() {
+        let p = Point::Scalar(BigUint::from(65256u32));
+        let json = serde_json::to_string(&p).unwrap();
+        assert_eq!(json, r#"{"Scalar":"/ug="}"#);
+        assert_eq!(serde_json::from_str::<Point>(&json).unwrap(), p);
+
+        let p = Point::ECPoint(BigUint::from(65256u32), BigUint::from(8475u32));
+        let json = serde_json::to_string(&p).unwrap();
+        assert_eq!(json, r#"{"ECPoint":"/ughGw=="}"#);
+        assert_eq!(serde_json::from_str::<Point>(&json).unwrap(), p);
+
+        assert!(serde_json::from_str::<Point>(r#"{"ECPoint":"/ugh"}"#).is_err());
+        assert!(serde_json::from_str::<Point>(r#"{"Scalar":""}"#).is_err());
+    }
+
+    #[test]
+    fn test_scalar_json() {
+        let scalar = Scalar::new(&BigUint::from(65256u32), &Group::EllipticCurve);
+        let json = serde_json::to_string(&scalar).unwrap();
+        assert_eq!(json, r#""/ug=""#);
+        assert_eq!(serde_json::from_str::<Scalar>(&json).unwrap(), scalar);
+    }
+
+    #[test]
+    fn test_proof_json() {
+        let group = Group::Scalar;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+
+        let json = serde_json::to_string(&proof).unwrap();
+        let deserialized: Proof = serde_json::from_str(&json).unwrap();
+        assert_eq!(deserialized, proof);
+        assert!(group.verify_proof(&y1, &y2, &deserialized).unwrap());
+    }
+}
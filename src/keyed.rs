@@ -0,0 +1,117 @@
+//! Proofs sent together with the public key they are made for, so that a
+//! stateless verifier receives a single object. The key is public but links
+//! the proofs of the same prover, so callers that care about privacy send
+//! the plain proofs of `Group::create_proof_with_key` instead.
+use crate::{
+    check_serialized_size, read_length_prefixed, write_length_prefixed, Error, Group, Point,
+    PrivateKey, Proof, PublicKey,
+};
+
+/// A proof and the public key it is made for, see `Group::verify_proof_with_public_key`.
+#[derive(Debug, Clone, PartialEq)]
+pub struct ProofWithKey {
+    pub public_key: PublicKey,
+    pub proof: Proof,
+}
+
+impl ProofWithKey {
+    /// Serializes the ProofWithKey structure of `group` to an array of bytes:
+    /// `y1`, `y2` and the serialized proof, all preceded by their 4-byte
+    /// big-endian length.
+    pub fn serialize(self: &Self, group: &Group) -> Vec<u8> {
+        let mut v = Vec::new();
+        write_length_prefixed(&mut v, &self.public_key.y1.serialize());
+        write_length_prefixed(&mut v, &self.public_key.y2.serialize());
+        write_length_prefixed(&mut v, &self.proof.serialize(group));
+        v
+    }
+
+    /// Deserializes the ProofWithKey structure from an array of bytes. Empty,
+    /// truncated or oversized inputs return an error, and so do public values
+    /// that aren't elements of the group.
+    pub fn deserialize(v: Vec<u8>, group: &Group) -> Result<ProofWithKey, Error> {
+        check_serialized_size(v.len())?;
+        let mut data = &v[..];
+
+        let y1 = Point::deserialize(read_length_prefixed(&mut data)?.to_vec(), group)?;
+        let y2 = Point::deserialize(read_length_prefixed(&mut data)?.to_vec(), group)?;
+        let proof = Proof::deserialize(read_length_prefixed(&mut data)?.to_vec(), group)?;
+
+        if !data.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+
+        Ok(ProofWithKey {
+            public_key: PublicKey { y1, y2 },
+            proof,
+        })
+    }
+}
+
+impl Group {
+    /// Same as `create_proof_with_key` but the public key of `key` is sent
+    /// along with the proof.
+    pub fn create_proof_with_public_key(
+        self: &Self,
+        key: &PrivateKey,
+    ) -> Result<ProofWithKey, Error> {
+        Ok(ProofWithKey {
+            public_key: key.public_key(self)?,
+            proof: self.create_proof_with_key(key)?,
+        })
+    }
+
+    /// Verifies the proof for the public key sent with it. A valid proof only
+    /// shows that the sender knows the secret of that key: the verifier must
+    /// still check that it is a key it trusts, e.g. one that was registered.
+    pub fn verify_proof_with_public_key(self: &Self, proof: &ProofWithKey) -> Result<bool, Error> {
+        self.verify_proof_with_key(&proof.public_key, &proof.proof)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use num_bigint::BigUint;
+
+    #[test]
+    fn test_proof_with_public_key() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let key = group.generate_private_key().unwrap();
+            let proof = group.create_proof_with_public_key(&key).unwrap();
+            assert_eq!(proof.public_key, key.public_key(&group).unwrap());
+            assert!(group.verify_proof_with_public_key(&proof).unwrap());
+
+            let v = proof.serialize(&group);
+            let read = ProofWithKey::deserialize(v.clone(), &group).unwrap();
+            assert_eq!(read, proof);
+            assert!(group.verify_proof_with_public_key(&read).unwrap());
+            for len in 0..v.len() {
+                assert!(ProofWithKey::deserialize(v[..len].to_vec(), &group).is_err());
+            }
+        }
+    }
+
+    #[test]
+    fn test_proof_with_other_public_key() {
+        let group = Group::EllipticCurve;
+        let key = group.generate_private_key().unwrap();
+        let mut proof = group.create_proof_with_public_key(&key).unwrap();
+        let other = group.generate_private_key().unwrap();
+        proof.public_key = other.public_key(&group).unwrap();
+        assert!(!group.verify_proof_with_public_key(&proof).unwrap());
+
+        // y1 replaced by a number of the integer group: a single byte is an
+        // unknown SEC 1 tag, two bytes a point outside the curve
+        let rest = &proof.serialize(&group)[proof.public_key.y1.serialize().len() + 4..];
+        for (y1, err) in [
+            (4u32, Error::InvalidSerialization),
+            (1000, Error::InvalidPoint),
+        ] {
+            let mut v = Vec::new();
+            write_length_prefixed(&mut v, &Point::Scalar(BigUint::from(y1)).serialize());
+            v.extend(rest);
+            assert_eq!(ProofWithKey::deserialize(v, &group), Err(err));
+        }
+    }
+}
@@ -0,0 +1,243 @@
+//! Secret and public values kept together, so that callers can't mix up the
+//! elements of the tuples returned by `Group::generate_key`, and distinct
+//! types for the private and public keys so that the compiler rejects one
+//! where the other is expected.
+use num_bigint::BigUint;
+use std::fmt;
+
+use crate::{get_constants, is_weak_secret, Error, Group, Point, Proof, Scalar};
+
+/// The public values `(y1, y2) = (g^x, h^x)` of a secret `x`.
+#[derive(Debug, Clone, PartialEq)]
+pub struct PublicKey {
+    pub y1: Point,
+    pub y2: Point,
+}
+
+/// A secret `x` of a group, overwritten with zeros when dropped and left out
+/// of the `Debug` output.
+#[derive(Clone)]
+pub struct PrivateKey(Scalar);
+
+impl PrivateKey {
+    /// Wraps the secret `x` of `group`. Returns `Error::InvalidSecret` unless
+    /// `1 < x < q`, as the public values of 0 and 1 give them away.
+    pub fn new(x: BigUint, group: &Group) -> Result<PrivateKey, Error> {
+        let (_, q, _, _) = get_constants(group);
+        if is_weak_secret(&x) || x >= q {
+            return Err(Error::InvalidSecret);
+        }
+        Ok(PrivateKey(Scalar::from_value(x)))
+    }
+
+    pub fn secret(self: &Self) -> &Scalar {
+        &self.0
+    }
+
+    /// Computes the PublicKey of the secret in `group`.
+    pub fn public_key(self: &Self, group: &Group) -> Result<PublicKey, Error> {
+        let (y1, y2) = group.public_key(self.0.value())?;
+        Ok(PublicKey { y1, y2 })
+    }
+}
+
+impl fmt::Debug for PrivateKey {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_struct("PrivateKey").finish_non_exhaustive()
+    }
+}
+
+/// A secret `x` with its public values `(y1, y2) = (g^x, h^x)` and the group
+/// they belong to. The secret is overwritten with zeros when the KeyPair is
+/// dropped and is left out of the `Debug` output.
+#[derive(Clone)]
+pub struct KeyPair {
+    group: Group,
+    secret: Scalar,
+    pub y1: Point,
+    pub y2: Point,
+}
+
+impl KeyPair {
+    pub fn group(self: &Self) -> &Group {
+        &self.group
+    }
+
+    pub fn secret(self: &Self) -> &Scalar {
+        &self.secret
+    }
+
+    /// Returns the public values `(y1, y2)` to register with the verifier.
+    pub fn public_key(self: &Self) -> (&Point, &Point) {
+        (&self.y1, &self.y2)
+    }
+
+    /// Same as `Group::create_proof` with the secret of the KeyPair.
+    pub fn create_proof(self: &Self) -> Result<Proof, Error> {
+        self.group.create_proof(self.secret.value())
+    }
+
+    pub fn private_key(self: &Self) -> PrivateKey {
+        PrivateKey(self.secret.clone())
+    }
+
+    /// Returns the KeyPair as the tuple `(x, y1, y2)` of `Group::generate_key`,
+    /// for code still using it. The secret is moved out and isn't wiped
+    /// anymore: `zeroize` it once done.
+    pub fn unpack(self: Self) -> (BigUint, Point, Point) {
+        let KeyPair { secret, y1, y2, .. } = self;
+        (secret.into_value(), y1, y2)
+    }
+
+    pub fn to_public_key(self: &Self) -> PublicKey {
+        PublicKey {
+            y1: self.y1.clone(),
+            y2: self.y2.clone(),
+        }
+    }
+}
+
+impl fmt::Debug for KeyPair {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_struct("KeyPair")
+            .field("group", &self.group)
+            .field("y1", &self.y1)
+            .field("y2", &self.y2)
+            .finish_non_exhaustive()
+    }
+}
+
+impl Point {
+    /// Tells if the point, e.g. an imported public value, is the public value
+    /// of a weak secret: the identity for the secrets 0 and `q`, or one of the
+    /// generators for the secret 1. `Group::generate_key` never returns them.
+    /// Returns `Error::InvalidPoint` for other points that aren't elements of
+    /// the group.
+    pub fn is_weak_key(self: &Self, group: &Group) -> Result<bool, Error> {
+        if *self == group.identity() {
+            return Ok(true);
+        }
+        if !group.contains(self) {
+            return Err(Error::InvalidPoint);
+        }
+        let (_, _, g, h) = get_constants(group);
+        Ok(*self == g || *self == h)
+    }
+}
+
+impl Group {
+    /// Generates a random KeyPair. Preferred over `generate_key`, whose
+    /// tuples are easy to unpack in the wrong order.
+    pub fn generate_key_pair(self: &Self) -> Result<KeyPair, Error> {
+        let (x, y1, y2) = self.generate_key()?;
+        Ok(KeyPair {
+            group: self.clone(),
+            secret: Scalar::from_value(x),
+            y1,
+            y2,
+        })
+    }
+
+    /// Generates a random PrivateKey, see `PrivateKey::public_key` for its
+    /// public values.
+    pub fn generate_private_key(self: &Self) -> Result<PrivateKey, Error> {
+        let (x, _, _) = self.generate_key()?;
+        PrivateKey::new(x, self)
+    }
+
+    /// Same as `create_proof` with the secret of `key`.
+    pub fn create_proof_with_key(self: &Self, key: &PrivateKey) -> Result<Proof, Error> {
+        self.create_proof(key.secret().value())
+    }
+
+    /// Same as `verify_proof` with the public values of `key`.
+    pub fn verify_proof_with_key(
+        self: &Self,
+        key: &PublicKey,
+        proof: &Proof,
+    ) -> Result<bool, Error> {
+        self.verify_proof(&key.y1, &key.y2, proof)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{exponentiates_points, get_constants};
+    use num::traits::{One, Zero};
+
+    #[test]
+    fn test_key_pair() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let key_pair = group.generate_key_pair().unwrap();
+
+            let (p, _, g, h) = get_constants(&group);
+            let (y1, y2) = key_pair.public_key();
+            let expected = exponentiates_points(key_pair.secret().value(), &g, &h, &p).unwrap();
+            assert_eq!((y1, y2), (&expected.0, &expected.1));
+
+            let proof = key_pair.create_proof().unwrap();
+            assert!(group.verify_proof(y1, y2, &proof).unwrap());
+
+            let debug = format!("{:?}", key_pair);
+            assert!(debug.starts_with("KeyPair {") && !debug.contains("secret"));
+
+            let x = key_pair.secret().value().clone();
+            let public_values = (y1.clone(), y2.clone());
+            let (unpacked, y1, y2) = key_pair.unpack();
+            assert_eq!((unpacked, (y1, y2)), (x, public_values));
+        }
+    }
+
+    #[test]
+    fn test_private_and_public_keys() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let private_key = group.generate_private_key().unwrap();
+            let public_key = private_key.public_key(&group).unwrap();
+
+            let proof = group.create_proof_with_key(&private_key).unwrap();
+            assert!(group.verify_proof_with_key(&public_key, &proof).unwrap());
+            assert!(group
+                .verify_proof(&public_key.y1, &public_key.y2, &proof)
+                .unwrap());
+
+            let key_pair = group.generate_key_pair().unwrap();
+            let private_key = key_pair.private_key();
+            assert_eq!(
+                private_key.public_key(&group).unwrap(),
+                key_pair.to_public_key()
+            );
+            assert_eq!(format!("{:?}", private_key), "PrivateKey { .. }");
+
+            let (_, q, _, _) = get_constants(&group);
+            assert!(matches!(
+                PrivateKey::new(BigUint::zero(), &group),
+                Err(Error::InvalidSecret)
+            ));
+            assert!(matches!(
+                PrivateKey::new(BigUint::one(), &group),
+                Err(Error::InvalidSecret)
+            ));
+            assert!(matches!(
+                PrivateKey::new(q, &group),
+                Err(Error::InvalidSecret)
+            ));
+        }
+    }
+
+    #[test]
+    fn test_weak_keys() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (_, _, g, h) = get_constants(&group);
+            for point in [group.identity(), g, h] {
+                assert_eq!(point.is_weak_key(&group), Ok(true));
+            }
+        }
+
+        let group = Group::EllipticCurve;
+        let (_, y1, y2) = group.generate_key().unwrap();
+        assert_eq!(y1.is_weak_key(&group), Ok(false));
+        assert_eq!(y2.is_weak_key(&group), Ok(false));
+        assert_eq!(y1.is_weak_key(&Group::Scalar), Err(Error::InvalidPoint));
+    }
+}
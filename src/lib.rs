@@ -1,23 +1,277 @@
+mod aggregate;
+mod arithmetic;
+mod assertion;
+mod audit;
+mod auth;
+mod choice;
+mod conjunction;
+mod dleq;
+mod encoding;
+mod http;
+mod inspect;
+mod interop;
+mod json;
+mod keyed;
+mod keypair;
+mod merkle;
+mod metrics;
+mod multi_group;
+mod pem;
+mod pool;
+mod prime;
+mod proto;
+mod reference;
+mod reuse;
+mod rfc3526;
+mod ring;
+mod rng;
+mod scalar;
 mod secp256k1;
+mod session;
+mod shard;
+mod signer;
+mod store;
+mod stream;
+mod timeout;
+mod transcript;
+mod verifier;
 
-use num::traits::One;
+use num::traits::{One, Zero};
 use num_bigint::BigUint;
-use rand::{thread_rng, distributions::Alphanumeric, Rng};
+use rand::{distributions::Alphanumeric, CryptoRng, Rng, RngCore};
+use rng::DefaultRng;
 use secp256k1::Secp256k1Point;
+use sha2::{Digest, Sha256, Sha512};
+use sha3::Sha3_256;
+use std::cell::RefCell;
+use std::collections::HashMap;
+use std::fmt;
+use std::sync::atomic::{AtomicBool, AtomicUsize, Ordering};
+use std::sync::{mpsc, Arc, Mutex, OnceLock};
+use std::time::{Duration, Instant, SystemTime, UNIX_EPOCH};
+use zeroize::Zeroize;
+
+pub use aggregate::{AggregateProof, AggregateVerifier};
+pub use assertion::Assertion;
+pub use audit::{dropped_audit_records, remove_audit_sink, set_audit_sink, AUDIT_BUFFER};
+pub use auth::{AuthLimits, Authenticator, Sweeper};
+pub use choice::Choice;
+pub use conjunction::ConjunctiveProof;
+pub use http::{HttpResponse, VerifyHandler, DEFAULT_MAX_BODY_SIZE};
+pub use inspect::ProofInfo;
+pub use interop::{ProofFormat, INTEROP_MAGIC, INTEROP_VERSION};
+pub use keyed::ProofWithKey;
+pub use keypair::{KeyPair, PrivateKey, PublicKey};
+pub use merkle::{merkle_path, merkle_root, MerklePath};
+pub use metrics::{metrics, Metrics};
+pub use multi_group::MultiGroupVerifier;
+pub use pem::{decode_pem, encode_pem, PRIVATE_KEY_PEM_LABEL, PUBLIC_KEY_PEM_LABEL};
+pub use pool::{GroupPool, DEFAULT_MAX_POOLED_GROUPS};
+pub use proto::pb;
+pub use rfc3526::GroupId;
+pub use ring::RingProof;
+pub use rng::{reset_default_rng, set_default_rng};
+pub use scalar::Scalar;
+pub use session::{ProofSession, SESSION_STEP_BITS};
+pub use shard::{combine_partials, PartialResult};
+pub use signer::{LocalSigner, Signer};
+pub use store::{MemoryStore, PendingChallenge, Store};
+pub use stream::{PointReader, ProofReader, StreamResult, StreamShutdown};
+pub use timeout::Operation;
+pub use transcript::Transcript;
+pub use verifier::{PrecomputedKey, SingleKeyVerifier, Verifier, VerifierGroup};
+
+/// Smallest size in bits of the modulus of the groups created by
+/// `Group::generate_params`.
+pub const MIN_GENERATED_GROUP_BITS: usize = 2048;
+
+/// Smallest length in bits of the challenges of
+/// `Group::create_proof_with_challenge_bits`, a forgery succeeding with
+/// probability `2^-80`.
+pub const MIN_CHALLENGE_BITS: usize = 80;
+
+/// Number of hashes of the challenge of `create_proof`, see
+/// `ChallengeHash::Sha256Iterated`.
+pub const DEFAULT_HASH_ITERATIONS: u32 = 1;
+
+/// Largest number of hashes of `ChallengeHash::Sha256Iterated`, so that a
+/// verifier can't be made to hash for too long.
+pub const MAX_HASH_ITERATIONS: u32 = 1 << 16;
+
+/// Default of `max_serialized_size`.
+pub const DEFAULT_MAX_SERIALIZED_SIZE: usize = 1 << 20;
+
+static MAX_SERIALIZED_SIZE: AtomicUsize = AtomicUsize::new(DEFAULT_MAX_SERIALIZED_SIZE);
 
 /// The possible kind of errors returned by this library.
-#[derive(Debug)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
 pub enum Error {
     InvalidArguments,
+    InvalidSerialization,
+    InvalidSeed,
+    LengthMismatch,
+    InvalidGroupParameters,
+    UnknownGroup,
+    InvalidSecret,
+    UnknownUser,
+    UnknownChallenge,
+    InvalidPoint,
+    RandomnessFailure,
+    InvalidKeyCount,
+    UnsupportedVersion,
+    Cancelled,
+    MissingTimestamp,
+    Expired,
+    SelfTestFailed,
+    Unsupported,
+    Timeout,
+    CrossCheckFailed,
+    InsufficientEntropy,
+    TooManyChallenges,
+    SizeLimitExceeded,
+    StoreFailure,
+    GroupMismatch,
+    ProofNotReady,
+    NotPrime,
+    BadOrder,
+    BadGenerator,
+    SameGenerators,
+    InvalidProof,
+    CommitmentReuse,
+    IncompleteShards,
+    ChallengeMismatch,
+}
+
+impl fmt::Display for Error {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Error::InvalidArguments => write!(f, "points don't belong to the same cyclic group"),
+            Error::InvalidSerialization => write!(f, "malformed serialized data"),
+            Error::InvalidSeed => write!(f, "the seed should be at least 16 bytes long"),
+            Error::LengthMismatch => write!(f, "the number of public values and proofs differ"),
+            Error::InvalidGroupParameters => write!(f, "invalid cyclic group parameters"),
+            Error::UnknownGroup => write!(f, "unknown cyclic group"),
+            Error::InvalidSecret => write!(f, "the secret is out of the range of the group order"),
+            Error::UnknownUser => write!(f, "the user is not registered"),
+            Error::UnknownChallenge => write!(f, "no pending challenge with this identifier"),
+            Error::InvalidPoint => write!(f, "the point is not an element of the cyclic group"),
+            Error::RandomnessFailure => write!(f, "the random number generator failed"),
+            Error::InvalidKeyCount => write!(f, "the number of keys should be positive"),
+            Error::UnsupportedVersion => write!(f, "unsupported version of the proof format"),
+            Error::Cancelled => write!(f, "the operation was cancelled"),
+            Error::MissingTimestamp => write!(f, "the proof has no creation timestamp"),
+            Error::Expired => write!(f, "the proof is older than the maximum age allowed"),
+            Error::SelfTestFailed => write!(f, "the self-test of the group failed"),
+            Error::Unsupported => write!(f, "the operation is not supported"),
+            Error::Timeout => write!(f, "the operation took longer than allowed"),
+            Error::CrossCheckFailed => {
+                write!(f, "the reference implementation disagrees with the result")
+            }
+            Error::InsufficientEntropy => {
+                write!(f, "the random number generator of the system is not ready")
+            }
+            Error::TooManyChallenges => write!(f, "too many challenges are outstanding"),
+            Error::SizeLimitExceeded => write!(f, "the serialized data is larger than allowed"),
+            Error::StoreFailure => write!(f, "the storage backend of the authenticator failed"),
+            Error::GroupMismatch => write!(f, "the proof was created in another cyclic group"),
+            Error::ProofNotReady => write!(f, "the proof session has not finished yet"),
+            Error::NotPrime => write!(f, "the modulus of the group is not prime"),
+            Error::BadOrder => write!(f, "the order of the group is not a prime dividing p - 1"),
+            Error::BadGenerator => write!(f, "a generator is not an element of order q"),
+            Error::SameGenerators => write!(f, "the generators of the group are equal"),
+            Error::InvalidProof => write!(f, "the proof is not valid"),
+            Error::CommitmentReuse => write!(f, "the commitment was already used"),
+            Error::IncompleteShards => write!(f, "the partial results don't cover every shard"),
+            Error::ChallengeMismatch => {
+                write!(f, "the proof doesn't answer the commitment and challenge")
+            }
+        }
+    }
+}
+
+impl std::error::Error for Error {}
+
+/// A value use to select from the beginning of the program execution which
+/// cyclic group is going to be used: `Group::Scalar`, `Group::EllipticCurve`
+/// or `Group::Custom` with the parameters of an integer group. Its kind is
+/// matched on with `Group::kind`.
+///
+/// A group holds no interior mutable state, so it is `Send` and `Sync` and a
+/// single instance can be shared between threads (e.g. behind an `Arc`) to
+/// generate keys and create or verify proofs concurrently without any
+/// locking. Cloning it copies the group parameters and the timeouts of its
+/// operations (see `Group::set_operation_timeout`).
+#[derive(Debug, Default, Clone)]
+pub struct Group {
+    kind: GroupKind,
+    // timeouts of the operations, indexed by Operation
+    timeouts: [Duration; 3],
 }
 
-/// An enum use to select from the beginning of the program execution which
-/// cyclic group is going to be used.
-#[derive(Debug, Default)]
-pub enum Group {
+/// The kinds of groups, see `Group`.
+#[derive(Debug, Default, Clone)]
+pub enum GroupKind {
+    /// The toy integer group of order 5003 of `get_constants_scalar`, for
+    /// tests and examples only: a proof can be forged by trying challenges.
     #[default]
     Scalar,
     EllipticCurve,
+    Custom(GroupParameters),
+}
+
+#[allow(non_upper_case_globals)]
+impl Group {
+    /// The toy integer group of order 5003 of `get_constants_scalar`, for
+    /// tests and examples only: a proof can be forged by trying challenges.
+    pub const Scalar: Group = Group {
+        kind: GroupKind::Scalar,
+        timeouts: [Duration::ZERO; 3],
+    };
+
+    /// The secp256k1 elliptic curve.
+    pub const EllipticCurve: Group = Group {
+        kind: GroupKind::EllipticCurve,
+        timeouts: [Duration::ZERO; 3],
+    };
+
+    /// The integer group of `params`, not checked: `Group::new_with_params`
+    /// validates them.
+    #[allow(non_snake_case)]
+    pub fn Custom(params: GroupParameters) -> Group {
+        Group {
+            kind: GroupKind::Custom(params),
+            timeouts: [Duration::ZERO; 3],
+        }
+    }
+
+    pub fn kind(self: &Self) -> &GroupKind {
+        &self.kind
+    }
+}
+
+/// Kinds of groups in `Group::serialize`.
+const GROUP_SCALAR: u8 = 0;
+const GROUP_ELLIPTIC_CURVE: u8 = 1;
+const GROUP_CUSTOM: u8 = 2;
+
+/// Parameters of an integer cyclic group: the prime `p` defining the group,
+/// the order `q` of the subgroup used and its elements `g` and `h`.
+#[derive(Debug, Clone, PartialEq)]
+pub struct GroupParameters {
+    pub p: BigUint,
+    pub q: BigUint,
+    pub g: BigUint,
+    pub h: BigUint,
+}
+
+impl fmt::Display for Group {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self.kind() {
+            GroupKind::Scalar => write!(f, "Scalar"),
+            GroupKind::EllipticCurve => write!(f, "secp256k1"),
+            GroupKind::Custom(params) => write!(f, "Custom({}-bit modulus)", params.p.bits()),
+        }
+    }
 }
 
 /// Structure to represent the cyclic group field.
@@ -47,18 +301,24 @@ pub fn parse_group_from_command_line(args: Vec<String>) -> Group {
 ///
 /// * `group` - The cyclic group to use.
 pub fn get_constants(group: &Group) -> (BigUint, BigUint, Point, Point) {
-    match group {
-        Group::Scalar => get_constants_scalar(),
-        Group::EllipticCurve => get_constants_elliptic_curve(),
+    match group.kind() {
+        GroupKind::Scalar => get_constants_scalar(),
+        GroupKind::EllipticCurve => get_constants_elliptic_curve(),
+        GroupKind::Custom(params) => (
+            params.p.clone(),
+            params.q.clone(),
+            Point::Scalar(params.g.clone()),
+            Point::Scalar(params.h.clone()),
+        ),
     }
 }
 
 pub fn get_constants_scalar() -> (BigUint, BigUint, Point, Point) {
     (
-        BigUint::from(10009u32),
-        BigUint::from(5004u32),
+        BigUint::from(10007u32),
+        BigUint::from(5003u32),
         Point::Scalar(BigUint::from(3u32)),
-        Point::Scalar(BigUint::from(2892u32)),
+        Point::Scalar(BigUint::from(3210u32)),
     )
 }
 
@@ -75,52 +335,208 @@ pub fn get_constants_elliptic_curve() -> (BigUint, BigUint, Point, Point) {
 
 impl Point {
     /// Serializes the Point structure to an array of bytes to transferring it
-    /// through the network.
+    /// through the network. Numbers are written in big-endian (network byte
+    /// order): integer points as their minimal bytes, elliptic curve points as
+    /// `x` followed by `y`, both padded to the same length. See
+    /// `serialize_with_order` for peers using little-endian.
     pub fn serialize(self: &Self) -> Vec<u8> {
+        let mut v = Vec::new();
+        self.serialize_into(&mut v);
+        v
+    }
+
+    /// Same as `serialize` but writes the bytes to `buffer`, replacing its
+    /// content. The buffer only grows when it is too small, so reusing it
+    /// across calls serializes without allocating.
+    pub fn serialize_into(self: &Self, buffer: &mut Vec<u8>) {
+        buffer.clear();
         match self {
-            Point::Scalar(x) => x.to_bytes_be(),
+            Point::Scalar(x) => write_be_bytes(buffer, x, be_bytes_len(x)),
             Point::ECPoint(x, y) => {
-                let mut x = x.to_bytes_be();
-                let mut y = y.to_bytes_be();
-                let diff = (x.len() as i32) - (y.len() as i32);
-                if diff > 0 {
-                    y.resize(y.len() + diff as usize, 0);
-                    y.rotate_right(diff as usize);
-                } else {
-                    x.resize(x.len() + (-diff as usize), 0);
-                    x.rotate_right((-diff) as usize);
-                }
-                x.append(&mut y);
-                x
+                // both coordinates are padded to the length of the longest
+                let len = be_bytes_len(x).max(be_bytes_len(y));
+                write_be_bytes(buffer, x, len);
+                write_be_bytes(buffer, y, len);
             }
         }
     }
 
+    /// Returns the SHA-256 digest of the point serialized with `serialize`,
+    /// e.g. to index public keys. Equal points have the same fingerprint
+    /// whatever encoding they were read from, leading zeros or SEC 1 tags
+    /// included.
+    pub fn fingerprint(self: &Self) -> [u8; 32] {
+        Sha256::digest(self.serialize()).into()
+    }
+
+    /// Returns the first 8 bytes of `fingerprint` as hex, the identifier shown
+    /// by `Display` and in the logs.
+    pub fn short_id(self: &Self) -> String {
+        hex::encode(&self.fingerprint()[..8])
+    }
+
     /// Deserializes the Point structure from an array of bytes and transforms
-    /// it into an actual Point structure.
-    pub fn deserialize(v: Vec<u8>, group: &Group) -> Point {
-        match group {
-            Group::Scalar => Point::deserialize_into_scalar(v),
-            Group::EllipticCurve => Point::deserialize_into_ecpoint(v),
+    /// it into an actual Point structure. Empty or malformed inputs return an
+    /// error instead of panicking since they usually come from the network,
+    /// and so do points that aren't elements of the group (see
+    /// `Group::contains`) to prevent small-subgroup and invalid-curve attacks.
+    pub fn deserialize(v: Vec<u8>, group: &Group) -> Result<Point, Error> {
+        Point::deserialize_slice(&v, group)
+    }
+
+    /// Same as `deserialize` but reads the point from borrowed bytes, e.g. a
+    /// region of a memory-mapped file, without copying them into a vector
+    /// first. The point owns its numbers, so the bytes may be released as
+    /// soon as it returns.
+    pub fn deserialize_slice(v: &[u8], group: &Group) -> Result<Point, Error> {
+        let point = Point::parse(v, group)?;
+        if !group.contains(&point) {
+            return Err(Error::InvalidPoint);
+        }
+        Ok(point)
+    }
+
+    /// Deserializes several points at once with the checks of `deserialize`,
+    /// e.g. a file of public keys. The points are collected into a single
+    /// allocation. On the first invalid element, the points already parsed
+    /// are dropped and its index is returned along with the error.
+    pub fn deserialize_all(
+        data: Vec<Vec<u8>>,
+        group: &Group,
+    ) -> Result<Vec<Point>, (usize, Error)> {
+        let mut points = Vec::with_capacity(data.len());
+        for (i, v) in data.into_iter().enumerate() {
+            points.push(Point::deserialize(v, group).map_err(|err| (i, err))?);
+        }
+        Ok(points)
+    }
+
+    /// Same as `deserialize` without checking that the point is an element of
+    /// the group. Only use it for trusted inputs.
+    pub fn deserialize_unchecked(v: Vec<u8>, group: &Group) -> Result<Point, Error> {
+        Point::parse(&v, group)
+    }
+
+    fn parse(v: &[u8], group: &Group) -> Result<Point, Error> {
+        match group.kind() {
+            GroupKind::Scalar | GroupKind::Custom(_) => Point::parse_scalar(v),
+            GroupKind::EllipticCurve => Point::parse_ecpoint(v),
         }
     }
 
-    pub fn deserialize_into_scalar(v: Vec<u8>) -> Point {
-        Point::Scalar(BigUint::from_bytes_be(&v))
+    pub fn deserialize_into_scalar(v: Vec<u8>) -> Result<Point, Error> {
+        Point::parse_scalar(&v)
+    }
+
+    pub fn deserialize_into_ecpoint(v: Vec<u8>) -> Result<Point, Error> {
+        Point::parse_ecpoint(&v)
+    }
+
+    fn parse_scalar(v: &[u8]) -> Result<Point, Error> {
+        check_serialized_size(v.len())?;
+        if v.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+
+        Ok(Point::Scalar(BigUint::from_bytes_be(v)))
     }
 
-    pub fn deserialize_into_ecpoint(v: Vec<u8>) -> Point {
+    fn parse_ecpoint(v: &[u8]) -> Result<Point, Error> {
+        check_serialized_size(v.len())?;
         let len = v.len();
 
-        assert!(
-            len % 2 == 0,
-            "The length of the serialized object should be even"
-        );
+        // The default encoding has an even length, the tagged ones of
+        // `serialize_with` an odd one
+        if len % 2 != 0 {
+            return Point::deserialize_tagged_ecpoint(v);
+        }
+        if len == 0 {
+            return Err(Error::InvalidSerialization);
+        }
 
-        Point::ECPoint(
+        Ok(Point::ECPoint(
             BigUint::from_bytes_be(&v[..len / 2]),
             BigUint::from_bytes_be(&v[len / 2..]),
-        )
+        ))
+    }
+
+    /// Same as `serialize` but the numbers are written in `order`, e.g. to
+    /// interoperate with implementations using little-endian. The layout is
+    /// unchanged, only the bytes of each number are reversed.
+    pub fn serialize_with_order(self: &Self, order: ByteOrder) -> Vec<u8> {
+        let mut v = self.serialize();
+        if order == ByteOrder::LittleEndian {
+            reverse_numbers(&mut v, matches!(self, Point::ECPoint(..)));
+        }
+        v
+    }
+
+    /// Deserializes a Point written with `serialize_with_order` and `order`,
+    /// with the same checks as `deserialize`.
+    pub fn deserialize_with_order(
+        mut v: Vec<u8>,
+        group: &Group,
+        order: ByteOrder,
+    ) -> Result<Point, Error> {
+        if order == ByteOrder::LittleEndian {
+            let coordinates = matches!(group.kind(), GroupKind::EllipticCurve);
+            // the tagged encodings only exist in big-endian
+            if coordinates && v.len() % 2 != 0 {
+                return Err(Error::InvalidSerialization);
+            }
+            reverse_numbers(&mut v, coordinates);
+        }
+        Point::deserialize(v, group)
+    }
+
+    /// Serializes the Point structure with the encoding chosen in `options`.
+    /// Elliptic curve points are written in the SEC 1 format, compressed or
+    /// not, with a leading tag byte that `deserialize` recognizes. Integer
+    /// points have a single encoding, the one of `serialize`.
+    pub fn serialize_with(self: &Self, options: SerializeOptions) -> Vec<u8> {
+        match self {
+            Point::Scalar(_) => self.serialize(),
+            Point::ECPoint(x, y) => {
+                let x = pad_to_field_size(x);
+                if options.compressed {
+                    let tag = if y.bit(0) { 0x03 } else { 0x02 };
+                    [vec![tag], x].concat()
+                } else {
+                    [vec![0x04], x, pad_to_field_size(y)].concat()
+                }
+            }
+        }
+    }
+
+    /// Decodes an elliptic curve point in the SEC 1 format: `0x04` followed
+    /// by both coordinates, or `0x02` / `0x03` followed by `x` only, the tag
+    /// giving the parity of `y`.
+    fn deserialize_tagged_ecpoint(v: &[u8]) -> Result<Point, Error> {
+        match (v.first(), v.len()) {
+            (Some(0x04), 65) => Ok(Point::ECPoint(
+                BigUint::from_bytes_be(&v[1..33]),
+                BigUint::from_bytes_be(&v[33..]),
+            )),
+            (Some(&tag), 33) if tag == 0x02 || tag == 0x03 => {
+                let p = Secp256k1Point::prime();
+                let x = BigUint::from_bytes_be(&v[1..]);
+                if x >= p {
+                    return Err(Error::InvalidSerialization);
+                }
+
+                // p = 3 mod 4, so the square roots of a are +/- a^((p + 1) / 4)
+                let a = (&x * &x * &x + 7u32) % &p;
+                let mut y = a.modpow(&((&p + 1u32) >> 2), &p);
+                if (&y * &y) % &p != a {
+                    return Err(Error::InvalidPoint);
+                }
+                if y.bit(0) != (tag == 0x03) {
+                    y = &p - y;
+                }
+                Ok(Point::ECPoint(x, y))
+            }
+            _ => Err(Error::InvalidSerialization),
+        }
     }
 
     /// Converts a point from the `secp256k1` library into a Point
@@ -130,475 +546,4560 @@ impl Point {
             _ => panic!("elliptic_curves::Point::Zero not convertible into a point"),
         }
     }
-}
 
-/// Exponenciates two points g & h:
-///  - For the integer or scalar group the new ones are: g^exp & h^exp
-///  - For the elliptic curve group the new ones are: exp * g & exp * h
-pub fn exponentiates_points(
-    exp: &BigUint,
-    g: &Point,
-    h: &Point,
-    p: &BigUint,
-) -> Result<(Point, Point), Error> {
-    match (g, h) {
-        (Point::Scalar(g), Point::Scalar(h)) => Ok(exponentiates_points_scalar(exp, g, h, p)),
-        (Point::ECPoint(gx, gy), Point::ECPoint(hx, hy)) => {
-            Ok(exponentiates_points_elliptic_curve(exp, gx, gy, hx, hy))
+    /// Compares two points in constant time with respect to the values of
+    /// their coordinates. Points of different kinds are never equal.
+    pub fn ct_eq(self: &Self, other: &Point) -> bool {
+        match (self, other) {
+            (Point::Scalar(a), Point::Scalar(b)) => ct_eq_biguint(a, b),
+            (Point::ECPoint(x1, y1), Point::ECPoint(x2, y2)) => {
+                // Both coordinates are always compared to avoid short-circuiting
+                ct_eq_biguint(x1, x2) & ct_eq_biguint(y1, y2)
+            }
+            _ => false,
         }
-        _ => Err(Error::InvalidArguments),
     }
 }
 
-pub fn exponentiates_points_scalar(
-    exp: &BigUint,
-    g: &BigUint,
-    h: &BigUint,
-    p: &BigUint,
-) -> (Point, Point) {
-    (
-        Point::Scalar(g.modpow(exp, p)),
-        Point::Scalar(h.modpow(exp, p)),
-    )
+/// Order of the bytes of the numbers in `Point::serialize_with_order`.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum ByteOrder {
+    /// Most significant byte first, the network byte order used by
+    /// `Point::serialize`.
+    #[default]
+    BigEndian,
+    LittleEndian,
 }
 
-pub fn exponentiates_points_elliptic_curve(
-    exp: &BigUint,
-    gx: &BigUint,
-    gy: &BigUint,
-    hx: &BigUint,
-    hy: &BigUint,
-) -> (Point, Point) {
-    let g = Secp256k1Point::from_bigint(&gx, &gy);
-    let h = Secp256k1Point::from_bigint(&hx, &hy);
+/// Reverses the bytes of the serialized number in `v`, or of both halves if it
+/// holds the two coordinates of an elliptic curve point.
+fn reverse_numbers(v: &mut [u8], coordinates: bool) {
+    if coordinates {
+        let (x, y) = v.split_at_mut(v.len() / 2);
+        x.reverse();
+        y.reverse();
+    } else {
+        v.reverse();
+    }
+}
 
-    let g = g.scale(exp.clone());
-    let h = h.scale(exp.clone());
+/// Options of `Point::serialize_with`.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct SerializeOptions {
+    /// Writes only the `x` coordinate of elliptic curve points and the parity
+    /// of `y`, at the cost of a square root when deserializing.
+    pub compressed: bool,
+}
 
-    let g_new = match g {
-        secp256k1::Point::Coor { x, y, .. } => Point::ECPoint(x.number, y.number),
-        _ => panic!("You reach the Zero in elliptic curve multiplication"),
-    };
+/// Writes a coordinate of secp256k1 as 32 big-endian bytes.
+fn pad_to_field_size(n: &BigUint) -> Vec<u8> {
+    let bytes = n.to_bytes_be();
+    let mut v = vec![0u8; 32usize.saturating_sub(bytes.len())];
+    v.extend_from_slice(&bytes);
+    v
+}
 
-    let h_new = match h {
-        secp256k1::Point::Coor { x, y, .. } => Point::ECPoint(x.number, y.number),
-        _ => panic!("You reach the Zero in elliptic curve multiplication"),
-    };
+thread_local! {
+    /// Buffer of the serializations of `Point`'s Display, which runs for every
+    /// log line of a proof, so formatting doesn't allocate a new one per call.
+    static DISPLAY_BUFFER: RefCell<Vec<u8>> = const { RefCell::new(Vec::new()) };
+}
 
-    (g_new, h_new)
+/// Points only print a fingerprint of their serialization so log lines don't
+/// get flooded with big numbers.
+impl fmt::Display for Point {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let fingerprint = DISPLAY_BUFFER.with(|buffer| {
+            let buffer = &mut *buffer.borrow_mut();
+            self.serialize_into(buffer);
+            fingerprint(buffer)
+        });
+        match self {
+            Point::Scalar(_) => write!(f, "Scalar({})", fingerprint),
+            Point::ECPoint(..) => write!(f, "ECPoint({})", fingerprint),
+        }
+    }
 }
 
-/// This function solves the ZK challenge `s` proposed by the verifier.
-///
-/// s = (k - c * x) mod q
+/// Structure holding the values exchanged by the prover during one run of the
+/// protocol: the commitment `(r1, r2)`, the challenge `c` and the solution `s`.
 ///
-/// * `x_secret` - secret password.
-/// * `k` - random number selected by the prover.
-/// * `c` - random number selected by the verifier.
-/// * `q` - the order of the cyclic group
-pub fn solve_zk_challenge_s(x_secret: &BigUint, k: &BigUint, c: &BigUint, q: &BigUint) -> BigUint {
-    let cx = c * x_secret;
-    if *k > cx {
-        (k - cx).modpow(&BigUint::one(), q)
-    } else {
-        q - (cx - k).modpow(&BigUint::one(), q)
-    }
+/// Equality compares the contents of the proofs, not their validity: two
+/// proofs created for the same key are valid but almost never equal.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Proof {
+    pub r1: Point,
+    pub r2: Point,
+    pub c: BigUint,
+    pub s: BigUint,
 }
 
-pub fn verify(
-    r1: &Point,
-    r2: &Point,
-    y1: &Point,
-    y2: &Point,
-    g: &Point,
-    h: &Point,
-    c: &BigUint,
-    s: &BigUint,
-    p: &BigUint,
-) -> Result<bool, Error> {
-    match (r1, r2, y1, y2, g, h) {
-        (
-            Point::Scalar(r1),
-            Point::Scalar(r2),
-            Point::Scalar(y1),
-            Point::Scalar(y2),
-            Point::Scalar(g),
-            Point::Scalar(h),
-        ) => Ok(verify_scalar(r1, r2, y1, y2, g, h, c, s, p)),
-        (
-            Point::ECPoint(r1x, r1y),
-            Point::ECPoint(r2x, r2y),
-            Point::ECPoint(y1x, y1y),
-            Point::ECPoint(y2x, y2y),
-            Point::ECPoint(gx, gy),
-            Point::ECPoint(hx, hy),
-        ) => Ok(verify_ecpoint(
-            r1x, r1y, r2x, r2y, y1x, y1y, y2x, y2y, gx, gy, hx, hy, c, s,
-        )),
-        _ => Err(Error::InvalidArguments),
+impl fmt::Display for Proof {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "Proof({})", fingerprint(&self.serialize_compact()))
     }
 }
 
-/// This function verifies that the challenge `s` was properly solved by the
-/// prover for integer cyclic groups.
-/// r1 = g^s * y1^c && r2 = h^s * y2^c
-///
-/// * `r1` - g^k generated by the prover.
-/// * `r2` - h^k generated by the prover.
-/// * `y1` - g^x generated by the prover.
-/// * `y2` - h^x generated by the prover.
-/// * `g` - predefined element of the cyclic group.
-/// * `h` - predefined element of the cyclic group (g^n mod q ?).
-/// * `c` - random number generated by the verifier.
-/// * `s` - solution to the challenge computed by the prover.
-/// * `p` - the prime number used to defined the cyclic group.
-pub fn verify_scalar(
-    r1: &BigUint,
-    r2: &BigUint,
-    y1: &BigUint,
-    y2: &BigUint,
-    g: &BigUint,
-    h: &BigUint,
-    c: &BigUint,
-    s: &BigUint,
-    p: &BigUint,
-) -> bool {
-    let condition_1 = *r1 == (g.modpow(s, p) * y1.modpow(c, p)).modpow(&BigUint::one(), p);
-    let condition_2 = *r2 == (h.modpow(s, p) * y2.modpow(c, p)).modpow(&BigUint::one(), p);
-    condition_1 && condition_2
-}
+impl Proof {
+    /// Compares two proofs in constant time with respect to their contents.
+    pub fn ct_eq(self: &Self, other: &Proof) -> bool {
+        self.r1.ct_eq(&other.r1)
+            & self.r2.ct_eq(&other.r2)
+            & ct_eq_biguint(&self.c, &other.c)
+            & ct_eq_biguint(&self.s, &other.s)
+    }
 
-/// This function verifies that the challenge `s` was properly solved by the
-/// prover for elliptic curves cyclic group (secp256k1).
-/// r1 = s * g + c * y1 && r2 = s * h + c * y2
-///
-/// * `r1x` - x coordinate of k * g generated by the prover.
-/// * `r1y` - y coordinate of k * g generated by the prover.
-/// * `r2x` - x coordinate of k * h generated by the prover.
-/// * `r2y` - y coordinate of k * h generated by the prover.
-/// * `y1x` - x coordinate of x * g generated by the prover.
-/// * `y1y` - y coordinate of x * g generated by the prover.
-/// * `y2x` - x coordinate of x * h generated by the prover.
-/// * `y2y` - x coordinate of x * h generated by the prover.
-/// * `gx` - x coordinate of predefined point of the cyclic group.
-/// * `gy` - y coordinate of predefined point of the cyclic group.
-/// * `hx` - x coordinate of predefined point of the cyclic group.
-/// * `hy` - y coordinate of predefined point of the cyclic group.
-/// * `c` - random number generated by the verifier.
-/// * `s` - solution to the challenge computed by the prover.
-/// * `p` - the prime number used to defined the cyclic group.
-pub fn verify_ecpoint(
-    r1x: &BigUint,
-    r1y: &BigUint,
-    r2x: &BigUint,
-    r2y: &BigUint,
-    y1x: &BigUint,
-    y1y: &BigUint,
-    y2x: &BigUint,
-    y2y: &BigUint,
-    gx: &BigUint,
-    gy: &BigUint,
-    hx: &BigUint,
-    hy: &BigUint,
-    c: &BigUint,
-    s: &BigUint,
-) -> bool {
-    let g = Secp256k1Point::from_bigint(&gx, &gy);
-    let h = Secp256k1Point::from_bigint(&hx, &hy);
-    let y1 = Secp256k1Point::from_bigint(&y1x, &y1y);
-    let y2 = Secp256k1Point::from_bigint(&y2x, &y2y);
-    let r1 = Secp256k1Point::from_bigint(&r1x, &r1y);
-    let r2 = Secp256k1Point::from_bigint(&r2x, &r2y);
+    /// Serializes the Proof structure to an array of bytes: a header with the
+    /// version of the format followed by the raw proof (see `serialize_raw`).
+    /// It is the canonical encoding of the proof in `group`: the same proof
+    /// always gives the same bytes, and `deserialize` accepts no other.
+    pub fn serialize(self: &Self, group: &Group) -> Vec<u8> {
+        self.serialize_with_header(group, &ProofHeader::default())
+    }
 
-    let sg = g.scale(s.clone());
-    let sh = h.scale(s.clone());
-    let cy1 = y1.scale(c.clone());
-    let cy2 = y2.scale(c.clone());
+    /// Same as `serialize` but records the creation time of the proof in the
+    /// header, which lets the verifier expire old proofs.
+    pub fn serialize_with_timestamp(self: &Self, group: &Group, created_at: SystemTime) -> Vec<u8> {
+        self.serialize_with_header(
+            group,
+            &ProofHeader {
+                created_at: Some(created_at),
+                ..Default::default()
+            },
+        )
+    }
+
+    /// Same as `serialize` but records the fingerprint of `group` in the
+    /// header, so a verifier holding several groups, e.g. while rotating to
+    /// new parameters, can tell which one the proof belongs to (see
+    /// `MultiGroupVerifier`).
+    pub fn serialize_with_group(self: &Self, group: &Group) -> Vec<u8> {
+        self.serialize_with_header(
+            group,
+            &ProofHeader {
+                group: Some(group.fingerprint()),
+                ..Default::default()
+            },
+        )
+    }
+
+    fn serialize_with_header(self: &Self, group: &Group, header: &ProofHeader) -> Vec<u8> {
+        let mut v = header.serialize();
+        v.append(&mut self.serialize_raw(group));
+        v
+    }
+
+    /// Serializes the Proof structure without header. Every field is written
+    /// as a 4-byte big-endian length followed by its bytes, padded with
+    /// leading zeros to a fixed length for the group: the length of `p` for
+    /// the points of integer groups, 32 bytes for each coordinate of the
+    /// points of secp256k1, and the length of `q` for `c` and `s`.
+    pub fn serialize_raw(self: &Self, group: &Group) -> Vec<u8> {
+        let (point_len, number_len) = proof_field_lengths(group);
+        let mut v = Vec::new();
+        for point in [&self.r1, &self.r2] {
+            let bytes = match point {
+                Point::Scalar(y) => padded_be_bytes(y, point_len),
+                Point::ECPoint(x, y) => [
+                    padded_be_bytes(x, point_len / 2),
+                    padded_be_bytes(y, point_len / 2),
+                ]
+                .concat(),
+            };
+            write_length_prefixed(&mut v, &bytes);
+        }
+        for number in [&self.c, &self.s] {
+            write_length_prefixed(&mut v, &padded_be_bytes(number, number_len));
+        }
+        v
+    }
+
+    /// Serializes the fields like `PROOF_VERSION` 1 did, as in
+    /// `Point::serialize` and without leading zeros for `c` and `s`.
+    fn serialize_compact(self: &Self) -> Vec<u8> {
+        let mut v = Vec::new();
+        write_length_prefixed(&mut v, &self.r1.serialize());
+        write_length_prefixed(&mut v, &self.r2.serialize());
+        write_length_prefixed(&mut v, &self.c.to_bytes_be());
+        write_length_prefixed(&mut v, &self.s.to_bytes_be());
+        v
+    }
+
+    /// Deserializes the Proof structure from an array of bytes created with
+    /// `serialize`, `serialize_with_timestamp` or `serialize_with_group`.
+    /// Empty, truncated or oversized inputs return an error, and so do
+    /// non-canonical encodings (see `serialize_raw`). Other versions of the
+    /// format and `ProofFormat::Interop` return `Error::UnsupportedVersion`,
+    /// see `upgrade_encoding` and `deserialize_format` to read them. Proofs
+    /// whose header records the fingerprint of another group return
+    /// `Error::GroupMismatch`, instead of failing to verify later on.
+    pub fn deserialize(v: Vec<u8>, group: &Group) -> Result<Proof, Error> {
+        let (_, proof) = Proof::deserialize_with_header(v, group)?;
+        Ok(proof)
+    }
+
+    /// Same as `deserialize` but also returns the header of the proof.
+    pub fn deserialize_with_header(
+        v: Vec<u8>,
+        group: &Group,
+    ) -> Result<(ProofHeader, Proof), Error> {
+        check_serialized_size(v.len())?;
+        let mut data = &v[..];
+        let header = ProofHeader::deserialize(&mut data)?;
+        header.check_group(group)?;
+        if header.version != PROOF_VERSION {
+            return Err(Error::UnsupportedVersion);
+        }
+        let proof = Proof::deserialize_raw(data.to_vec(), group)?;
+        Ok((header, proof))
+    }
+
+    /// Deserializes the Proof structure from an array of bytes created with
+    /// `serialize_raw`. Only the encoding of `serialize_raw` is accepted, so
+    /// that a proof has a single serialization: numbers with missing or extra
+    /// leading zeros or points in another encoding (see
+    /// `Point::serialize_with`) return an error.
+    pub fn deserialize_raw(v: Vec<u8>, group: &Group) -> Result<Proof, Error> {
+        let proof = Proof::parse_raw(&v, group)?;
+        if proof.serialize_raw(group) != v {
+            return Err(Error::InvalidSerialization);
+        }
+        Ok(proof)
+    }
+
+    /// Reads the fields written by `serialize_compact`, i.e. before
+    /// `PROOF_VERSION` 2, only accepting their encoding.
+    fn deserialize_compact(v: Vec<u8>, group: &Group) -> Result<Proof, Error> {
+        let proof = Proof::parse_raw(&v, group)?;
+        if proof.serialize_compact() != v {
+            return Err(Error::InvalidSerialization);
+        }
+        Ok(proof)
+    }
+
+    fn parse_raw(v: &[u8], group: &Group) -> Result<Proof, Error> {
+        check_serialized_size(v.len())?;
+        let mut data = v;
+
+        let r1 = Point::deserialize(read_length_prefixed(&mut data)?.to_vec(), group)?;
+        let r2 = Point::deserialize(read_length_prefixed(&mut data)?.to_vec(), group)?;
+        let c = read_length_prefixed(&mut data)?;
+        let s = read_length_prefixed(&mut data)?;
+
+        if c.is_empty() || s.is_empty() || !data.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+
+        Ok(Proof {
+            r1,
+            r2,
+            c: BigUint::from_bytes_be(c),
+            s: BigUint::from_bytes_be(s),
+        })
+    }
 
-    (r1 == sg + cy1) && (r2 == sh + cy2)
+    /// Re-serializes the proof `v` of `group` in the current version of the
+    /// format, keeping its header. It is the only way to read the proofs of
+    /// `LEGACY_PROOF_VERSION`, `COMPACT_PROOF_VERSION` and
+    /// `ProofFormat::Interop`, e.g. to migrate stored proofs lazily. Current
+    /// proofs come back unchanged.
+    pub fn upgrade_encoding(v: Vec<u8>, group: &Group) -> Result<Vec<u8>, Error> {
+        check_serialized_size(v.len())?;
+        if interop::is_interop(&v) {
+            let proof = Proof::deserialize_format(v, ProofFormat::Interop, group)?;
+            return Ok(proof.serialize(group));
+        }
+
+        let mut data = &v[..];
+        let header = ProofHeader::deserialize(&mut data)?;
+        header.check_group(group)?;
+        let proof = match header.version {
+            PROOF_VERSION => Proof::deserialize_raw(data.to_vec(), group)?,
+            _ => Proof::deserialize_compact(data.to_vec(), group)?,
+        };
+        Ok(proof.serialize_with_header(
+            group,
+            &ProofHeader {
+                version: PROOF_VERSION,
+                ..header
+            },
+        ))
+    }
+
+    /// Tells if `v` is the serialization of a proof of `group` as written by
+    /// `serialize`, `serialize_with_timestamp` or `serialize_with_group`, the
+    /// only ones `deserialize` accepts, e.g. before using the bytes as the key
+    /// of a content-addressed storage. There is exactly one for each proof
+    /// and header.
+    pub fn is_canonical(v: &[u8], group: &Group) -> bool {
+        Proof::deserialize_with_header(v.to_vec(), group).is_ok()
+    }
+
+    /// Serializes many proofs of `group` into a single buffer: their number
+    /// as 4 big-endian bytes followed by every proof (see `serialize`)
+    /// preceded by its 4-byte big-endian length.
+    pub fn serialize_batch(proofs: &[Proof], group: &Group) -> Vec<u8> {
+        let mut v = Vec::new();
+        v.extend_from_slice(&(proofs.len() as u32).to_be_bytes());
+        for proof in proofs {
+            write_length_prefixed(&mut v, &proof.serialize(group));
+        }
+        v
+    }
+
+    /// Deserializes proofs created with `serialize_batch`. Truncated inputs,
+    /// trailing bytes or a count that doesn't match the proofs return an
+    /// error.
+    pub fn deserialize_batch(v: Vec<u8>, group: &Group) -> Result<Vec<Proof>, Error> {
+        check_serialized_size(v.len())?;
+        if v.len() < 4 {
+            return Err(Error::InvalidSerialization);
+        }
+        let (count, mut data) = v.split_at(4);
+        let count = u32::from_be_bytes([count[0], count[1], count[2], count[3]]) as usize;
+
+        // the count is not trusted to reserve memory, every proof takes at
+        // least 4 bytes
+        let mut proofs = Vec::with_capacity(count.min(data.len() / 4));
+        for _ in 0..count {
+            let bytes = read_length_prefixed(&mut data)?;
+            proofs.push(Proof::deserialize(bytes.to_vec(), group)?);
+        }
+
+        if !data.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+        Ok(proofs)
+    }
+
+    /// Cheap first check of a proof before looking up the public values and
+    /// verifying it: the commitments must be elements of the group, the
+    /// challenge smaller than its order `q` and the solution at most `q`, as
+    /// produced by `create_proof`.
+    ///
+    /// A well-formed proof is NOT a valid one, it only means the proof isn't
+    /// junk. Only `Group::verify_proof` tells if it is valid.
+    pub fn is_well_formed(self: &Self, group: &Group) -> bool {
+        let (_, q, _, _) = get_constants(group);
+        self.c < q && self.s <= q && group.contains(&self.r1) && group.contains(&self.r2)
+    }
 }
 
-/// Generates a random array of bytes which can be use as a secret.
-///
-/// Warning: Don't use it for production purposes. Better pseudo random
-/// generators should be used.
-pub fn get_random_array<const BYTES: usize>() -> [u8; BYTES] {
-    let mut arr = [0u8; BYTES];
-    thread_rng()
-        .try_fill(&mut arr[..])
-        .expect("Fail to generate array of random number.");
-    return arr;
+/// Current version of the serialization format of the proofs.
+pub const PROOF_VERSION: u8 = 2;
+
+/// Version of the proofs whose fields were written without padding, before
+/// `PROOF_VERSION` 2 gave them the fixed lengths of `Proof::serialize_raw`.
+/// `Proof::upgrade_encoding` reads them.
+pub const COMPACT_PROOF_VERSION: u8 = 1;
+
+/// Version of the proofs serialized before the header existed, i.e. the
+/// fields of `COMPACT_PROOF_VERSION` alone. They start with the length of
+/// `r1`, whose first byte is always zero within `max_serialized_size`, so
+/// `Proof::upgrade_encoding` tells them apart and reads them with an empty
+/// header.
+pub const LEGACY_PROOF_VERSION: u8 = 0;
+
+/// Flag of the header telling that a timestamp follows.
+const HEADER_TIMESTAMP: u8 = 0x01;
+
+/// Flag of the header telling that the fingerprint of the group follows.
+const HEADER_GROUP: u8 = 0x02;
+
+/// Metadata written before the serialized proofs: the version of the format
+/// and optionally the time at which the proof was created and the fingerprint
+/// of its group (see `Group::fingerprint`). It is encoded as the version byte,
+/// a byte of flags, then the timestamp in seconds since the Unix epoch as 8
+/// big-endian bytes and the 32 bytes of the fingerprint when present.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct ProofHeader {
+    pub version: u8,
+    pub created_at: Option<SystemTime>,
+    pub group: Option<[u8; 32]>,
 }
 
-/// Generates a 32-bytes random number
-///
-/// Warning: Don't use it for production purposes.
-pub fn get_random_number() -> BigUint {
-    BigUint::from_bytes_be(&get_random_array::<32>())
+impl Default for ProofHeader {
+    fn default() -> Self {
+        ProofHeader {
+            version: PROOF_VERSION,
+            created_at: None,
+            group: None,
+        }
+    }
 }
 
-/// Generates a random string of any length. It is useful to generates user or
-/// session IDs.
-pub fn get_random_string(n: usize) -> String {
-    rand::thread_rng()
-        .sample_iter(&Alphanumeric)
-        .take(n)
-        .map(char::from)
-        .collect()
+impl ProofHeader {
+    /// Reads the header of a proof serialized with `Proof::serialize` without
+    /// the proof itself, e.g. to find the group to deserialize it with. The
+    /// proofs in `ProofFormat::Interop` only have a version,
+    /// `INTEROP_VERSION`.
+    pub fn read(v: &[u8]) -> Result<ProofHeader, Error> {
+        if let Some(rest) = v.strip_prefix(INTEROP_MAGIC) {
+            return match rest.first() {
+                Some(&INTEROP_VERSION) => Ok(ProofHeader {
+                    version: INTEROP_VERSION,
+                    ..Default::default()
+                }),
+                Some(_) => Err(Error::UnsupportedVersion),
+                None => Err(Error::InvalidSerialization),
+            };
+        }
+        let mut data = v;
+        ProofHeader::deserialize(&mut data)
+    }
+
+    fn serialize(self: &Self) -> Vec<u8> {
+        let mut v = vec![self.version, 0];
+        if let Some(created_at) = self.created_at {
+            let secs = created_at
+                .duration_since(UNIX_EPOCH)
+                .map_or(0, |elapsed| elapsed.as_secs());
+            v[1] |= HEADER_TIMESTAMP;
+            v.extend_from_slice(&secs.to_be_bytes());
+        }
+        if let Some(group) = self.group {
+            v[1] |= HEADER_GROUP;
+            v.extend_from_slice(&group);
+        }
+        v
+    }
+
+    fn deserialize(data: &mut &[u8]) -> Result<ProofHeader, Error> {
+        if data.first() == Some(&LEGACY_PROOF_VERSION) {
+            return Ok(ProofHeader {
+                version: LEGACY_PROOF_VERSION,
+                created_at: None,
+                group: None,
+            });
+        }
+        if data.len() < 2 {
+            return Err(Error::InvalidSerialization);
+        }
+        let (version, flags) = (data[0], data[1]);
+        *data = &data[2..];
+
+        if version != PROOF_VERSION && version != COMPACT_PROOF_VERSION {
+            return Err(Error::UnsupportedVersion);
+        }
+        if flags & !(HEADER_TIMESTAMP | HEADER_GROUP) != 0 {
+            return Err(Error::InvalidSerialization);
+        }
+
+        let mut created_at = None;
+        if flags & HEADER_TIMESTAMP != 0 {
+            if data.len() < 8 {
+                return Err(Error::InvalidSerialization);
+            }
+            let (secs, rest) = data.split_at(8);
+            *data = rest;
+            let secs = u64::from_be_bytes(secs.try_into().unwrap());
+            // adding an arbitrary duration to the epoch could overflow
+            let time = UNIX_EPOCH.checked_add(Duration::from_secs(secs));
+            created_at = Some(time.ok_or(Error::InvalidSerialization)?);
+        }
+
+        let mut group = None;
+        if flags & HEADER_GROUP != 0 {
+            if data.len() < 32 {
+                return Err(Error::InvalidSerialization);
+            }
+            let (fingerprint, rest) = data.split_at(32);
+            *data = rest;
+            group = Some(fingerprint.try_into().unwrap());
+        }
+
+        Ok(ProofHeader {
+            version,
+            created_at,
+            group,
+        })
+    }
+
+    /// Returns `Error::GroupMismatch` if the header records the fingerprint
+    /// of another group than `group`.
+    fn check_group(self: &Self, group: &Group) -> Result<(), Error> {
+        match self.group {
+            Some(fingerprint) if fingerprint != group.fingerprint() => Err(Error::GroupMismatch),
+            _ => Ok(()),
+        }
+    }
+}
+
+/// Hash functions that can derive the challenge of the non-interactive
+/// proofs. The hash is not part of the serialized proof, so a proof only
+/// verifies with the hash it was created with: changing it breaks the
+/// compatibility with the proofs and verifiers using the previous one.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub enum ChallengeHash {
+    #[default]
+    Sha256,
+    Sha512,
+    Sha3_256,
+    /// SHA-256 hashed again until it was hashed the given number of times,
+    /// to match implementations that derive their challenges this way.
+    /// `DEFAULT_HASH_ITERATIONS` is the same as `Sha256`, and counts of 0 or
+    /// above `MAX_HASH_ITERATIONS` return `Error::InvalidArguments`.
+    Sha256Iterated(u32),
+}
+
+/// Reasons for which `Group::verify_proof_detailed` accepts or rejects a
+/// proof.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum RejectCode {
+    /// The proof is valid.
+    Accepted,
+    /// The challenge `c` is not the one derived from the commitment.
+    BadCommitment,
+    /// The solution `s` doesn't satisfy the verification equations.
+    BadResponse,
+    /// Some point is not an element of the group.
+    Malformed,
+}
+
+impl fmt::Display for RejectCode {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            RejectCode::Accepted => write!(f, "the proof is valid"),
+            RejectCode::BadCommitment => write!(f, "the challenge doesn't match the commitment"),
+            RejectCode::BadResponse => write!(f, "the response doesn't solve the challenge"),
+            RejectCode::Malformed => write!(f, "a point is not an element of the group"),
+        }
+    }
+}
+
+/// Outcome of `Group::verify_proof_detailed`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct VerifyResult {
+    pub valid: bool,
+    pub code: RejectCode,
+}
+
+impl VerifyResult {
+    fn rejected(code: RejectCode) -> VerifyResult {
+        VerifyResult { valid: false, code }
+    }
+
+    /// Returns the result like `verify_proof` would, malformed inputs being
+    /// `Error::InvalidPoint`.
+    fn as_result(self: &Self) -> Result<bool, Error> {
+        match self.code {
+            RejectCode::Malformed => Err(Error::InvalidPoint),
+            _ => Ok(self.valid),
+        }
+    }
+
+    /// Human readable explanation of the result.
+    pub fn reason(self: &Self) -> String {
+        self.code.to_string()
+    }
+}
+
+/// Structure holding the commitment `(r1, r2) = (g^k, h^k)` sent by the prover
+/// at the beginning of the interactive protocol.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Commitment {
+    pub r1: Point,
+    pub r2: Point,
+}
+
+impl Commitment {
+    /// Serializes the Commitment structure to an array of bytes, e.g. to show
+    /// it as a QR code. Both points are written as a 4-byte big-endian length
+    /// followed by their bytes.
+    pub fn serialize(self: &Self) -> Vec<u8> {
+        let mut v = Vec::new();
+        write_length_prefixed(&mut v, &self.r1.serialize());
+        write_length_prefixed(&mut v, &self.r2.serialize());
+        v
+    }
+
+    /// Deserializes the Commitment structure from an array of bytes. Empty,
+    /// truncated or oversized inputs return an error.
+    pub fn deserialize(v: Vec<u8>, group: &Group) -> Result<Commitment, Error> {
+        check_serialized_size(v.len())?;
+        let mut data = &v[..];
+
+        let r1 = Point::deserialize(read_length_prefixed(&mut data)?.to_vec(), group)?;
+        let r2 = Point::deserialize(read_length_prefixed(&mut data)?.to_vec(), group)?;
+
+        if !data.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+
+        Ok(Commitment { r1, r2 })
+    }
 }
 
-#[cfg(test)]
-mod tests {
-    // Note this useful idiom: importing names from outer (for mod tests) scope.
-    use super::*;
+impl Group {
+    /// Creates an integer cyclic group from the big-endian bytes of its
+    /// parameters. It checks, in this order and returning the error given:
+    ///  - that `p` is prime (Miller-Rabin), `Error::NotPrime`
+    ///  - that `q` is a prime dividing `p - 1`, `Error::BadOrder`
+    ///  - that `g` and `h` are elements of order `q` other than the identity,
+    ///    `Error::BadGenerator`
+    ///  - that `g` and `h` are distinct, `Error::SameGenerators`
+    pub fn new_with_params(p: &[u8], q: &[u8], g: &[u8], h: &[u8]) -> Result<Group, Error> {
+        let params = GroupParameters {
+            p: BigUint::from_bytes_be(p),
+            q: BigUint::from_bytes_be(q),
+            g: BigUint::from_bytes_be(g),
+            h: BigUint::from_bytes_be(h),
+        };
+
+        if !prime::is_probable_prime(&params.p) {
+            return Err(Error::NotPrime);
+        }
+
+        let p_minus_one = &params.p - BigUint::one();
+        if params.q.is_zero()
+            || !(&p_minus_one % &params.q).is_zero()
+            || !prime::is_probable_prime(&params.q)
+        {
+            return Err(Error::BadOrder);
+        }
+
+        for generator in [&params.g, &params.h] {
+            if generator.is_zero() || generator.is_one() || *generator >= params.p {
+                return Err(Error::BadGenerator);
+            }
+            if !generator.modpow(&params.q, &params.p).is_one() {
+                return Err(Error::BadGenerator);
+            }
+        }
+        if params.g == params.h {
+            return Err(Error::SameGenerators);
+        }
+
+        Ok(Group::Custom(params))
+    }
+
+    /// Checks that the point is an element of the subgroup of order `q` used
+    /// by the protocol. For integer groups that means `0 < y < p` and
+    /// `y^q = 1 mod p`, and for secp256k1, whose cofactor is 1, that the point
+    /// is on the curve.
+    pub fn contains(self: &Self, point: &Point) -> bool {
+        match (self.kind(), point) {
+            (GroupKind::Scalar | GroupKind::Custom(_), Point::Scalar(y)) => {
+                let (p, q, _, _) = get_constants(self);
+                !y.is_zero() && *y < p && y.modpow(&q, &p).is_one()
+            }
+            (GroupKind::EllipticCurve, Point::ECPoint(x, y)) => is_on_curve(x, y),
+            _ => false,
+        }
+    }
+
+    /// Returns the element `n` of the integer group, checked like the
+    /// deserialized points. Numbers that aren't elements of the group, and all
+    /// numbers for secp256k1, return `Error::InvalidPoint`.
+    pub fn point_from_integer(self: &Self, n: &BigUint) -> Result<Point, Error> {
+        self.checked_point(Point::Scalar(n.clone()))
+    }
+
+    /// Returns the point `(x, y)` of secp256k1, checked like the deserialized
+    /// points. Coordinates of a point not on the curve, or given for an
+    /// integer group, return `Error::InvalidPoint`.
+    pub fn point_from_coordinates(self: &Self, x: &BigUint, y: &BigUint) -> Result<Point, Error> {
+        self.checked_point(Point::ECPoint(x.clone(), y.clone()))
+    }
+
+    fn checked_point(self: &Self, point: Point) -> Result<Point, Error> {
+        match self.contains(&point) {
+            true => Ok(point),
+            false => Err(Error::InvalidPoint),
+        }
+    }
+
+    /// Tells if the modulus `p` of the integer group is a safe prime, i.e. if
+    /// `(p - 1) / 2` is prime as well, e.g. to assert it when validating the
+    /// configuration of a deployment. The primes of RFC 3526 are recognized
+    /// without running the primality tests. secp256k1 returns
+    /// `Error::Unsupported`.
+    pub fn is_safe_prime(self: &Self) -> Result<bool, Error> {
+        let (p, _, _, _) = get_constants(self);
+        match self.kind() {
+            GroupKind::EllipticCurve => Err(Error::Unsupported),
+            GroupKind::Custom(_) if rfc3526::is_named_prime(&p) => Ok(true),
+            GroupKind::Scalar | GroupKind::Custom(_) => {
+                let half = (&p - BigUint::one()) >> 1;
+                Ok(prime::is_probable_prime(&p) && prime::is_probable_prime(&half))
+            }
+        }
+    }
+
+    /// Creates one of the well-known safe prime groups of RFC 3526.
+    pub fn named(id: GroupId) -> Group {
+        Group::Custom(id.params())
+    }
+
+    /// Generates a new integer cyclic group from a random safe prime
+    /// `p = 2q + 1` of `bits` bits, for deployments that don't want to share a
+    /// named group. Sizes below `MIN_GENERATED_GROUP_BITS` are rejected as
+    /// insecure. It can take minutes, see `generate_params_with_progress`.
+    pub fn generate_params<R: RngCore + CryptoRng>(
+        bits: usize,
+        rng: &mut R,
+    ) -> Result<Group, Error> {
+        Group::generate_params_with_progress(bits, rng, |_| {}, &AtomicBool::new(false))
+    }
+
+    /// Same as `generate_params` but calls `progress` with the number of prime
+    /// candidates tried so far, and returns `Error::Cancelled` as soon as
+    /// `cancel` is set, e.g. from another thread when the user aborts. The
+    /// flag is checked before every candidate. `progress` runs on the calling
+    /// thread, once per candidate, and is never called after the function
+    /// returns: nothing of the generation outlives it.
+    pub fn generate_params_with_progress<R: RngCore + CryptoRng, F: FnMut(u64)>(
+        bits: usize,
+        rng: &mut R,
+        progress: F,
+        cancel: &AtomicBool,
+    ) -> Result<Group, Error> {
+        if bits < MIN_GENERATED_GROUP_BITS {
+            return Err(Error::InvalidGroupParameters);
+        }
+        Group::generate_safe_prime_group(bits, rng, progress, cancel)
+    }
+
+    /// Generates the group without checking its size. `g = 4` is a square, so
+    /// it has order `q`, and `h` is derived by hashing `p` like for the named
+    /// groups.
+    fn generate_safe_prime_group<R: RngCore + CryptoRng, F: FnMut(u64)>(
+        bits: usize,
+        rng: &mut R,
+        progress: F,
+        cancel: &AtomicBool,
+    ) -> Result<Group, Error> {
+        let p = prime::generate_safe_prime(bits, rng, progress, cancel)?;
+        let q = (&p - BigUint::one()) >> 1;
+        let g = BigUint::from(4u32);
+        let h = rfc3526::hash_to_subgroup(&p.to_bytes_be(), &p);
+
+        Ok(Group::Custom(GroupParameters { p, q, g, h }))
+    }
+
+    /// Returns the parameters `(p, q, g, h)` of the group as bytes: `p` and `q`
+    /// in big-endian and `g` and `h` serialized as points.
+    pub fn params(self: &Self) -> (Vec<u8>, Vec<u8>, Vec<u8>, Vec<u8>) {
+        let (p, q, g, h) = get_constants(self);
+        (
+            p.to_bytes_be(),
+            q.to_bytes_be(),
+            g.serialize(),
+            h.serialize(),
+        )
+    }
+
+    /// Returns the SHA-256 digest of the kind of group and its parameters.
+    /// Groups with the same parameters have the same fingerprint however they
+    /// were created, so two parties can compare them before exchanging proofs.
+    pub fn fingerprint(self: &Self) -> [u8; 32] {
+        let kind = match self.kind() {
+            GroupKind::Scalar | GroupKind::Custom(_) => b"integer".as_slice(),
+            GroupKind::EllipticCurve => b"elliptic curve".as_slice(),
+        };
+        let (p, q, g, h) = self.params();
+
+        let mut v = Vec::new();
+        for bytes in [kind, &p, &q, &g, &h] {
+            write_length_prefixed(&mut v, bytes);
+        }
+        Sha256::digest(v).into()
+    }
+
+    /// Serializes the group to persist it, e.g. parameters generated once with
+    /// `generate_params`: a byte telling the kind of group followed, for
+    /// integer groups with custom parameters, by `p`, `q`, `g` and `h`, each
+    /// one preceded by its 4-byte big-endian length.
+    pub fn serialize(self: &Self) -> Vec<u8> {
+        match self.kind() {
+            GroupKind::Scalar => vec![GROUP_SCALAR],
+            GroupKind::EllipticCurve => vec![GROUP_ELLIPTIC_CURVE],
+            GroupKind::Custom(params) => {
+                let mut v = vec![GROUP_CUSTOM];
+                for n in [&params.p, &params.q, &params.g, &params.h] {
+                    write_length_prefixed(&mut v, &n.to_bytes_be());
+                }
+                v
+            }
+        }
+    }
+
+    /// Deserializes a group created with `serialize`. The parameters are
+    /// checked again like in `new_with_params` and invalid ones return the
+    /// same errors.
+    pub fn deserialize(v: Vec<u8>) -> Result<Group, Error> {
+        check_serialized_size(v.len())?;
+        let (&kind, mut data) = v.split_first().ok_or(Error::InvalidSerialization)?;
+
+        let group = match kind {
+            GROUP_SCALAR => Group::Scalar,
+            GROUP_ELLIPTIC_CURVE => Group::EllipticCurve,
+            GROUP_CUSTOM => {
+                let p = read_length_prefixed(&mut data)?;
+                let q = read_length_prefixed(&mut data)?;
+                let g = read_length_prefixed(&mut data)?;
+                let h = read_length_prefixed(&mut data)?;
+                if !data.is_empty() {
+                    return Err(Error::InvalidSerialization);
+                }
+                return Group::new_with_params(p, q, g, h);
+            }
+            _ => return Err(Error::InvalidSerialization),
+        };
+
+        if !data.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+        Ok(group)
+    }
+
+    /// Tells if the serialized proof `v` was recorded as a proof of this group
+    /// by `Proof::serialize_with_group`. Proofs without fingerprint or with a
+    /// malformed header return `false`.
+    pub fn can_verify(self: &Self, v: &[u8]) -> bool {
+        ProofHeader::read(v).is_ok_and(|header| header.group == Some(self.fingerprint()))
+    }
+
+    /// Returns the length of the proofs of the group serialized with
+    /// `Proof::serialize`, which is the same for all of them.
+    pub fn proof_size(self: &Self) -> usize {
+        let (point_len, number_len) = proof_field_lengths(self);
+
+        // header, 4 length prefixes, r1, r2, c and s
+        2 + 4 * 4 + 2 * point_len + 2 * number_len
+    }
+
+    /// Returns how long the creation of a proof takes on this machine. The
+    /// cost is measured by creating a few proofs the first time it is asked
+    /// for a group and remembered afterwards.
+    pub fn estimated_proof_cost(self: &Self) -> Result<Duration, Error> {
+        static COSTS: OnceLock<Mutex<HashMap<[u8; 32], Duration>>> = OnceLock::new();
+
+        let fingerprint = self.fingerprint();
+        let costs = COSTS.get_or_init(Default::default);
+        if let Some(cost) = costs.lock().unwrap().get(&fingerprint) {
+            return Ok(*cost);
+        }
+
+        const RUNS: u32 = 3;
+        let (x, _, _) = self.generate_key()?;
+        let start = Instant::now();
+        for _ in 0..RUNS {
+            self.create_proof(&x)?;
+        }
+        let cost = start.elapsed() / RUNS;
+
+        costs.lock().unwrap().insert(fingerprint, cost);
+        Ok(cost)
+    }
+
+    /// Runs the whole protocol once, e.g. for a readiness probe: a new key
+    /// proves itself, the proof survives serialization and a tampered copy of
+    /// it is rejected. Returns `Error::SelfTestFailed` if any result is wrong.
+    pub fn self_test(self: &Self) -> Result<(), Error> {
+        let (x, y1, y2) = self.generate_key()?;
+        let proof = self.create_proof(&x)?;
+        let proof = Proof::deserialize(proof.serialize(self), self)?;
+        if !self.verify_proof(&y1, &y2, &proof)? {
+            return Err(Error::SelfTestFailed);
+        }
+
+        let mut tampered = proof;
+        tampered.s += 1u32;
+        if self.verify_proof(&y1, &y2, &tampered)? {
+            return Err(Error::SelfTestFailed);
+        }
+        Ok(())
+    }
+
+    /// Generates a random secret `x` and its public values `(y1, y2)`. Kept
+    /// for compatibility and deprecated in favor of `generate_key_pair`, which
+    /// calls it: `generate_key_pair()?.unpack()` returns the same tuple, so
+    /// callers can migrate one at a time. Gives up like
+    /// `generate_key_timeout` if `Operation::GenerateKey` has a timeout.
+    pub fn generate_key(self: &Self) -> Result<(BigUint, Point, Point), Error> {
+        match self.operation_timeout(Operation::GenerateKey) {
+            Duration::ZERO => self.generate_key_now(),
+            timeout => self.generate_key_timeout(timeout),
+        }
+    }
+
+    fn generate_key_now(self: &Self) -> Result<(BigUint, Point, Point), Error> {
+        let x = self.random_secret()?;
+        self.key_from_secret(x)
+    }
+
+    /// Draws a secret uniformly in `[2, q)`: it is drawn again if it is weak,
+    /// unlikely unless the generator is broken.
+    fn random_secret(self: &Self) -> Result<BigUint, Error> {
+        loop {
+            let x = self.random_scalar_with_rng(&mut DefaultRng)?.into_value();
+            if !is_weak_secret(&x) {
+                return Ok(x);
+            }
+        }
+    }
+
+    /// Same as `generate_key` but first runs `check_entropy`, returning
+    /// `Error::InsufficientEntropy` instead of keys drawn from an unavailable
+    /// generator.
+    pub fn generate_key_checked(self: &Self) -> Result<(BigUint, Point, Point), Error> {
+        check_entropy()?;
+        self.generate_key()
+    }
+
+    /// Generates `n` random secrets and their public values at once, sharing
+    /// the setup of the group between all of them.
+    pub fn generate_keys(self: &Self, n: usize) -> Result<Vec<(BigUint, Point, Point)>, Error> {
+        if n == 0 {
+            return Err(Error::InvalidKeyCount);
+        }
+
+        let (p, _, g, h) = get_constants(self);
+        (0..n)
+            .map(|_| {
+                let x = self.random_secret()?;
+                let (y1, y2) = exponentiates_points(&x, &g, &h, &p)?;
+                log::debug!("generated key of group {}: y1 {} y2 {}", self, y1, y2);
+                Ok((x, y1, y2))
+            })
+            .collect()
+    }
+
+    /// Same as `generate_key` but gives up with `Error::Timeout` after
+    /// `timeout`, e.g. when the random number generator blocks. The generation
+    /// runs in the threads of the timeouts (see `Operation`) and can't be
+    /// interrupted: a key finished too late is wiped and discarded. A
+    /// generation that panics returns `Error::RandomnessFailure`.
+    pub fn generate_key_timeout(
+        self: &Self,
+        timeout: Duration,
+    ) -> Result<(BigUint, Point, Point), Error> {
+        let (sender, receiver) = mpsc::channel();
+        let group = self.clone();
+        let abandoned = Arc::new(AtomicBool::new(false));
+
+        timeout::spawn(Arc::clone(&abandoned), move || {
+            // the receiver is gone if the caller stopped waiting
+            if let Err(mpsc::SendError(Ok((mut x, _, _)))) = sender.send(group.generate_key_now()) {
+                zeroize(&mut x);
+            }
+        });
+
+        match receiver.recv_timeout(timeout) {
+            Ok(key) => key,
+            Err(mpsc::RecvTimeoutError::Timeout) => {
+                abandoned.store(true, Ordering::Relaxed);
+                Err(Error::Timeout)
+            }
+            Err(mpsc::RecvTimeoutError::Disconnected) => Err(Error::RandomnessFailure),
+        }
+    }
+
+    /// Deterministically derives the secret `x` and its public values
+    /// `(y1, y2)` from a seed of at least 16 bytes. The same seed always leads
+    /// to the same keys for the same group. Returns `Error::InvalidArguments`
+    /// for the groups whose order has more than `MAX_SEED_KEY_BITS` bits.
+    pub fn generate_key_from_seed(
+        self: &Self,
+        seed: &[u8],
+    ) -> Result<(BigUint, Point, Point), Error> {
+        if seed.len() < 16 {
+            return Err(Error::InvalidSeed);
+        }
+
+        let (_, q, _, _) = get_constants(self);
+        if q.bits() > MAX_SEED_KEY_BITS {
+            return Err(Error::InvalidArguments);
+        }
+
+        let mut counter = 0u32;
+        let x = loop {
+            let x = hash_seed_to_number(seed, counter, q.bits()) % &q;
+            if !is_weak_secret(&x) {
+                break x;
+            }
+            counter += 1;
+        };
+
+        self.key_from_secret(x)
+    }
+
+    /// Derives the public values `(y1, y2)` of an existing secret `x`. Returns
+    /// `Error::InvalidSecret` unless `1 < x < q`, like `PrivateKey::new`, as
+    /// the public values of 0 and 1 give them away.
+    pub fn public_key(self: &Self, x: &BigUint) -> Result<(Point, Point), Error> {
+        let (p, q, g, h) = get_constants(self);
+        if is_weak_secret(x) || *x >= q {
+            return Err(Error::InvalidSecret);
+        }
+        exponentiates_points(x, &g, &h, &p)
+    }
+
+    fn key_from_secret(self: &Self, x: BigUint) -> Result<(BigUint, Point, Point), Error> {
+        let (p, _, g, h) = get_constants(self);
+        let (y1, y2) = exponentiates_points(&x, &g, &h, &p)?;
+        log::debug!("generated key of group {}: y1 {} y2 {}", self, y1, y2);
+        Ok((x, y1, y2))
+    }
+
+    /// First step of the interactive protocol run by the prover. Returns the
+    /// random number `k`, which must be kept secret, and the commitment
+    /// `(r1, r2)` to send to the verifier.
+    pub fn commit(self: &Self) -> Result<(BigUint, Commitment), Error> {
+        self.commit_with_rng(&mut DefaultRng)
+    }
+
+    fn commit_with_rng<R: RngCore + CryptoRng>(
+        self: &Self,
+        rng: &mut R,
+    ) -> Result<(BigUint, Commitment), Error> {
+        let (p, _, g, h) = get_constants(self);
+
+        // uniform modulo q, or s = k - c * x wouldn't hide x. Zero is drawn
+        // again, it would give s away
+        let k = loop {
+            let k = self.random_scalar_with_rng(rng)?.into_value();
+            if !k.is_zero() {
+                break k;
+            }
+        };
+        let (r1, r2) = exponentiates_points(&k, &g, &h, &p)?;
+
+        Ok((k, Commitment { r1, r2 }))
+    }
+
+    /// Second step of the interactive protocol run by the verifier. Returns
+    /// the random challenge `c` to send to the prover, uniform in `[1, q)`.
+    pub fn challenge(self: &Self) -> BigUint {
+        loop {
+            let c = self.random_scalar().into_value();
+            if !c.is_zero() {
+                return c;
+            }
+        }
+    }
+
+    /// Returns the challenge of the non-interactive proofs of the public
+    /// values `(y1, y2)` for `commitment`. It is the hash of the whole
+    /// transcript, the generators and public values included and not only the
+    /// commitment, so that a proof never verifies for other public inputs
+    /// (weak Fiat-Shamir). `create_proof` uses it and `verify_proof`
+    /// recomputes it.
+    pub fn transcript_challenge(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        commitment: &Commitment,
+    ) -> Scalar {
+        let (_, q, g, h) = get_constants(self);
+        let points = [&g, &h, y1, y2, &commitment.r1, &commitment.r2];
+        let c = fiat_shamir_challenge(&points, &q, ChallengeHash::default(), &[]);
+        Scalar::from_value(c)
+    }
+
+    /// Returns the bytes hashed into the challenge of the proofs of `create_proof`
+    /// for the public values `(y1, y2)`, e.g. to archive them for auditors: the
+    /// SHA-256 digest of the transcript reduced modulo `q` is `proof.c` for
+    /// every valid proof. Each of the generators `g` and `h`, the public values
+    /// and the commitment `(r1, r2)` is serialized like `Point::serialize` and
+    /// written with a 4-byte big-endian length. Returns `Error::InvalidPoint`
+    /// if one of the points is not an element of the group.
+    pub fn proof_transcript(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+    ) -> Result<Vec<u8>, Error> {
+        let (_, _, g, h) = get_constants(self);
+        let points = [&g, &h, y1, y2, &proof.r1, &proof.r2];
+        if !points[2..].iter().all(|point| self.contains(point)) {
+            return Err(Error::InvalidPoint);
+        }
+        Ok(fiat_shamir_transcript(&points, &[]))
+    }
+
+    /// Third step of the interactive protocol run by the prover. Solves the
+    /// challenge `c` with the secret `x` and the random number `k` used in the
+    /// commitment.
+    pub fn respond(
+        self: &Self,
+        commitment: &Commitment,
+        k: &BigUint,
+        c: &BigUint,
+        x: &BigUint,
+    ) -> Proof {
+        let (_, q, _, _) = get_constants(self);
+
+        Proof {
+            r1: commitment.r1.clone(),
+            r2: commitment.r2.clone(),
+            c: c.clone(),
+            s: solve_zk_challenge_s(x, k, c, &q),
+        }
+    }
+
+    /// Last step of the interactive protocol run by the verifier. Checks that
+    /// the proof answers the commitment and challenge the verifier holds.
+    ///
+    /// ```
+    /// use chaum_pedersen_zkp::Group;
+    ///
+    /// let group = Group::EllipticCurve;
+    /// let (x, y1, y2) = group.generate_key().unwrap();
+    ///
+    /// let (k, commitment) = group.commit().unwrap(); // prover
+    /// let c = group.challenge(); // verifier
+    /// let proof = group.respond(&commitment, &k, &c, &x); // prover
+    ///
+    /// let valid = group.verify_interactive(&y1, &y2, &commitment, &c, &proof);
+    /// assert_eq!(valid, Ok(true));
+    /// ```
+    pub fn verify_interactive(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        commitment: &Commitment,
+        c: &BigUint,
+        proof: &Proof,
+    ) -> Result<bool, Error> {
+        let (answers_commitment, valid) = self.check_interactive(y1, y2, commitment, c, proof)?;
+        Ok(answers_commitment & valid)
+    }
+
+    /// Same as `verify_interactive` but a rejected proof is an error telling
+    /// why, e.g. to tell a bug of the protocol from a forgery in the logs:
+    /// `Error::ChallengeMismatch` if the proof is not an answer to the
+    /// commitment and challenge the verifier holds, `Error::InvalidProof` if
+    /// it is but the response is wrong.
+    pub fn ensure_valid_interactive(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        commitment: &Commitment,
+        c: &BigUint,
+        proof: &Proof,
+    ) -> Result<(), Error> {
+        match self.check_interactive(y1, y2, commitment, c, proof)? {
+            (false, _) => Err(Error::ChallengeMismatch),
+            (true, false) => Err(Error::InvalidProof),
+            (true, true) => Ok(()),
+        }
+    }
+
+    /// Tells if the proof answers the commitment and challenge, and if its
+    /// response is right, both checks being always run.
+    fn check_interactive(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        commitment: &Commitment,
+        c: &BigUint,
+        proof: &Proof,
+    ) -> Result<(bool, bool), Error> {
+        let start = Instant::now();
+        let answers_commitment = proof.r1.ct_eq(&commitment.r1)
+            & proof.r2.ct_eq(&commitment.r2)
+            & ct_eq_biguint(&proof.c, c);
+
+        let (p, _, g, h) = get_constants(self);
+        let result = verify(&proof.r1, &proof.r2, y1, y2, &g, &h, &proof.c, &proof.s, &p);
+        let decision = result.map(|valid| answers_commitment & valid);
+        record_verification(y1, y2, proof, &decision, start.elapsed());
+        Ok((answers_commitment, result?))
+    }
+
+    /// Creates a non-interactive proof of knowledge of `x` by replacing the
+    /// verifier's challenge with the hash of the protocol values
+    /// (Fiat-Shamir).
+    ///
+    /// Returns `Error::Timeout` if `Operation::CreateProof` has a timeout and
+    /// the proof takes longer.
+    pub fn create_proof(self: &Self, x: &BigUint) -> Result<Proof, Error> {
+        let timeout = self.operation_timeout(Operation::CreateProof);
+        if timeout.is_zero() {
+            return self.create_proof_with_rng(x, &mut DefaultRng);
+        }
+
+        let group = self.clone();
+        let mut x = x.clone();
+        timeout::run_with_timeout(timeout, move || {
+            let proof = group.create_proof_with_rng(&x, &mut DefaultRng);
+            zeroize(&mut x);
+            proof
+        })
+    }
+
+    /// Same as `create_proof` but the random number `k` is drawn from `rng`
+    /// instead of the default generator (see `set_default_rng`), e.g. a
+    /// hardware generator or a seeded one to get reproducible proofs in tests.
+    /// Returns an error if `rng` fails to provide the random bytes.
+    pub fn create_proof_with_rng<R: RngCore + CryptoRng>(
+        self: &Self,
+        x: &BigUint,
+        rng: &mut R,
+    ) -> Result<Proof, Error> {
+        self.prove(x, rng, ChallengeParams::default())
+    }
+
+    /// Same as `create_proof` but the random number `k` is derived from the
+    /// secret and `message`, like the nonces of RFC 6979, so the same inputs
+    /// always give the same proof. `k` stays unpredictable to anybody who
+    /// doesn't know `x`, and the proofs verify with `verify_proof`. The
+    /// message is not bound into the proof, use `create_proof_with_context`
+    /// for that.
+    pub fn create_proof_deterministic(
+        self: &Self,
+        x: &BigUint,
+        message: &[u8],
+    ) -> Result<Proof, Error> {
+        let mut rng = NonceRng::new(x, message);
+        self.prove(x, &mut rng, ChallengeParams::default())
+    }
+
+    /// Same as `create_proof` but the challenge is derived with `hash`. The
+    /// proofs only verify with `verify_proof_with_hash` and the same hash.
+    pub fn create_proof_with_hash(
+        self: &Self,
+        x: &BigUint,
+        hash: ChallengeHash,
+    ) -> Result<Proof, Error> {
+        self.prove(x, &mut DefaultRng, ChallengeParams::with_hash(hash))
+    }
+
+    /// Same as `create_proof` but binds `context`, e.g. the name of the
+    /// application, into the challenge so the proof can't be replayed in
+    /// another context. The proofs only verify with
+    /// `verify_proof_with_context` and the same context. An empty context
+    /// leads to the same proofs as `create_proof`.
+    pub fn create_proof_with_context(
+        self: &Self,
+        x: &BigUint,
+        context: &[u8],
+    ) -> Result<Proof, Error> {
+        self.prove(x, &mut DefaultRng, ChallengeParams::with_context(context))
+    }
+
+    /// Returns a fresh random nonce the verifier hands out to a prover for a
+    /// single authentication attempt.
+    pub fn new_nonce(self: &Self) -> Vec<u8> {
+        get_random_array::<NONCE_LENGTH>().to_vec()
+    }
+
+    /// Same as `create_proof` but binds the `nonce` issued by the verifier
+    /// into the challenge, so the proof is only accepted by
+    /// `verify_proof_for_nonce` with the same nonce and can't be replayed once
+    /// the verifier discards it.
+    pub fn create_proof_for_nonce(self: &Self, x: &BigUint, nonce: &[u8]) -> Result<Proof, Error> {
+        let context = nonce_context(nonce);
+        self.prove(x, &mut DefaultRng, ChallengeParams::with_context(&context))
+    }
+
+    /// Same as `create_proof` but binds the creation time `created_at`, in
+    /// seconds, into the challenge. The proof must be serialized with
+    /// `serialize_with_timestamp` and the same time, and verified with
+    /// `verify_proof_with_expiry`, so the timestamp can't be changed to keep
+    /// an old proof alive.
+    pub fn create_proof_with_timestamp(
+        self: &Self,
+        x: &BigUint,
+        created_at: SystemTime,
+    ) -> Result<Proof, Error> {
+        let context = timestamp_context(created_at);
+        self.prove(x, &mut DefaultRng, ChallengeParams::with_context(&context))
+    }
+
+    /// Same as `create_proof` but the challenge is `bits` long instead of the
+    /// length of the order `q` of the group, which makes the verification
+    /// cheaper, e.g. 128 bits for constrained verifiers. A proof can then be
+    /// forged with probability `2^-bits`. Lengths below `MIN_CHALLENGE_BITS`
+    /// or above the one of `q` return `Error::InvalidArguments`.
+    ///
+    /// The length is bound into the challenge but not serialized: the proofs
+    /// only verify with `verify_proof_with_challenge_bits` and the same
+    /// length, so prover and verifier must agree on it.
+    pub fn create_proof_with_challenge_bits(
+        self: &Self,
+        x: &BigUint,
+        bits: usize,
+    ) -> Result<Proof, Error> {
+        self.prove(x, &mut DefaultRng, ChallengeParams::with_bits(bits))
+    }
+
+    /// Returns the number the challenges of `bits` bits are reduced modulo:
+    /// `2^bits`, or the order `q` for full length challenges.
+    fn challenge_modulus(self: &Self, bits: usize) -> Result<BigUint, Error> {
+        let (_, q, _, _) = get_constants(self);
+        if bits < MIN_CHALLENGE_BITS || bits as u64 > q.bits() {
+            return Err(Error::InvalidArguments);
+        }
+        if bits as u64 == q.bits() {
+            return Ok(q);
+        }
+        Ok(BigUint::one() << bits)
+    }
+
+    fn prove<R: RngCore + CryptoRng>(
+        self: &Self,
+        x: &BigUint,
+        rng: &mut R,
+        params: ChallengeParams,
+    ) -> Result<Proof, Error> {
+        let start = Instant::now();
+        let (p, _, g, h) = get_constants(self);
+
+        let (y1, y2) = exponentiates_points(x, &g, &h, &p)?;
+        let (mut k, commitment) = self.commit_with_rng(rng)?;
+        let points = [&g, &h, &y1, &y2, &commitment.r1, &commitment.r2];
+        let c = params.challenge(self, &points)?;
+
+        let proof = self.respond(&commitment, &k, &c, x);
+        zeroize(&mut k);
+        metrics().record_creation(start.elapsed());
+        log::debug!("created {} in group {} for y1 {}", proof, self, y1);
+        Ok(proof)
+    }
+
+    /// Same as `create_proof` but runs in the blocking thread pool of tokio so
+    /// that async callers can give up on it, e.g. with `tokio::select!`.
+    ///
+    /// Note that dropping the returned future only stops waiting for the
+    /// proof: the computation itself can't be interrupted, it keeps running
+    /// until it finishes and then its result is discarded.
+    pub async fn create_proof_async(self: &Self, x: &BigUint) -> Result<Proof, Error> {
+        let group = self.clone();
+        let x = x.clone();
+
+        tokio::task::spawn_blocking(move || group.create_proof(&x))
+            .await
+            .expect("The proof creation task panicked")
+    }
+
+    /// Verifies a proof created with `create_proof` against the public values
+    /// `y1` and `y2`.
+    ///
+    /// All the checks are always run and their results compared in constant
+    /// time, so the verification doesn't stop at the first mismatch. The
+    /// big number arithmetic itself is not constant time though.
+    ///
+    /// Returns `Error::Timeout` if `Operation::Verify` has a timeout and the
+    /// verification takes longer.
+    pub fn verify_proof(self: &Self, y1: &Point, y2: &Point, proof: &Proof) -> Result<bool, Error> {
+        let timeout = self.operation_timeout(Operation::Verify);
+        if timeout.is_zero() {
+            return self.check_proof(y1, y2, proof, ChallengeParams::default());
+        }
+
+        let (group, y1, y2, proof) = (self.clone(), y1.clone(), y2.clone(), proof.clone());
+        timeout::run_with_timeout(timeout, move || {
+            group.check_proof(&y1, &y2, &proof, ChallengeParams::default())
+        })
+    }
+
+    /// Same as `verify_proof` but an invalid proof is an error as well,
+    /// `Error::InvalidProof`, for callers that return both up the stack.
+    pub fn ensure_valid_proof(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+    ) -> Result<(), Error> {
+        match self.verify_proof(y1, y2, proof)? {
+            true => Ok(()),
+            false => Err(Error::InvalidProof),
+        }
+    }
+
+    /// Tells if the proofs `a` and `b` prove the same statement, i.e. if both
+    /// are valid for the public values `y1` and `y2`, e.g. to deduplicate a
+    /// store of proofs. Unlike `==`, it ignores the random commitments that
+    /// make two proofs of the same key differ.
+    pub fn same_statement(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        a: &Proof,
+        b: &Proof,
+    ) -> Result<bool, Error> {
+        let a_valid = self.verify_proof(y1, y2, a)?;
+        let b_valid = self.verify_proof(y1, y2, b)?;
+        Ok(a_valid && b_valid)
+    }
+
+    /// Verifies a proof created with `create_proof_with_hash` and `hash`.
+    pub fn verify_proof_with_hash(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+        hash: ChallengeHash,
+    ) -> Result<bool, Error> {
+        self.check_proof(y1, y2, proof, ChallengeParams::with_hash(hash))
+    }
+
+    /// Verifies a proof created with `create_proof_with_context` and
+    /// `context`.
+    pub fn verify_proof_with_context(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+        context: &[u8],
+    ) -> Result<bool, Error> {
+        self.check_proof(y1, y2, proof, ChallengeParams::with_context(context))
+    }
+
+    /// Verifies a proof created with `create_proof_for_nonce` and `nonce`.
+    pub fn verify_proof_for_nonce(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+        nonce: &[u8],
+    ) -> Result<bool, Error> {
+        let context = nonce_context(nonce);
+        self.check_proof(y1, y2, proof, ChallengeParams::with_context(&context))
+    }
+
+    /// Verifies a proof created with `create_proof_with_timestamp` whose
+    /// header was read with `Proof::deserialize_with_header`. Proofs created
+    /// more than `max_age` ago, or dated more than `max_age` in the future,
+    /// return `Error::Expired`, and proofs without a timestamp
+    /// `Error::MissingTimestamp`.
+    pub fn verify_proof_with_expiry(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        header: &ProofHeader,
+        proof: &Proof,
+        max_age: Duration,
+    ) -> Result<bool, Error> {
+        let created_at = header.created_at.ok_or(Error::MissingTimestamp)?;
+
+        let now = SystemTime::now();
+        let age = match now.duration_since(created_at) {
+            Ok(age) => age,
+            Err(error) => error.duration(),
+        };
+        if age > max_age {
+            return Err(Error::Expired);
+        }
+
+        let context = timestamp_context(created_at);
+        self.check_proof(y1, y2, proof, ChallengeParams::with_context(&context))
+    }
+
+    /// Verifies a proof created with `create_proof_with_challenge_bits` and
+    /// `bits`. The same lengths as there are accepted.
+    pub fn verify_proof_with_challenge_bits(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+        bits: usize,
+    ) -> Result<bool, Error> {
+        self.check_proof(y1, y2, proof, ChallengeParams::with_bits(bits))
+    }
+
+    fn check_proof(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+        params: ChallengeParams,
+    ) -> Result<bool, Error> {
+        let start = Instant::now();
+        let result = self
+            .check_proof_u8(y1, y2, proof, params)
+            .map(|valid| valid == 1);
+        record_verification(y1, y2, proof, &result, start.elapsed());
+        let valid = result?;
+        log::debug!(
+            "verified {} in group {} for y1 {}: valid {}",
+            proof,
+            self,
+            y1,
+            valid
+        );
+        Ok(valid)
+    }
+
+    /// Checks the proof like `check_proof` and returns 1 if it is valid and 0
+    /// otherwise, without recording it anywhere.
+    fn check_proof_u8(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+        params: ChallengeParams,
+    ) -> Result<u8, Error> {
+        let (p, _, g, h) = get_constants(self);
+
+        let points = [&g, &h, y1, y2, &proof.r1, &proof.r2];
+        let c = params.challenge(self, &points)?;
+        // The equations are checked even if the challenge doesn't match so
+        // the time taken doesn't reveal which check failed
+        let valid = verify_u8(&proof.r1, &proof.r2, y1, y2, &g, &h, &proof.c, &proof.s, &p)?;
+        Ok(ct_eq_biguint_u8(&c, &proof.c) & valid)
+    }
+
+    /// Same as `verify_proof` but tells why the proof was rejected, e.g. for
+    /// audit logs. Malformed inputs are reported in the result instead of as
+    /// an error.
+    pub fn verify_proof_detailed(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+    ) -> VerifyResult {
+        let start = Instant::now();
+        let result = self.check_proof_detailed(y1, y2, proof);
+        record_verification(y1, y2, proof, &result.as_result(), start.elapsed());
+        log::debug!(
+            "verified {} in group {} for y1 {}: {}",
+            proof,
+            self,
+            y1,
+            result.code
+        );
+        result
+    }
+
+    fn check_proof_detailed(self: &Self, y1: &Point, y2: &Point, proof: &Proof) -> VerifyResult {
+        let points = [y1, y2, &proof.r1, &proof.r2];
+        if !points.iter().all(|point| self.contains(point)) {
+            return VerifyResult::rejected(RejectCode::Malformed);
+        }
+
+        let (p, q, g, h) = get_constants(self);
+
+        let points = [&g, &h, y1, y2, &proof.r1, &proof.r2];
+        let c = fiat_shamir_challenge(&points, &q, ChallengeHash::default(), &[]);
+        let challenge_matches = ct_eq_biguint(&c, &proof.c);
+
+        match verify(&proof.r1, &proof.r2, y1, y2, &g, &h, &proof.c, &proof.s, &p) {
+            Ok(true) if challenge_matches => VerifyResult {
+                valid: true,
+                code: RejectCode::Accepted,
+            },
+            Ok(_) if !challenge_matches => VerifyResult::rejected(RejectCode::BadCommitment),
+            Ok(_) => VerifyResult::rejected(RejectCode::BadResponse),
+            Err(_) => VerifyResult::rejected(RejectCode::Malformed),
+        }
+    }
+
+    /// Verifies many proofs created with `create_proof`, returning one result
+    /// per `(y1, y2)` and proof pair.
+    pub fn verify_proof_batch(
+        self: &Self,
+        public_keys: &[(Point, Point)],
+        proofs: &[Proof],
+    ) -> Result<Vec<bool>, Error> {
+        if public_keys.len() != proofs.len() {
+            return Err(Error::LengthMismatch);
+        }
+
+        public_keys
+            .iter()
+            .zip(proofs)
+            .map(|((y1, y2), proof)| self.verify_proof(y1, y2, proof))
+            .collect()
+    }
+
+    /// Same as `verify_proof_batch` but tells why each rejected proof was
+    /// rejected, like `verify_proof_detailed`, e.g. to split a batch into the
+    /// proofs to accept and the ones to log and retry. The results are in the
+    /// order of the proofs, and the whole batch passed if all of them are
+    /// valid. Malformed proofs are reported in their result, so only
+    /// `Error::LengthMismatch` is returned as an error.
+    pub fn verify_proof_batch_detailed(
+        self: &Self,
+        public_keys: &[(Point, Point)],
+        proofs: &[Proof],
+    ) -> Result<Vec<VerifyResult>, Error> {
+        if public_keys.len() != proofs.len() {
+            return Err(Error::LengthMismatch);
+        }
+
+        Ok(public_keys
+            .iter()
+            .zip(proofs)
+            .map(|((y1, y2), proof)| self.verify_proof_detailed(y1, y2, proof))
+            .collect())
+    }
+
+    /// Verifies the proof against each of the candidate public values in
+    /// turn, e.g. the keys of a user during account recovery, and returns the
+    /// index of the first one it is valid for, `None` if there is none. Every
+    /// candidate tried takes a full verification whatever the outcome, and
+    /// counts as one in the metrics and the audit log.
+    pub fn verify_proof_any(
+        self: &Self,
+        public_keys: &[(Point, Point)],
+        proof: &Proof,
+    ) -> Result<Option<usize>, Error> {
+        for (i, (y1, y2)) in public_keys.iter().enumerate() {
+            if self.verify_proof(y1, y2, proof)? {
+                return Ok(Some(i));
+            }
+        }
+        Ok(None)
+    }
+
+    /// Same as `verify_proof_batch` but splits the proofs between `workers`
+    /// threads (at least one). Setting `cancel` makes the workers stop
+    /// before their next proof and the call return `Error::Cancelled`.
+    pub fn verify_proof_batch_parallel(
+        self: &Self,
+        public_keys: &[(Point, Point)],
+        proofs: &[Proof],
+        workers: usize,
+        cancel: &AtomicBool,
+    ) -> Result<Vec<bool>, Error> {
+        if public_keys.len() != proofs.len() {
+            return Err(Error::LengthMismatch);
+        }
+        if proofs.is_empty() {
+            return Ok(Vec::new());
+        }
+
+        let chunk = proofs.len().div_ceil(workers.max(1));
+        let results: Vec<Result<Vec<bool>, Error>> = std::thread::scope(|scope| {
+            let handles: Vec<_> = public_keys
+                .chunks(chunk)
+                .zip(proofs.chunks(chunk))
+                .map(|(public_keys, proofs)| {
+                    scope.spawn(move || {
+                        let mut results = Vec::with_capacity(proofs.len());
+                        for ((y1, y2), proof) in public_keys.iter().zip(proofs) {
+                            if cancel.load(Ordering::Relaxed) {
+                                return Err(Error::Cancelled);
+                            }
+                            results.push(self.verify_proof(y1, y2, proof)?);
+                        }
+                        Ok(results)
+                    })
+                })
+                .collect();
+
+            handles
+                .into_iter()
+                .map(|handle| handle.join().expect("A verification worker panicked"))
+                .collect()
+        });
+
+        let mut verified = Vec::with_capacity(proofs.len());
+        for result in results {
+            verified.append(&mut result?);
+        }
+        Ok(verified)
+    }
+
+    /// Verifies many proofs created with `create_proof` at once by checking a
+    /// random linear combination of their verification equations:
+    ///
+    /// sum(a_i * r1_i) = sum(a_i * s_i) * g + sum(a_i * c_i * y1_i)
+    /// sum(a_i * r2_i) = sum(a_i * s_i) * h + sum(a_i * c_i * y2_i)
+    ///
+    /// It returns `true` only if all the proofs are valid, use
+    /// `verify_proof_batch` to find out which ones are not. Each proof counts
+    /// as a verification in the metrics and the audit log, with the result of
+    /// the whole batch. Public values or commitments that are not elements of
+    /// the group return `Error::InvalidPoint`.
+    pub fn verify_proof_batch_fast(
+        self: &Self,
+        public_keys: &[(Point, Point)],
+        proofs: &[Proof],
+    ) -> Result<bool, Error> {
+        if public_keys.len() != proofs.len() {
+            return Err(Error::LengthMismatch);
+        }
+
+        let start = Instant::now();
+        let result = self.check_proof_batch_fast(public_keys, proofs);
+        let elapsed = start.elapsed() / proofs.len().max(1) as u32;
+        for ((y1, y2), proof) in public_keys.iter().zip(proofs) {
+            record_verification(y1, y2, proof, &result, elapsed);
+        }
+        result
+    }
+
+    fn check_proof_batch_fast(
+        self: &Self,
+        public_keys: &[(Point, Point)],
+        proofs: &[Proof],
+    ) -> Result<bool, Error> {
+        let (p, q, g, h) = get_constants(self);
+
+        // an element out of the subgroup, e.g. of order 2, could vanish in the
+        // combination for some weights while a single verification fails
+        for ((y1, y2), proof) in public_keys.iter().zip(proofs) {
+            if ![y1, y2, &proof.r1, &proof.r2]
+                .iter()
+                .all(|point| self.contains(point))
+            {
+                return Err(Error::InvalidPoint);
+            }
+        }
+
+        for ((y1, y2), proof) in public_keys.iter().zip(proofs) {
+            let points = [&g, &h, y1, y2, &proof.r1, &proof.r2];
+            let c = fiat_shamir_challenge(&points, &q, ChallengeHash::default(), &[]);
+            if c != proof.c {
+                return Ok(false);
+            }
+        }
+
+        let a: Vec<BigUint> = proofs
+            .iter()
+            .map(|_| BigUint::from_bytes_be(&get_random_array::<16>()))
+            .collect();
+        let ac: Vec<BigUint> = a
+            .iter()
+            .zip(proofs)
+            .map(|(a, proof)| a * &proof.c)
+            .collect();
+        let s: BigUint = a.iter().zip(proofs).map(|(a, proof)| a * &proof.s).sum();
+
+        let mut lhs1: Vec<(&Point, &BigUint)> = Vec::new();
+        let mut lhs2: Vec<(&Point, &BigUint)> = Vec::new();
+        let mut rhs1: Vec<(&Point, &BigUint)> = vec![(&g, &s)];
+        let mut rhs2: Vec<(&Point, &BigUint)> = vec![(&h, &s)];
+        for (i, ((y1, y2), proof)) in public_keys.iter().zip(proofs).enumerate() {
+            lhs1.push((&proof.r1, &a[i]));
+            lhs2.push((&proof.r2, &a[i]));
+            rhs1.push((y1, &ac[i]));
+            rhs2.push((y2, &ac[i]));
+        }
+
+        Ok(multi_exponentiation_equal(&lhs1, &rhs1, &p)?
+            && multi_exponentiation_equal(&lhs2, &rhs2, &p)?)
+    }
+}
+
+/// Checks that the products of `point^exp` of both sides are equal (sums of
+/// `exp * point` for elliptic curves).
+fn multi_exponentiation_equal(
+    lhs: &[(&Point, &BigUint)],
+    rhs: &[(&Point, &BigUint)],
+    p: &BigUint,
+) -> Result<bool, Error> {
+    let all_scalar = lhs
+        .iter()
+        .chain(rhs)
+        .all(|(point, _)| matches!(point, Point::Scalar(_)));
+    let all_ec = lhs
+        .iter()
+        .chain(rhs)
+        .all(|(point, _)| matches!(point, Point::ECPoint(..)));
+
+    if all_scalar {
+        Ok(multi_exponentiation_scalar(lhs, p) == multi_exponentiation_scalar(rhs, p))
+    } else if all_ec {
+        let on_curve = lhs.iter().chain(rhs).all(|(point, _)| match point {
+            Point::ECPoint(x, y) => is_on_curve(x, y),
+            _ => false,
+        });
+        if !on_curve {
+            return Err(Error::InvalidPoint);
+        }
+        Ok(multi_exponentiation_elliptic_curve(lhs) == multi_exponentiation_elliptic_curve(rhs))
+    } else {
+        Err(Error::InvalidArguments)
+    }
+}
+
+/// Computes the bits of every exponent of a multi-exponentiation, most
+/// significant first and padded to the same length.
+fn exponent_bits(exps: &[&BigUint]) -> Vec<Vec<bool>> {
+    let bytes: Vec<Vec<u8>> = exps.iter().map(|exp| exp.to_bytes_be()).collect();
+    let len = bytes.iter().map(|b| b.len()).max().unwrap_or(0);
+
+    bytes
+        .iter()
+        .map(|b| {
+            let mut padded = vec![0u8; len - b.len()];
+            padded.extend_from_slice(b);
+            padded
+                .iter()
+                .flat_map(|byte| (0..8).rev().map(move |i| (byte >> i) & 1 == 1))
+                .collect()
+        })
+        .collect()
+}
+
+/// Computes prod(base_i^exp_i) mod p sharing the squarings between all the
+/// bases (Straus' method).
+fn multi_exponentiation_scalar(terms: &[(&Point, &BigUint)], p: &BigUint) -> BigUint {
+    let bits = exponent_bits(&terms.iter().map(|(_, exp)| *exp).collect::<Vec<_>>());
+    let len = bits.iter().map(|b| b.len()).max().unwrap_or(0);
+
+    let mut result = BigUint::one();
+    for i in 0..len {
+        result = (&result * &result) % p;
+        for ((point, _), bits) in terms.iter().zip(&bits) {
+            if let (Point::Scalar(base), true) = (point, bits[i]) {
+                result = (result * base) % p;
+            }
+        }
+    }
+    result
+}
+
+/// Computes sum(exp_i * point_i) sharing the doublings between all the points
+/// (Straus' method).
+fn multi_exponentiation_elliptic_curve(terms: &[(&Point, &BigUint)]) -> Secp256k1Point {
+    let bits = exponent_bits(&terms.iter().map(|(_, exp)| *exp).collect::<Vec<_>>());
+    let len = bits.iter().map(|b| b.len()).max().unwrap_or(0);
+
+    let points: Vec<Secp256k1Point> = terms
+        .iter()
+        .map(|(point, _)| match point {
+            Point::ECPoint(x, y) => Secp256k1Point::from_bigint(x, y),
+            _ => Secp256k1Point::Zero,
+        })
+        .collect();
+
+    let mut result = Secp256k1Point::Zero;
+    for i in 0..len {
+        result = result.clone() + result;
+        for (point, bits) in points.iter().zip(&bits) {
+            if bits[i] {
+                result = result + point.clone();
+            }
+        }
+    }
+    result
+}
+
+/// Largest order of the groups, in bits, whose keys can be derived from a
+/// seed: each of the SHA-256 blocks of `hash_seed_to_number` is numbered
+/// with a byte.
+pub const MAX_SEED_KEY_BITS: u64 = 255 * 256 - 128;
+
+/// Stretches a seed into a number of at least 512 bits and 128 bits more than
+/// the order of the group, of `bits` bits, so that reducing it modulo the order
+/// has a negligible bias.
+fn hash_seed_to_number(seed: &[u8], counter: u32, bits: u64) -> BigUint {
+    let blocks = (bits + 128).div_ceil(256).max(2) as u8;
+    let mut v = Vec::new();
+    for block in 0..blocks {
+        let digest = Sha256::new()
+            .chain_update(b"chaum-pedersen-zkp key")
+            .chain_update(counter.to_be_bytes())
+            .chain_update([block])
+            .chain_update(seed)
+            .finalize();
+        v.extend_from_slice(&digest);
+    }
+
+    BigUint::from_bytes_be(&v)
+}
+
+/// Generator of the random numbers `k` of `Group::create_proof_deterministic`:
+/// the SHA-256 digests of a seed, hashed from the secret and the message, and
+/// a counter.
+struct NonceRng {
+    seed: [u8; 32],
+    counter: u32,
+}
+
+impl NonceRng {
+    fn new(x: &BigUint, message: &[u8]) -> NonceRng {
+        let mut v = Vec::new();
+        write_length_prefixed(&mut v, &x.to_bytes_be());
+        write_length_prefixed(&mut v, message);
+
+        let seed = Sha256::new()
+            .chain_update(b"chaum-pedersen-zkp deterministic nonce")
+            .chain_update(&v)
+            .finalize()
+            .into();
+        v.fill(0);
+
+        NonceRng { seed, counter: 0 }
+    }
+}
+
+impl RngCore for NonceRng {
+    fn next_u32(&mut self) -> u32 {
+        let mut bytes = [0u8; 4];
+        self.fill_bytes(&mut bytes);
+        u32::from_be_bytes(bytes)
+    }
+
+    fn next_u64(&mut self) -> u64 {
+        let mut bytes = [0u8; 8];
+        self.fill_bytes(&mut bytes);
+        u64::from_be_bytes(bytes)
+    }
+
+    fn fill_bytes(&mut self, dest: &mut [u8]) {
+        for chunk in dest.chunks_mut(32) {
+            let digest = Sha256::new()
+                .chain_update(self.seed)
+                .chain_update(self.counter.to_be_bytes())
+                .finalize();
+            chunk.copy_from_slice(&digest[..chunk.len()]);
+            self.counter += 1;
+        }
+    }
+
+    fn try_fill_bytes(&mut self, dest: &mut [u8]) -> Result<(), rand::Error> {
+        self.fill_bytes(dest);
+        Ok(())
+    }
+}
+
+impl CryptoRng for NonceRng {}
+
+impl Drop for NonceRng {
+    fn drop(&mut self) {
+        self.seed.zeroize();
+    }
+}
+
+/// Length in bytes of the nonces created by `Group::new_nonce`.
+const NONCE_LENGTH: usize = 32;
+
+/// Labels a nonce so that it never collides with a context of
+/// `create_proof_with_context`.
+fn nonce_context(nonce: &[u8]) -> Vec<u8> {
+    let mut v = Vec::new();
+    write_length_prefixed(&mut v, b"nonce");
+    write_length_prefixed(&mut v, nonce);
+    v
+}
+
+/// Labels the creation time of a proof, in seconds since the Unix epoch like in
+/// the headers, so that it never collides with other contexts.
+fn timestamp_context(created_at: SystemTime) -> Vec<u8> {
+    let secs = created_at
+        .duration_since(UNIX_EPOCH)
+        .map_or(0, |elapsed| elapsed.as_secs());
+
+    let mut v = Vec::new();
+    write_length_prefixed(&mut v, b"timestamp");
+    write_length_prefixed(&mut v, &secs.to_be_bytes());
+    v
+}
+
+/// Labels the length of the challenges of `create_proof_with_challenge_bits`,
+/// so that proofs of different lengths never verify for each other.
+fn challenge_bits_context(bits: usize) -> Vec<u8> {
+    let mut v = Vec::new();
+    write_length_prefixed(&mut v, b"challenge bits");
+    write_length_prefixed(&mut v, &(bits as u32).to_be_bytes());
+    v
+}
+
+/// Derivation of the challenges of the non-interactive proofs: the hash, the
+/// context bound into them and their length in bits, the one of `q` unless
+/// set by `Group::create_proof_with_challenge_bits`.
+#[derive(Debug, Clone, Copy, Default)]
+struct ChallengeParams<'a> {
+    hash: ChallengeHash,
+    context: &'a [u8],
+    bits: Option<usize>,
+}
+
+impl<'a> ChallengeParams<'a> {
+    fn with_hash(hash: ChallengeHash) -> ChallengeParams<'a> {
+        ChallengeParams {
+            hash,
+            ..Default::default()
+        }
+    }
+
+    fn with_context(context: &'a [u8]) -> ChallengeParams<'a> {
+        ChallengeParams {
+            context,
+            ..Default::default()
+        }
+    }
+
+    fn with_bits(bits: usize) -> ChallengeParams<'a> {
+        ChallengeParams {
+            bits: Some(bits),
+            ..Default::default()
+        }
+    }
+
+    /// Derives the challenge of the points of a proof of `group`. A shortened
+    /// challenge is reduced modulo `2^bits` and has its length labeled
+    /// before the context. Returns `Error::InvalidArguments` for the hashes
+    /// and lengths `group` doesn't support.
+    fn challenge(self: &Self, group: &Group, points: &[&Point]) -> Result<BigUint, Error> {
+        self.hash.check()?;
+        match self.bits {
+            None => {
+                let (_, q, _, _) = get_constants(group);
+                Ok(fiat_shamir_challenge(points, &q, self.hash, self.context))
+            }
+            Some(bits) => {
+                let modulus = group.challenge_modulus(bits)?;
+                let context = [challenge_bits_context(bits), self.context.to_vec()].concat();
+                Ok(fiat_shamir_challenge(points, &modulus, self.hash, &context))
+            }
+        }
+    }
+}
+
+/// Computes the Fiat-Shamir challenge as the hash of the transcript of
+/// `fiat_shamir_transcript`, reduced modulo the order `q` of the group.
+fn fiat_shamir_challenge(
+    points: &[&Point],
+    q: &BigUint,
+    hash: ChallengeHash,
+    context: &[u8],
+) -> BigUint {
+    let v = fiat_shamir_transcript(points, context);
+    BigUint::from_bytes_be(&hash.digest(&v)) % q
+}
+
+impl ChallengeHash {
+    fn digest(self: &Self, v: &[u8]) -> Vec<u8> {
+        match self {
+            ChallengeHash::Sha256 => Sha256::digest(v).to_vec(),
+            ChallengeHash::Sha512 => Sha512::digest(v).to_vec(),
+            ChallengeHash::Sha3_256 => Sha3_256::digest(v).to_vec(),
+            ChallengeHash::Sha256Iterated(iterations) => {
+                let mut digest = Sha256::digest(v);
+                for _ in 1..*iterations {
+                    digest = Sha256::digest(digest);
+                }
+                digest.to_vec()
+            }
+        }
+    }
+
+    /// Returns `Error::InvalidArguments` for the counts of hashes out of range.
+    fn check(self: &Self) -> Result<(), Error> {
+        match self {
+            ChallengeHash::Sha256Iterated(0) => Err(Error::InvalidArguments),
+            ChallengeHash::Sha256Iterated(iterations) if *iterations > MAX_HASH_ITERATIONS => {
+                Err(Error::InvalidArguments)
+            }
+            _ => Ok(()),
+        }
+    }
+}
+
+/// Tells if a secret reduced modulo `q` is 0 or 1, whose public values are
+/// the identity or the generators themselves.
+fn is_weak_secret(x: &BigUint) -> bool {
+    x.is_zero() || x.is_one()
+}
+
+/// Writes the serialized points, followed by the context if there is one, each
+/// with its length.
+fn fiat_shamir_transcript(points: &[&Point], context: &[u8]) -> Vec<u8> {
+    let mut v = Vec::new();
+    let mut buffer = Vec::new();
+    for point in points {
+        point.serialize_into(&mut buffer);
+        write_length_prefixed(&mut v, &buffer);
+    }
+    if !context.is_empty() {
+        write_length_prefixed(&mut v, context);
+    }
+    v
+}
+
+/// Returns the first 8 bytes of the SHA-256 digest of the data as hex.
+fn fingerprint(data: &[u8]) -> String {
+    hex::encode(&Sha256::digest(data)[..8])
+}
+
+/// Counts the verification of `proof` in the metrics and the audit log.
+fn record_verification(
+    y1: &Point,
+    y2: &Point,
+    proof: &Proof,
+    result: &Result<bool, Error>,
+    elapsed: Duration,
+) {
+    metrics().record_verification(result, elapsed);
+    audit::record_verification(y1, y2, proof, result);
+}
+
+/// Overwrites the digits of `n` in place before releasing them, leaving it
+/// equal to zero. Use it on secrets like `x` once they aren't needed anymore.
+///
+/// `num-bigint` doesn't give access to the spare capacity of its buffers, so
+/// only the digits of the number are overwritten. The Scalars, which hold the
+/// secrets of the library, keep their number in a buffer of its exact size,
+/// so that it is the whole of it for them. Copies made before (clones,
+/// serialized bytes or temporary values of the arithmetic operations) are not
+/// covered and may remain in memory.
+pub fn zeroize(n: &mut BigUint) {
+    // Zero digits would be truncated and the buffer freed, which lets the
+    // compiler drop the writes: ones are written and read back instead.
+    let len = n.bits().div_ceil(32) as usize;
+    n.assign_from_slice(&vec![u32::MAX; len]);
+    std::hint::black_box(&*n);
+    *n = BigUint::zero();
+}
+
+/// Compares two numbers without branching on the values of their bytes. The
+/// shorter one is padded with leading zeros so only the lengths can leak.
+fn ct_eq_biguint(a: &BigUint, b: &BigUint) -> bool {
+    ct_eq_biguint_u8(a, b) == 1
+}
+
+/// Same as `ct_eq_biguint` but returns 1 for equal numbers and 0 otherwise,
+/// computed without comparing, for the decisions that are never turned into
+/// a `bool` (see `Choice`).
+fn ct_eq_biguint_u8(a: &BigUint, b: &BigUint) -> u8 {
+    let a = a.to_bytes_be();
+    let b = b.to_bytes_be();
+    let len = a.len().max(b.len());
+
+    let mut diff = 0u8;
+    for i in 0..len {
+        let x = if i + a.len() >= len {
+            a[i + a.len() - len]
+        } else {
+            0
+        };
+        let y = if i + b.len() >= len {
+            b[i + b.len() - len]
+        } else {
+            0
+        };
+        diff |= x ^ y;
+    }
+    // the borrow of diff - 1 sets the high byte only when diff is zero
+    (((diff as u16).wrapping_sub(1) >> 8) & 1) as u8
+}
+
+/// Length of the big-endian bytes of `n` given by `to_bytes_be`.
+fn be_bytes_len(n: &BigUint) -> usize {
+    (n.bits().div_ceil(8) as usize).max(1)
+}
+
+/// Returns `n` as big-endian bytes padded with leading zeros to `len`, or
+/// longer if it doesn't fit.
+fn padded_be_bytes(n: &BigUint, len: usize) -> Vec<u8> {
+    let mut v = Vec::new();
+    write_be_bytes(&mut v, n, len.max(be_bytes_len(n)));
+    v
+}
+
+/// Returns the lengths of the points and of the numbers `c` and `s` of the
+/// proofs of `group` in `Proof::serialize_raw`.
+fn proof_field_lengths(group: &Group) -> (usize, usize) {
+    let (p, q, _, _) = get_constants(group);
+    match group.kind() {
+        GroupKind::EllipticCurve => (2 * be_bytes_len(&p), be_bytes_len(&q)),
+        GroupKind::Scalar | GroupKind::Custom(_) => (be_bytes_len(&p), be_bytes_len(&q)),
+    }
+}
+
+/// Appends the big-endian bytes of `n` to `v`, padded with leading zeros to
+/// `len` bytes, without allocating anything but the growth of `v`.
+fn write_be_bytes(v: &mut Vec<u8>, n: &BigUint, len: usize) {
+    let start = v.len();
+    v.resize(start + len, 0);
+    for (i, digit) in n.iter_u32_digits().enumerate() {
+        for (j, byte) in digit.to_le_bytes().into_iter().enumerate() {
+            // byte k, counting from the least significant one
+            let k = 4 * i + j;
+            if k < len {
+                v[start + len - 1 - k] = byte;
+            }
+        }
+    }
+}
+
+fn write_length_prefixed(v: &mut Vec<u8>, bytes: &[u8]) {
+    v.extend_from_slice(&(bytes.len() as u32).to_be_bytes());
+    v.extend_from_slice(bytes);
+}
+
+fn read_length_prefixed<'a>(data: &mut &'a [u8]) -> Result<&'a [u8], Error> {
+    if data.len() < 4 {
+        return Err(Error::InvalidSerialization);
+    }
+
+    let (len, rest) = data.split_at(4);
+    let len = u32::from_be_bytes([len[0], len[1], len[2], len[3]]) as usize;
+
+    if rest.len() < len {
+        return Err(Error::InvalidSerialization);
+    }
+
+    let (bytes, rest) = rest.split_at(len);
+    *data = rest;
+    Ok(bytes)
+}
+
+/// Exponenciates two points g & h:
+///  - For the integer or scalar group the new ones are: g^exp & h^exp
+///  - For the elliptic curve group the new ones are: exp * g & exp * h
+pub fn exponentiates_points(
+    exp: &BigUint,
+    g: &Point,
+    h: &Point,
+    p: &BigUint,
+) -> Result<(Point, Point), Error> {
+    match (g, h) {
+        (Point::Scalar(g), Point::Scalar(h)) => Ok(exponentiates_points_scalar(exp, g, h, p)),
+        (Point::ECPoint(gx, gy), Point::ECPoint(hx, hy)) => {
+            // The points of the curve are checked here since the secp256k1
+            // library panics on invalid ones and on the point at infinity
+            if !is_on_curve(gx, gy) || !is_on_curve(hx, hy) {
+                return Err(Error::InvalidPoint);
+            }
+            if (exp % Secp256k1Point::n()).is_zero() {
+                return Err(Error::InvalidSecret);
+            }
+            Ok(exponentiates_points_elliptic_curve(exp, gx, gy, hx, hy))
+        }
+        _ => Err(Error::InvalidArguments),
+    }
+}
+
+/// Checks that `(x, y)` is a point of the secp256k1 curve `y^2 = x^3 + 7`.
+fn is_on_curve(x: &BigUint, y: &BigUint) -> bool {
+    let p = Secp256k1Point::prime();
+    *x < p && *y < p && (y * y) % &p == (x * x * x + 7u32) % &p
+}
+
+pub fn exponentiates_points_scalar(
+    exp: &BigUint,
+    g: &BigUint,
+    h: &BigUint,
+    p: &BigUint,
+) -> (Point, Point) {
+    (
+        Point::Scalar(g.modpow(exp, p)),
+        Point::Scalar(h.modpow(exp, p)),
+    )
+}
+
+pub fn exponentiates_points_elliptic_curve(
+    exp: &BigUint,
+    gx: &BigUint,
+    gy: &BigUint,
+    hx: &BigUint,
+    hy: &BigUint,
+) -> (Point, Point) {
+    let g = Secp256k1Point::from_bigint(&gx, &gy);
+    let h = Secp256k1Point::from_bigint(&hx, &hy);
+
+    let g = g.scale(exp.clone());
+    let h = h.scale(exp.clone());
+
+    let g_new = match g {
+        secp256k1::Point::Coor { x, y, .. } => Point::ECPoint(x.number, y.number),
+        _ => panic!("You reach the Zero in elliptic curve multiplication"),
+    };
+
+    let h_new = match h {
+        secp256k1::Point::Coor { x, y, .. } => Point::ECPoint(x.number, y.number),
+        _ => panic!("You reach the Zero in elliptic curve multiplication"),
+    };
+
+    (g_new, h_new)
+}
+
+/// This function solves the ZK challenge `s` proposed by the verifier.
+///
+/// s = (k - c * x) mod q
+///
+/// * `x_secret` - secret password.
+/// * `k` - random number selected by the prover.
+/// * `c` - random number selected by the verifier.
+/// * `q` - the order of the cyclic group
+pub fn solve_zk_challenge_s(x_secret: &BigUint, k: &BigUint, c: &BigUint, q: &BigUint) -> BigUint {
+    let cx = c * x_secret;
+    if *k > cx {
+        (k - cx).modpow(&BigUint::one(), q)
+    } else {
+        q - (cx - k).modpow(&BigUint::one(), q)
+    }
+}
+
+pub fn verify(
+    r1: &Point,
+    r2: &Point,
+    y1: &Point,
+    y2: &Point,
+    g: &Point,
+    h: &Point,
+    c: &BigUint,
+    s: &BigUint,
+    p: &BigUint,
+) -> Result<bool, Error> {
+    verify_u8(r1, r2, y1, y2, g, h, c, s, p).map(|valid| valid == 1)
+}
+
+/// Same as `verify` but returns 1 for a valid proof and 0 otherwise.
+fn verify_u8(
+    r1: &Point,
+    r2: &Point,
+    y1: &Point,
+    y2: &Point,
+    g: &Point,
+    h: &Point,
+    c: &BigUint,
+    s: &BigUint,
+    p: &BigUint,
+) -> Result<u8, Error> {
+    match (r1, r2, y1, y2, g, h) {
+        (
+            Point::Scalar(r1),
+            Point::Scalar(r2),
+            Point::Scalar(y1),
+            Point::Scalar(y2),
+            Point::Scalar(g),
+            Point::Scalar(h),
+        ) => Ok(verify_scalar_u8(r1, r2, y1, y2, g, h, c, s, p)),
+        (
+            Point::ECPoint(r1x, r1y),
+            Point::ECPoint(r2x, r2y),
+            Point::ECPoint(y1x, y1y),
+            Point::ECPoint(y2x, y2y),
+            Point::ECPoint(gx, gy),
+            Point::ECPoint(hx, hy),
+        ) => {
+            let points = [
+                (r1x, r1y),
+                (r2x, r2y),
+                (y1x, y1y),
+                (y2x, y2y),
+                (gx, gy),
+                (hx, hy),
+            ];
+            if !points.iter().all(|(x, y)| is_on_curve(x, y)) {
+                return Err(Error::InvalidPoint);
+            }
+            Ok(verify_ecpoint_u8(
+                r1x, r1y, r2x, r2y, y1x, y1y, y2x, y2y, gx, gy, hx, hy, c, s,
+            ))
+        }
+        _ => Err(Error::InvalidArguments),
+    }
+}
+
+/// This function verifies that the challenge `s` was properly solved by the
+/// prover for integer cyclic groups.
+/// r1 = g^s * y1^c && r2 = h^s * y2^c
+///
+/// * `r1` - g^k generated by the prover.
+/// * `r2` - h^k generated by the prover.
+/// * `y1` - g^x generated by the prover.
+/// * `y2` - h^x generated by the prover.
+/// * `g` - predefined element of the cyclic group.
+/// * `h` - predefined element of the cyclic group (g^n mod q ?).
+/// * `c` - random number generated by the verifier.
+/// * `s` - solution to the challenge computed by the prover.
+/// * `p` - the prime number used to defined the cyclic group.
+pub fn verify_scalar(
+    r1: &BigUint,
+    r2: &BigUint,
+    y1: &BigUint,
+    y2: &BigUint,
+    g: &BigUint,
+    h: &BigUint,
+    c: &BigUint,
+    s: &BigUint,
+    p: &BigUint,
+) -> bool {
+    verify_scalar_u8(r1, r2, y1, y2, g, h, c, s, p) == 1
+}
+
+fn verify_scalar_u8(
+    r1: &BigUint,
+    r2: &BigUint,
+    y1: &BigUint,
+    y2: &BigUint,
+    g: &BigUint,
+    h: &BigUint,
+    c: &BigUint,
+    s: &BigUint,
+    p: &BigUint,
+) -> u8 {
+    let condition_1 = ct_eq_biguint_u8(r1, &((g.modpow(s, p) * y1.modpow(c, p)) % p));
+    let condition_2 = ct_eq_biguint_u8(r2, &((h.modpow(s, p) * y2.modpow(c, p)) % p));
+    condition_1 & condition_2
+}
+
+/// This function verifies that the challenge `s` was properly solved by the
+/// prover for elliptic curves cyclic group (secp256k1).
+/// r1 = s * g + c * y1 && r2 = s * h + c * y2
+///
+/// * `r1x` - x coordinate of k * g generated by the prover.
+/// * `r1y` - y coordinate of k * g generated by the prover.
+/// * `r2x` - x coordinate of k * h generated by the prover.
+/// * `r2y` - y coordinate of k * h generated by the prover.
+/// * `y1x` - x coordinate of x * g generated by the prover.
+/// * `y1y` - y coordinate of x * g generated by the prover.
+/// * `y2x` - x coordinate of x * h generated by the prover.
+/// * `y2y` - x coordinate of x * h generated by the prover.
+/// * `gx` - x coordinate of predefined point of the cyclic group.
+/// * `gy` - y coordinate of predefined point of the cyclic group.
+/// * `hx` - x coordinate of predefined point of the cyclic group.
+/// * `hy` - y coordinate of predefined point of the cyclic group.
+/// * `c` - random number generated by the verifier.
+/// * `s` - solution to the challenge computed by the prover.
+/// * `p` - the prime number used to defined the cyclic group.
+pub fn verify_ecpoint(
+    r1x: &BigUint,
+    r1y: &BigUint,
+    r2x: &BigUint,
+    r2y: &BigUint,
+    y1x: &BigUint,
+    y1y: &BigUint,
+    y2x: &BigUint,
+    y2y: &BigUint,
+    gx: &BigUint,
+    gy: &BigUint,
+    hx: &BigUint,
+    hy: &BigUint,
+    c: &BigUint,
+    s: &BigUint,
+) -> bool {
+    verify_ecpoint_u8(r1x, r1y, r2x, r2y, y1x, y1y, y2x, y2y, gx, gy, hx, hy, c, s) == 1
+}
+
+fn verify_ecpoint_u8(
+    r1x: &BigUint,
+    r1y: &BigUint,
+    r2x: &BigUint,
+    r2y: &BigUint,
+    y1x: &BigUint,
+    y1y: &BigUint,
+    y2x: &BigUint,
+    y2y: &BigUint,
+    gx: &BigUint,
+    gy: &BigUint,
+    hx: &BigUint,
+    hy: &BigUint,
+    c: &BigUint,
+    s: &BigUint,
+) -> u8 {
+    let g = Secp256k1Point::from_bigint(&gx, &gy);
+    let h = Secp256k1Point::from_bigint(&hx, &hy);
+    let y1 = Secp256k1Point::from_bigint(&y1x, &y1y);
+    let y2 = Secp256k1Point::from_bigint(&y2x, &y2y);
+    let r1 = Secp256k1Point::from_bigint(&r1x, &r1y);
+    let r2 = Secp256k1Point::from_bigint(&r2x, &r2y);
+
+    let sg = g.scale(s.clone());
+    let sh = h.scale(s.clone());
+    let cy1 = y1.scale(c.clone());
+    let cy2 = y2.scale(c.clone());
+
+    ct_eq_secp256k1_u8(&r1, &(sg + cy1)) & ct_eq_secp256k1_u8(&r2, &(sh + cy2))
+}
+
+/// Compares two points of the `secp256k1` library with `ct_eq_biguint`.
+fn ct_eq_secp256k1(a: &Secp256k1Point, b: &Secp256k1Point) -> bool {
+    ct_eq_secp256k1_u8(a, b) == 1
+}
+
+fn ct_eq_secp256k1_u8(a: &Secp256k1Point, b: &Secp256k1Point) -> u8 {
+    match (a, b) {
+        (Secp256k1Point::Coor { x: x1, y: y1, .. }, Secp256k1Point::Coor { x: x2, y: y2, .. }) => {
+            ct_eq_biguint_u8(&x1.number, &x2.number) & ct_eq_biguint_u8(&y1.number, &y2.number)
+        }
+        (Secp256k1Point::Zero, Secp256k1Point::Zero) => 1,
+        _ => 0,
+    }
+}
+
+/// Checks that the random number generator of the operating system, which
+/// seeds the one of the keys, is ready. On Linux the check waits until the
+/// kernel pool is initialized, e.g. on a freshly booted VM, so bound it with a
+/// timeout if needed as `Group::generate_key_timeout` does. Returns
+/// `Error::InsufficientEntropy` if the generator is unavailable.
+pub fn check_entropy() -> Result<(), Error> {
+    let mut bytes = [0u8; 32];
+    rand::rngs::OsRng
+        .try_fill_bytes(&mut bytes)
+        .map_err(|_| Error::InsufficientEntropy)
+}
+
+/// Sets the size in bytes above which serialized inputs are rejected with
+/// `Error::SizeLimitExceeded`, before anything is allocated for them. The
+/// limit applies to all the deserializations and to the frames of the stream
+/// readers of the process. It is `DEFAULT_MAX_SERIALIZED_SIZE` unless changed
+/// and can be set at any time.
+pub fn set_max_serialized_size(n: usize) {
+    MAX_SERIALIZED_SIZE.store(n, Ordering::Relaxed);
+}
+
+/// Returns the size limit of the serialized inputs, see
+/// `set_max_serialized_size`.
+pub fn max_serialized_size() -> usize {
+    MAX_SERIALIZED_SIZE.load(Ordering::Relaxed)
+}
+
+fn check_serialized_size(len: usize) -> Result<(), Error> {
+    if len > max_serialized_size() {
+        return Err(Error::SizeLimitExceeded);
+    }
+    Ok(())
+}
+
+/// Generates a random array of bytes which can be use as a secret.
+///
+/// Warning: Don't use it for production purposes. Better pseudo random
+/// generators should be used.
+pub fn get_random_array<const BYTES: usize>() -> [u8; BYTES] {
+    let mut arr = [0u8; BYTES];
+    DefaultRng
+        .try_fill(&mut arr[..])
+        .expect("Fail to generate array of random number.");
+    return arr;
+}
+
+/// Generates a 32-bytes random number
+///
+/// Warning: Don't use it for production purposes.
+pub fn get_random_number() -> BigUint {
+    BigUint::from_bytes_be(&get_random_array::<32>())
+}
+
+/// Generates a random string of any length. It is useful to generates user or
+/// session IDs.
+pub fn get_random_string(n: usize) -> String {
+    DefaultRng
+        .sample_iter(&Alphanumeric)
+        .take(n)
+        .map(char::from)
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    // Note this useful idiom: importing names from outer (for mod tests) scope.
+    use super::*;
+    use num::traits::ToPrimitive;
+    use rand::thread_rng;
+
+    #[test]
+    fn test_get_random_array() {
+        let a = get_random_array::<32>();
+        let b = get_random_array::<32>();
+        let c = get_random_array::<32>();
+        let d = get_random_array::<32>();
+        assert_ne!(a, b);
+        assert_ne!(b, c);
+        assert_ne!(c, d);
+    }
+
+    #[test]
+    fn test_get_random_number() {
+        let a = get_random_number();
+        let b = get_random_number();
+        let c = get_random_number();
+        let d = get_random_number();
+        assert_ne!(a, b);
+        assert_ne!(b, c);
+        assert_ne!(c, d);
+    }
+
+    #[test]
+    fn test_exponentiates_points_scalar() {
+        let p = BigUint::from(10009u32);
+        let g = BigUint::from(3u32);
+        let h = BigUint::from(2892u32);
+
+        let secret = BigUint::from(300u32);
+
+        let (y1, y2) = exponentiates_points_scalar(&secret, &g, &h, &p);
+
+        assert_eq!(y1, Point::Scalar(BigUint::from(6419u32)));
+        assert_eq!(y2, Point::Scalar(BigUint::from(4984u32)));
+    }
+
+    #[test]
+    fn test_solve_zk_challenge_s() {
+        // test positive k - cx
+        let x = BigUint::from(3u32);
+        let c = BigUint::from(3u32);
+        let k = BigUint::from(10u32);
+        let q = BigUint::from(10u32);
+
+        // s = 10 - 3 * 3 mod 10 = 1
+        assert_eq!(solve_zk_challenge_s(&x, &k, &c, &q), BigUint::one());
+
+        // test negative k - cx
+        let x = BigUint::from(4u32);
+        let c = BigUint::from(3u32);
+        let k = BigUint::from(10u32);
+        let q = BigUint::from(10u32);
+
+        // s = 10 - 3 * 4 mod 10 = 8
+        assert_eq!(solve_zk_challenge_s(&x, &k, &c, &q), BigUint::from(8u32));
+    }
+
+    #[test]
+    fn test_verify_scalar_success_toy_example_1() {
+        let p = BigUint::from(10009u32);
+        let q = (&p - BigUint::one()) / BigUint::from(2u32);
+
+        let x = BigUint::from(300u32);
+        let g = Point::Scalar(BigUint::from(3u32));
+        let h = Point::Scalar(BigUint::from(2892u32));
+
+        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+
+        let k = BigUint::from(10u32);
+        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+
+        let c = BigUint::from(894u32);
+
+        let s = solve_zk_challenge_s(&x, &k, &c, &q);
+
+        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
+        assert!(verification)
+    }
+
+    #[test]
+    fn test_verify_scalar_success_toy_example_2() {
+        let p = BigUint::from(23u32);
+        let q = BigUint::from(11u32);
+
+        let x = BigUint::from(6u32);
+        let g = Point::Scalar(BigUint::from(4u32));
+        let h = Point::Scalar(BigUint::from(9u32));
+
+        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+
+        assert_eq!(y1, Point::Scalar(BigUint::from(2u32)));
+        assert_eq!(y2, Point::Scalar(BigUint::from(3u32)));
+
+        let k = BigUint::from(7u32);
+        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+
+        assert_eq!(r1, Point::Scalar(BigUint::from(8u32)));
+        assert_eq!(r2, Point::Scalar(BigUint::from(4u32)));
+
+        let c = BigUint::from(4u32);
+
+        let s = solve_zk_challenge_s(&x, &k, &c, &q);
+        assert_eq!(s, BigUint::from(5u32));
+
+        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
+        assert!(verification)
+    }
+
+    #[test]
+    fn test_verify_scalar_failure_toy_example_1() {
+        let p = BigUint::from(23u32);
+        let q = BigUint::from(11u32);
+
+        let x = BigUint::from(6u32);
+
+        let g = Point::Scalar(BigUint::from(4u32));
+        let h = Point::Scalar(BigUint::from(9u32));
+
+        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+        assert_eq!(y1, Point::Scalar(BigUint::from(2u32)));
+        assert_eq!(y2, Point::Scalar(BigUint::from(3u32)));
+
+        let k = BigUint::from(7u32);
+        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+
+        assert_eq!(r1, Point::Scalar(BigUint::from(8u32)));
+        assert_eq!(r2, Point::Scalar(BigUint::from(4u32)));
+
+        let c = BigUint::from(4u32);
+
+        let mut s = solve_zk_challenge_s(&x, &k, &c, &q);
+
+        // we compute `s` slightly bad
+        s = s - BigUint::one();
+
+        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
+        assert!(!verification)
+    }
+
+    #[test]
+    fn test_verify_elliptic_curve_success_example_1() {
+        let p = Secp256k1Point::prime();
+        let q = Secp256k1Point::n();
+
+        let x = BigUint::from(300u32);
+        let g = Secp256k1Point::generator();
+        let h = g.clone().scale(BigUint::from(13u32));
+
+        let g = Point::from_secp256k1(&g);
+        let h = Point::from_secp256k1(&h);
+        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+
+        let k = BigUint::from(10u32);
+        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+
+        let c = BigUint::from(894u32);
+
+        let s = solve_zk_challenge_s(&x, &k, &c, &q);
+
+        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
+        assert!(verification)
+    }
+
+    #[test]
+    fn test_verify_elliptic_curve_failure_example_1() {
+        let p = Secp256k1Point::prime();
+        let q = Secp256k1Point::n();
+
+        let x = BigUint::from(300u32);
+        let g = Secp256k1Point::generator();
+        let h = g.clone().scale(BigUint::from(13u32));
+
+        let g = Point::from_secp256k1(&g);
+        let h = Point::from_secp256k1(&h);
+        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+
+        let k = BigUint::from(10u32);
+        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+
+        let c = BigUint::from(894u32);
+
+        let s = solve_zk_challenge_s(&x, &k, &c, &q) + BigUint::one();
+
+        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
+        assert!(!verification)
+    }
+
+    #[test]
+    fn test_serialize() {
+        let p = Point::Scalar(BigUint::from(65256u32));
+
+        assert_eq!(p.serialize(), vec![0xfe, 0xe8]);
+
+        let p = Point::ECPoint(BigUint::from(65256u32), BigUint::from(8475u32));
+
+        assert_eq!(p.serialize(), vec![0xfe, 0xe8, 0x21, 0x1b]);
+
+        // one array is longer than the other
+        let p = Point::ECPoint(BigUint::from(65256u32), BigUint::from(83957234u32));
+
+        assert_eq!(
+            p.serialize(),
+            vec![0x00, 0x00, 0xfe, 0xe8, 0x05, 0x01, 0x15, 0xf2]
+        );
+
+        // the other way around
+        let p = Point::ECPoint(BigUint::from(83957234u32), BigUint::from(65256u32));
+
+        assert_eq!(
+            p.serialize(),
+            vec![0x05, 0x01, 0x15, 0xf2, 0x00, 0x00, 0xfe, 0xe8]
+        );
+    }
+
+    #[test]
+    fn test_serialize_with_order() {
+        let p = Point::Scalar(BigUint::from(65256u32));
+        assert_eq!(p.serialize_with_order(ByteOrder::BigEndian), p.serialize());
+        assert_eq!(
+            p.serialize_with_order(ByteOrder::LittleEndian),
+            [0xe8, 0xfe]
+        );
+
+        let p = Point::ECPoint(BigUint::from(65256u32), BigUint::from(83957234u32));
+        assert_eq!(
+            p.serialize_with_order(ByteOrder::LittleEndian),
+            [0xe8, 0xfe, 0x00, 0x00, 0xf2, 0x15, 0x01, 0x05]
+        );
+
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (_, y1, _) = group.generate_key().unwrap();
+            for order in [ByteOrder::BigEndian, ByteOrder::LittleEndian] {
+                let v = y1.serialize_with_order(order);
+                assert_eq!(
+                    Point::deserialize_with_order(v, &group, order),
+                    Ok(y1.clone())
+                );
+            }
+        }
+
+        // the SEC 1 encodings are big-endian only
+        let (_, y1, _) = Group::EllipticCurve.generate_key().unwrap();
+        let options = SerializeOptions { compressed: true };
+        assert_eq!(
+            Point::deserialize_with_order(
+                y1.serialize_with(options),
+                &Group::EllipticCurve,
+                ByteOrder::LittleEndian
+            ),
+            Err(Error::InvalidSerialization)
+        );
+    }
+
+    #[test]
+    fn test_serialize_into() {
+        let (_, y1, y2) = Group::EllipticCurve.generate_key().unwrap();
+        let points = [
+            Point::Scalar(BigUint::zero()),
+            Point::Scalar(BigUint::from(65256u32)),
+            Point::ECPoint(BigUint::from(65256u32), BigUint::from(83957234u32)),
+            Point::ECPoint(BigUint::zero(), BigUint::zero()),
+            y1,
+            y2,
+        ];
+
+        let mut buffer = Vec::with_capacity(64);
+        let address = buffer.as_ptr();
+        for point in &points {
+            point.serialize_into(&mut buffer);
+            assert_eq!(buffer, point.serialize());
+        }
+        // the buffer was large enough for all of them
+        assert_eq!(buffer.as_ptr(), address);
+    }
+
+    #[test]
+    fn test_deserialize() {
+        let p = Point::deserialize_unchecked(vec![0xfe, 0xe8], &Group::Scalar).unwrap();
+
+        assert_eq!(p, Point::Scalar(BigUint::from(65256u32)));
+
+        let p = Point::deserialize_unchecked(vec![0xfe, 0xe8, 0x21, 0x1b], &Group::EllipticCurve)
+            .unwrap();
+
+        assert_eq!(
+            p,
+            Point::ECPoint(BigUint::from(65256u32), BigUint::from(8475u32))
+        );
+
+        // one array is longer than the other
+        let p = Point::deserialize_unchecked(
+            vec![0x00, 0x00, 0xfe, 0xe8, 0x05, 0x01, 0x15, 0xf2],
+            &Group::EllipticCurve,
+        )
+        .unwrap();
+
+        assert_eq!(
+            p,
+            Point::ECPoint(BigUint::from(65256u32), BigUint::from(83957234u32))
+        );
+
+        // the other way around
+        let p = Point::deserialize_unchecked(
+            vec![0x05, 0x01, 0x15, 0xf2, 0x00, 0x00, 0xfe, 0xe8],
+            &Group::EllipticCurve,
+        )
+        .unwrap();
+
+        assert_eq!(
+            p,
+            Point::ECPoint(BigUint::from(83957234u32), BigUint::from(65256u32))
+        );
+    }
+
+    #[test]
+    fn test_deserialize_all() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let points: Vec<Point> = (0..4).map(|_| group.generate_key().unwrap().1).collect();
+            let data: Vec<Vec<u8>> = points.iter().map(Point::serialize).collect();
+            assert_eq!(Point::deserialize_all(data.clone(), &group), Ok(points));
+            assert_eq!(Point::deserialize_all(vec![], &group), Ok(vec![]));
+
+            let mut invalid = data.clone();
+            invalid[2] = vec![];
+            assert_eq!(
+                Point::deserialize_all(invalid, &group),
+                Err((2, Error::InvalidSerialization))
+            );
+            let mut invalid = data;
+            invalid[1] = vec![0, 0];
+            invalid[3] = vec![];
+            assert_eq!(
+                Point::deserialize_all(invalid, &group),
+                Err((1, Error::InvalidPoint))
+            );
+        }
+    }
+
+    #[test]
+    fn test_point_fingerprint() {
+        let group = Group::EllipticCurve;
+        let (_, y1, y2) = group.generate_key().unwrap();
+        assert_eq!(y1.fingerprint(), y1.clone().fingerprint());
+        assert_ne!(y1.fingerprint(), y2.fingerprint());
+        assert_eq!(y1.short_id().len(), 16);
+        assert_eq!(y1.to_string(), format!("ECPoint({})", y1.short_id()));
+
+        // the encoding read doesn't matter
+        let options = SerializeOptions { compressed: true };
+        let compressed = Point::deserialize(y1.serialize_with(options), &group).unwrap();
+        assert_eq!(compressed.fingerprint(), y1.fingerprint());
+        let (_, y, _) = Group::Scalar.generate_key().unwrap();
+        let mut padded = vec![0];
+        padded.extend(y.serialize());
+        let read = Point::deserialize(padded, &Group::Scalar).unwrap();
+        assert_eq!(read.fingerprint(), y.fingerprint());
+    }
+
+    #[test]
+    fn test_point_from_numbers() {
+        let (_, y, _) = Group::Scalar.generate_key().unwrap();
+        let Point::Scalar(n) = &y else { unreachable!() };
+        assert_eq!(Group::Scalar.point_from_integer(n), Ok(y.clone()));
+        let (p, _, _, _) = get_constants(&Group::Scalar);
+        assert_eq!(
+            Group::Scalar.point_from_integer(&(p + n)),
+            Err(Error::InvalidPoint)
+        );
+        assert_eq!(
+            Group::EllipticCurve.point_from_integer(n),
+            Err(Error::InvalidPoint)
+        );
+
+        let group = Group::EllipticCurve;
+        let (_, y, _) = group.generate_key().unwrap();
+        let Point::ECPoint(x, y_coordinate) = &y else {
+            unreachable!()
+        };
+        assert_eq!(group.point_from_coordinates(x, y_coordinate), Ok(y.clone()));
+        assert_eq!(
+            group.point_from_coordinates(x, &(y_coordinate + 1u32)),
+            Err(Error::InvalidPoint)
+        );
+        assert_eq!(
+            Group::Scalar.point_from_coordinates(x, y_coordinate),
+            Err(Error::InvalidPoint)
+        );
+    }
+
+    #[test]
+    fn test_deserialize_slice() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let points: Vec<Point> = (0..4).map(|_| group.generate_key().unwrap().1).collect();
+            let mut file = Vec::new();
+            for point in &points {
+                write_length_prefixed(&mut file, &point.serialize());
+            }
+
+            let mut data = &file[..];
+            for point in &points {
+                let v = read_length_prefixed(&mut data).unwrap();
+                assert_eq!(Point::deserialize_slice(v, &group).as_ref(), Ok(point));
+            }
+            assert_eq!(
+                Point::deserialize_slice(&[], &group),
+                Err(Error::InvalidSerialization)
+            );
+            assert_eq!(
+                Point::deserialize_slice(&[0, 0], &group),
+                Err(Error::InvalidPoint)
+            );
+        }
+    }
+
+    #[test]
+    fn test_deserialize_invalid_point() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (_, y1, y2) = group.generate_key().unwrap();
+            assert!(group.contains(&y1) && group.contains(&y2));
+            assert_eq!(Point::deserialize(y1.serialize(), &group).unwrap(), y1);
+
+            let (_, _, g, h) = get_constants(&group);
+            assert!(group.contains(&g) && group.contains(&h));
+        }
+
+        // out of range or outside of the subgroup of order q
+        for y in [0u32, 10007, 10008, 7] {
+            assert_eq!(
+                Point::deserialize(BigUint::from(y).to_bytes_be(), &Group::Scalar),
+                Err(Error::InvalidPoint)
+            );
+        }
+
+        // not on the curve
+        let (_, _, g, _) = get_constants_elliptic_curve();
+        if let Point::ECPoint(x, y) = g {
+            let point = Point::ECPoint(x, y + 1u32);
+            assert_eq!(
+                Point::deserialize(point.serialize(), &Group::EllipticCurve),
+                Err(Error::InvalidPoint)
+            );
+        }
+
+        assert!(!Group::Scalar.contains(&Point::ECPoint(BigUint::one(), BigUint::one())));
+    }
+
+    #[test]
+    fn test_invalid_points_dont_panic() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+
+        let off_curve = match &y1 {
+            Point::ECPoint(x, y) => Point::ECPoint(x.clone(), y + 1u32),
+            _ => unreachable!(),
+        };
+
+        assert_eq!(
+            group.verify_proof(&off_curve, &y2, &proof),
+            Err(Error::InvalidPoint)
+        );
+
+        // the challenge matches so the points reach the multi-exponentiation
+        let (p, q, g, h) = get_constants(&group);
+        let mut forged = proof.clone();
+        let points = [&g, &h, &off_curve, &y2, &proof.r1, &proof.r2];
+        forged.c = fiat_shamir_challenge(&points, &q, ChallengeHash::default(), &[]);
+        assert_eq!(
+            group.verify_proof_batch_fast(&[(off_curve.clone(), y2.clone())], &[forged]),
+            Err(Error::InvalidPoint)
+        );
+
+        assert_eq!(
+            exponentiates_points(&x, &g, &off_curve, &p),
+            Err(Error::InvalidPoint)
+        );
+        assert_eq!(group.create_proof(&q), Err(Error::InvalidSecret));
+    }
+
+    #[test]
+    fn test_point_ct_eq() {
+        let a = Point::Scalar(BigUint::from(2892u32));
+        assert!(a.ct_eq(&Point::Scalar(BigUint::from(2892u32))));
+        assert!(!a.ct_eq(&Point::Scalar(BigUint::from(2893u32))));
+        assert!(!a.ct_eq(&Point::Scalar(BigUint::from(2892u32 << 8))));
+
+        let (_, _, g, h) = get_constants_elliptic_curve();
+        assert!(g.ct_eq(&g.clone()));
+        assert!(!g.ct_eq(&h));
+        assert!(!g.ct_eq(&a));
+
+        // every difference of a byte gives 0, not only the low bits
+        let n = BigUint::from(0x1234u32);
+        assert_eq!(ct_eq_biguint_u8(&n, &n), 1);
+        for bit in 0..16 {
+            assert_eq!(ct_eq_biguint_u8(&n, &(&n ^ BigUint::from(1u32 << bit))), 0);
+        }
+    }
+
+    #[test]
+    fn test_proof_eq() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, _, _) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+            assert!(proof.ct_eq(&proof.clone()));
+            assert_eq!(proof, proof.clone());
+
+            let other = group.create_proof(&x).unwrap();
+            assert!(!proof.ct_eq(&other));
+            assert_ne!(proof, other);
+
+            let mut tampered = proof.clone();
+            tampered.s += 1u32;
+            assert!(!proof.ct_eq(&tampered));
+        }
+    }
+
+    #[test]
+    fn test_same_statement() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let a = group.create_proof(&x).unwrap();
+            let b = group.create_proof(&x).unwrap();
+            assert_ne!(a, b);
+            assert_eq!(group.same_statement(&y1, &y2, &a, &b), Ok(true));
+            assert_eq!(group.same_statement(&y1, &y2, &a, &a), Ok(true));
+        }
+
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let (other, _, _) = group.generate_key().unwrap();
+        let a = group.create_proof(&x).unwrap();
+        let b = group.create_proof(&other).unwrap();
+        assert_eq!(group.same_statement(&y1, &y2, &a, &b), Ok(false));
+        assert_eq!(group.same_statement(&y1, &y2, &b, &a), Ok(false));
+
+        let (_, y1, _) = Group::Scalar.generate_key().unwrap();
+        assert!(group.same_statement(&y1, &y2, &a, &a).is_err());
+    }
+
+    #[test]
+    fn test_toy_group_forgery() {
+        // A proof of Group::Scalar holds for a wrong secret or statement with
+        // a probability of 1 in q = 5003, so a forged one is found by trying
+        // commitments. The tests checking that such proofs are rejected use
+        // secp256k1 for that reason.
+        let group = Group::Scalar;
+        let (p, q, g, h) = get_constants(&group);
+        let (_, y1, y2) = group.generate_key().unwrap();
+        let number = |point: &Point| match point {
+            Point::Scalar(n) => n.clone(),
+            Point::ECPoint(..) => unreachable!(),
+        };
+        let q = q.to_u32().unwrap();
+
+        let forged = (1..40u32)
+            .flat_map(|c| (0..q).map(move |s| (BigUint::from(c), BigUint::from(s))))
+            .find_map(|(c, s)| {
+                let commit = |g: &Point, y: &Point| {
+                    Point::Scalar(number(g).modpow(&s, &p) * number(y).modpow(&c, &p) % &p)
+                };
+                let commitment = Commitment {
+                    r1: commit(&g, &y1),
+                    r2: commit(&h, &y2),
+                };
+                let challenge = group.transcript_challenge(&y1, &y2, &commitment);
+                (*challenge.value() == c).then(|| Proof {
+                    r1: commitment.r1,
+                    r2: commitment.r2,
+                    c,
+                    s,
+                })
+            })
+            .unwrap();
+        assert_eq!(group.verify_proof(&y1, &y2, &forged), Ok(true));
+    }
+
+    #[test]
+    fn test_transcript_challenge() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+            let commitment = Commitment {
+                r1: proof.r1.clone(),
+                r2: proof.r2.clone(),
+            };
+            let c = group.transcript_challenge(&y1, &y2, &commitment);
+            assert_eq!(*c.value(), proof.c);
+        }
+
+        // the public values are part of the transcript. The challenges of the
+        // integer group are small enough to collide now and then
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let (k, commitment) = group.commit().unwrap();
+        let c = group.transcript_challenge(&y1, &y2, &commitment);
+        let (_, other1, other2) = group.generate_key().unwrap();
+        let other = group.transcript_challenge(&other1, &other2, &commitment);
+        assert_ne!(other, c);
+        assert_ne!(group.transcript_challenge(&y2, &y1, &commitment), c);
+
+        let proof = group.respond(&commitment, &k, c.value(), &x);
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+        let proof = group.respond(&commitment, &k, other.value(), &x);
+        assert!(!group.verify_proof(&y1, &y2, &proof).unwrap());
+    }
+
+    #[test]
+    fn test_proof_transcript() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+            let (_, q, g, _) = get_constants(&group);
+
+            let transcript = group.proof_transcript(&y1, &y2, &proof).unwrap();
+            let c = BigUint::from_bytes_be(&Sha256::digest(&transcript)) % q;
+            assert_eq!(c, proof.c);
+            let g = g.serialize();
+            assert_eq!(transcript[..4], (g.len() as u32).to_be_bytes());
+            assert_eq!(transcript[4..4 + g.len()], g);
+        }
+
+        let group = Group::Scalar;
+        let (x, y1, _) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        let (_, y2, _) = Group::EllipticCurve.generate_key().unwrap();
+        assert_eq!(
+            group.proof_transcript(&y1, &y2, &proof),
+            Err(Error::InvalidPoint)
+        );
+    }
+
+    #[test]
+    fn test_ensure_valid_proof() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        assert_eq!(group.ensure_valid_proof(&y1, &y2, &proof), Ok(()));
+
+        let mut tampered = proof.clone();
+        tampered.s += 1u32;
+        assert_eq!(
+            group.ensure_valid_proof(&y1, &y2, &tampered),
+            Err(Error::InvalidProof)
+        );
+
+        // the errors of the verification are returned as they are
+        let (_, y1, _) = Group::Scalar.generate_key().unwrap();
+        assert_eq!(
+            group.ensure_valid_proof(&y1, &y2, &proof),
+            group.verify_proof(&y1, &y2, &proof).map(|_| ())
+        );
+    }
+
+    #[test]
+    fn test_zeroize() {
+        let mut x = get_random_number() + BigUint::one();
+        zeroize(&mut x);
+        assert!(x.is_zero());
+
+        let mut x = BigUint::zero();
+        zeroize(&mut x);
+        assert!(x.is_zero());
+    }
+
+    #[test]
+    fn test_display() {
+        assert_eq!(Group::Scalar.to_string(), "Scalar");
+        assert_eq!(Group::EllipticCurve.to_string(), "secp256k1");
+        assert_eq!(
+            Group::named(GroupId::Modp2048).to_string(),
+            "Custom(2048-bit modulus)"
+        );
+
+        let point = Point::Scalar(BigUint::from(2892u32));
+        let display = point.to_string();
+        assert!(display.starts_with("Scalar("));
+        assert_eq!(display.len(), "Scalar()".len() + 16);
+        assert_ne!(display, Point::Scalar(BigUint::from(2893u32)).to_string());
+
+        let (_, _, g, _) = get_constants_elliptic_curve();
+        assert!(g.to_string().starts_with("ECPoint("));
+
+        let proof = Group::Scalar.create_proof(&BigUint::from(300u32)).unwrap();
+        assert!(proof.to_string().starts_with("Proof("));
+    }
+
+    #[test]
+    fn test_deserialize_invalid_input() {
+        assert_eq!(
+            Point::deserialize(vec![], &Group::Scalar),
+            Err(Error::InvalidSerialization)
+        );
+        assert!(Point::deserialize(vec![], &Group::EllipticCurve).is_err());
+        assert!(Point::deserialize(vec![0xfe, 0xe8, 0x21], &Group::EllipticCurve).is_err());
+    }
+
+    #[test]
+    fn test_serialize_with() {
+        let group = Group::EllipticCurve;
+        let compressed = SerializeOptions { compressed: true };
+
+        for _ in 0..4 {
+            let (_, y1, _) = group.generate_key().unwrap();
+
+            let v = y1.serialize_with(compressed);
+            assert_eq!(v.len(), 33);
+            assert!(v[0] == 0x02 || v[0] == 0x03);
+            assert_eq!(Point::deserialize(v, &group).unwrap(), y1);
+
+            let v = y1.serialize_with(SerializeOptions::default());
+            assert_eq!((v.len(), v[0]), (65, 0x04));
+            assert_eq!(Point::deserialize(v, &group).unwrap(), y1);
+
+            assert_eq!(Point::deserialize(y1.serialize(), &group).unwrap(), y1);
+        }
+
+        // x = 5 is not the abscissa of a point of secp256k1
+        let mut v = vec![0x02];
+        v.extend_from_slice(&pad_to_field_size(&BigUint::from(5u32)));
+        assert_eq!(Point::deserialize(v, &group), Err(Error::InvalidPoint));
+
+        let mut v = Point::Scalar(BigUint::from(2892u32)).serialize_with(compressed);
+        assert_eq!(v, vec![0x0b, 0x4c]);
+        v.insert(0, 0x05);
+        assert!(Point::deserialize(v, &group).is_err());
+    }
+
+    #[test]
+    fn test_deserialize_truncated_input() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, _) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+            let (_, commitment) = group.commit().unwrap();
+
+            // a shorter point may still be valid, only check nothing panics
+            let v = y1.serialize();
+            for len in 0..v.len() {
+                let _ = Point::deserialize(v[..len].to_vec(), &group);
+            }
+
+            let serialized = [
+                proof.serialize(&group),
+                proof.serialize_with_timestamp(&group, SystemTime::now()),
+            ];
+            for v in serialized {
+                for len in 0..v.len() {
+                    assert!(Proof::deserialize(v[..len].to_vec(), &group).is_err());
+                }
+            }
+
+            let v = commitment.serialize();
+            for len in 0..v.len() {
+                assert!(Commitment::deserialize(v[..len].to_vec(), &group).is_err());
+            }
+        }
+
+        // a timestamp that doesn't fit in a SystemTime
+        let proof = Group::Scalar.create_proof(&BigUint::from(300u32)).unwrap();
+        let mut v = vec![PROOF_VERSION, HEADER_TIMESTAMP];
+        v.extend_from_slice(&u64::MAX.to_be_bytes());
+        v.extend_from_slice(&proof.serialize_raw(&Group::Scalar));
+        assert_eq!(
+            Proof::deserialize(v, &Group::Scalar),
+            Err(Error::InvalidSerialization)
+        );
+    }
+
+    #[test]
+    fn test_proof_serialize_deserialize() {
+        let (p, q, g, h) = get_constants(&Group::Scalar);
+
+        let x = BigUint::from(300u32);
+        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+
+        let k = BigUint::from(10u32);
+        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+
+        let c = BigUint::from(894u32);
+        let s = solve_zk_challenge_s(&x, &k, &c, &q);
+
+        let proof = Proof { r1, r2, c, s };
+        let deserialized =
+            Proof::deserialize(proof.serialize(&Group::Scalar), &Group::Scalar).unwrap();
+        assert_eq!(deserialized, proof);
+
+        let verification = verify(
+            &deserialized.r1,
+            &deserialized.r2,
+            &y1,
+            &y2,
+            &g,
+            &h,
+            &deserialized.c,
+            &deserialized.s,
+            &p,
+        )
+        .unwrap();
+        assert!(verification);
+    }
+
+    #[test]
+    fn test_proof_deserialize_invalid_input() {
+        let proof = Proof {
+            r1: Point::Scalar(BigUint::from(8u32)),
+            r2: Point::Scalar(BigUint::from(4u32)),
+            c: BigUint::from(4u32),
+            s: BigUint::from(5u32),
+        };
+        let v = proof.serialize(&Group::Scalar);
+
+        assert!(Proof::deserialize(vec![], &Group::Scalar).is_err());
+        assert!(Proof::deserialize(v[..v.len() - 1].to_vec(), &Group::Scalar).is_err());
+
+        let mut longer = v.clone();
+        longer.push(0);
+        assert!(Proof::deserialize(longer, &Group::Scalar).is_err());
+    }
+
+    #[test]
+    fn test_max_serialized_size() {
+        // the limit is shared with the other tests running concurrently, so
+        // only the default one is checked
+        assert_eq!(max_serialized_size(), DEFAULT_MAX_SERIALIZED_SIZE);
+        let huge = vec![1u8; DEFAULT_MAX_SERIALIZED_SIZE + 1];
+
+        assert_eq!(
+            Point::deserialize(huge.clone(), &Group::Scalar),
+            Err(Error::SizeLimitExceeded)
+        );
+        assert!(matches!(
+            Proof::deserialize(huge.clone(), &Group::Scalar),
+            Err(Error::SizeLimitExceeded)
+        ));
+        assert!(matches!(
+            Group::deserialize(huge.clone()),
+            Err(Error::SizeLimitExceeded)
+        ));
+        assert_eq!(
+            RingProof::deserialize(huge.clone()),
+            Err(Error::SizeLimitExceeded)
+        );
+        assert_eq!(
+            Point::from_hex(&hex::encode(&huge), &Group::Scalar),
+            Err(Error::SizeLimitExceeded)
+        );
+
+        // the largest input allowed is only rejected as malformed
+        let mut largest = vec![1u8; DEFAULT_MAX_SERIALIZED_SIZE];
+        largest[0] = PROOF_VERSION;
+        assert!(matches!(
+            Proof::deserialize(largest, &Group::Scalar),
+            Err(Error::InvalidSerialization)
+        ));
+        assert_eq!(check_serialized_size(0), Ok(()));
+    }
+
+    #[test]
+    fn test_proof_canonical_encoding() {
+        let group = Group::EllipticCurve;
+        let (x, _, _) = group.generate_key().unwrap();
+        let (k, commitment) = group.commit().unwrap();
+        // a short challenge, padded in the canonical encoding
+        let proof = group.respond(&commitment, &k, &BigUint::from(7u32), &x);
+
+        let v = proof.serialize(&group);
+        assert_eq!(v.len(), group.proof_size());
+        assert!(Proof::is_canonical(&v, &group));
+        assert_eq!(Proof::deserialize(v.clone(), &group), Ok(proof.clone()));
+        let timestamped = proof.serialize_with_timestamp(&group, SystemTime::now());
+        assert!(Proof::is_canonical(&timestamped, &group));
+
+        let point = |point: &Point| match point {
+            Point::ECPoint(x, y) => [pad_to_field_size(x), pad_to_field_size(y)].concat(),
+            Point::Scalar(_) => unreachable!(),
+        };
+        let header = ProofHeader::default().serialize();
+        let encode = |r1: Vec<u8>, c: Vec<u8>| {
+            let mut v = header.clone();
+            write_length_prefixed(&mut v, &r1);
+            write_length_prefixed(&mut v, &point(&proof.r2));
+            write_length_prefixed(&mut v, &c);
+            write_length_prefixed(&mut v, &padded_be_bytes(&proof.s, 32));
+            v
+        };
+        let c = [vec![0; 31], vec![7]].concat();
+        assert_eq!(encode(point(&proof.r1), c.clone()), v);
+
+        let compressed = proof
+            .r1
+            .serialize_with(SerializeOptions { compressed: true });
+        let non_canonical = [
+            // the challenge without its leading zeros, and with one more
+            encode(point(&proof.r1), vec![7]),
+            encode(point(&proof.r1), [vec![0], c.clone()].concat()),
+            // a compressed commitment
+            encode(compressed, c),
+        ];
+        for v in non_canonical {
+            assert!(!Proof::is_canonical(&v, &group));
+            assert_eq!(
+                Proof::deserialize(v, &group),
+                Err(Error::InvalidSerialization)
+            );
+        }
+
+        // the encoding of the previous version
+        let compact = [vec![COMPACT_PROOF_VERSION, 0], proof.serialize_compact()].concat();
+        assert!(!Proof::is_canonical(&compact, &group));
+        assert_eq!(
+            Proof::deserialize(compact, &group),
+            Err(Error::UnsupportedVersion)
+        );
+    }
+
+    #[test]
+    fn test_proof_batch_serialization() {
+        let group = Group::Scalar;
+        let (x, _, _) = group.generate_key().unwrap();
+        let proofs: Vec<Proof> = (0..3).map(|_| group.create_proof(&x).unwrap()).collect();
+
+        let v = Proof::serialize_batch(&proofs, &group);
+        assert_eq!(&v[..4], &[0, 0, 0, 3]);
+        assert_eq!(Proof::deserialize_batch(v.clone(), &group).unwrap(), proofs);
+
+        let empty = Proof::serialize_batch(&[], &group);
+        assert_eq!(Proof::deserialize_batch(empty, &group).unwrap(), vec![]);
+
+        for len in 0..v.len() {
+            assert!(Proof::deserialize_batch(v[..len].to_vec(), &group).is_err());
+        }
+
+        let mut longer = v.clone();
+        longer.push(0);
+        assert!(Proof::deserialize_batch(longer, &group).is_err());
+
+        // a count larger than the number of proofs
+        let mut count = v.clone();
+        count[3] = 4;
+        assert!(Proof::deserialize_batch(count, &group).is_err());
+        let huge = vec![0xff, 0xff, 0xff, 0xff];
+        assert!(Proof::deserialize_batch(huge, &group).is_err());
+    }
+
+    #[test]
+    fn test_proof_is_well_formed() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, _, _) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+            assert!(proof.is_well_formed(&group));
+
+            // a valid shape says nothing about the validity of the proof
+            let mut wrong = proof.clone();
+            wrong.s = &wrong.s - 1u32;
+            assert!(wrong.is_well_formed(&group));
+
+            let (_, q, _, _) = get_constants(&group);
+            let mut large_c = proof.clone();
+            large_c.c = q.clone();
+            assert!(!large_c.is_well_formed(&group));
+
+            let mut large_s = proof.clone();
+            large_s.s = &q + 1u32;
+            assert!(!large_s.is_well_formed(&group));
+
+            let mut not_element = proof.clone();
+            not_element.r2 = match &proof.r2 {
+                Point::Scalar(_) => Point::Scalar(BigUint::zero()),
+                Point::ECPoint(x, y) => Point::ECPoint(x.clone(), y + 1u32),
+            };
+            assert!(!not_element.is_well_formed(&group));
+        }
+
+        let (x, _, _) = Group::EllipticCurve.generate_key().unwrap();
+        let proof = Group::EllipticCurve.create_proof(&x).unwrap();
+        assert!(!proof.is_well_formed(&Group::Scalar));
+    }
+
+    #[test]
+    fn test_hash_iterations() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+
+        let iterated = ChallengeHash::Sha256Iterated;
+
+        let default = iterated(DEFAULT_HASH_ITERATIONS);
+        let proof = group.create_proof_with_hash(&x, default).unwrap();
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+        let proof = group.create_proof(&x).unwrap();
+        assert!(group
+            .verify_proof_with_hash(&y1, &y2, &proof, default)
+            .unwrap());
+
+        let proof = group.create_proof_with_hash(&x, iterated(3)).unwrap();
+        let transcript = group.proof_transcript(&y1, &y2, &proof).unwrap();
+        let digest = Sha256::digest(Sha256::digest(Sha256::digest(transcript)));
+        let (_, q, _, _) = get_constants(&group);
+        assert_eq!(proof.c, BigUint::from_bytes_be(&digest) % q);
+        assert!(group
+            .verify_proof_with_hash(&y1, &y2, &proof, iterated(3))
+            .unwrap());
+        assert!(!group
+            .verify_proof_with_hash(&y1, &y2, &proof, iterated(2))
+            .unwrap());
+        assert!(!group.verify_proof(&y1, &y2, &proof).unwrap());
+
+        for iterations in [0, MAX_HASH_ITERATIONS + 1] {
+            assert_eq!(
+                group.create_proof_with_hash(&x, iterated(iterations)),
+                Err(Error::InvalidArguments)
+            );
+            assert_eq!(
+                group.verify_proof_with_hash(&y1, &y2, &proof, iterated(iterations)),
+                Err(Error::InvalidArguments)
+            );
+        }
+    }
+
+    #[test]
+    fn test_challenge_bits() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+
+        let proof = group.create_proof_with_challenge_bits(&x, 128).unwrap();
+        assert!(proof.c.bits() <= 128);
+        assert!(group
+            .verify_proof_with_challenge_bits(&y1, &y2, &proof, 128)
+            .unwrap());
+        assert!(!group
+            .verify_proof_with_challenge_bits(&y1, &y2, &proof, 129)
+            .unwrap());
+        assert!(!group.verify_proof(&y1, &y2, &proof).unwrap());
+
+        let (_, q, _, _) = get_constants(&group);
+        let full = q.bits() as usize;
+        let proof = group.create_proof_with_challenge_bits(&x, full).unwrap();
+        assert!(group
+            .verify_proof_with_challenge_bits(&y1, &y2, &proof, full)
+            .unwrap());
+
+        for bits in [MIN_CHALLENGE_BITS - 1, full + 1] {
+            assert_eq!(
+                group.create_proof_with_challenge_bits(&x, bits),
+                Err(Error::InvalidArguments)
+            );
+            assert_eq!(
+                group.verify_proof_with_challenge_bits(&y1, &y2, &proof, bits),
+                Err(Error::InvalidArguments)
+            );
+        }
+
+        // the order of the toy group is too small for any length
+        let (x, _, _) = Group::Scalar.generate_key().unwrap();
+        assert_eq!(
+            Group::Scalar.create_proof_with_challenge_bits(&x, MIN_CHALLENGE_BITS),
+            Err(Error::InvalidArguments)
+        );
+    }
+
+    #[test]
+    fn test_group_serialization() {
+        let custom = Group::new_with_params(&[23], &[11], &[4], &[9]).unwrap();
+        let named = Group::named(GroupId::Modp2048);
+        for group in [Group::Scalar, Group::EllipticCurve, custom, named] {
+            let v = group.serialize();
+            let deserialized = Group::deserialize(v.clone()).unwrap();
+            assert_eq!(deserialized.fingerprint(), group.fingerprint());
+            assert_eq!(deserialized.serialize(), v);
+
+            // the proofs are compatible
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+            assert!(deserialized.verify_proof(&y1, &y2, &proof).unwrap());
+
+            for len in 0..v.len() {
+                assert!(Group::deserialize(v[..len].to_vec()).is_err());
+            }
+            let mut longer = v.clone();
+            longer.push(0);
+            assert!(Group::deserialize(longer).is_err());
+        }
+
+        assert!(Group::deserialize(vec![3]).is_err());
+
+        // 22 is not prime
+        let mut v = vec![GROUP_CUSTOM];
+        for n in [22u8, 11, 4, 9] {
+            write_length_prefixed(&mut v, &[n]);
+        }
+        assert!(matches!(Group::deserialize(v), Err(Error::NotPrime)));
+    }
+
+    #[test]
+    fn test_proof_header() {
+        let group = Group::Scalar;
+        let (x, _, _) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+
+        let v = proof.serialize(&group);
+        assert_eq!(&v[..2], &[PROOF_VERSION, 0]);
+        assert_eq!(&v[2..], &proof.serialize_raw(&group)[..]);
+        let (header, deserialized) = Proof::deserialize_with_header(v, &group).unwrap();
+        assert_eq!(header, ProofHeader::default());
+        assert_eq!(deserialized, proof);
+
+        let created_at = UNIX_EPOCH + Duration::from_secs(1_700_000_000);
+        let v = proof.serialize_with_timestamp(&group, created_at);
+        let (header, deserialized) = Proof::deserialize_with_header(v.clone(), &group).unwrap();
+        assert_eq!(header.created_at, Some(created_at));
+        assert_eq!(deserialized, proof);
+        assert_eq!(Proof::deserialize(v, &group).unwrap(), proof);
+
+        let v = proof.serialize_with_group(&group);
+        assert_eq!(&v[..2], &[PROOF_VERSION, 0x02]);
+        let header = ProofHeader::read(&v).unwrap();
+        assert_eq!(header.group, Some(group.fingerprint()));
+        assert_eq!(Proof::deserialize(v.clone(), &group).unwrap(), proof);
+        assert!(group.can_verify(&v));
+        assert!(!Group::EllipticCurve.can_verify(&v));
+        assert!(!group.can_verify(&proof.serialize(&group)));
+        for other in [Group::EllipticCurve, Group::named(GroupId::Modp2048)] {
+            assert!(matches!(
+                Proof::deserialize(v.clone(), &other),
+                Err(Error::GroupMismatch)
+            ));
+        }
+
+        let both = ProofHeader {
+            created_at: Some(created_at),
+            group: Some(group.fingerprint()),
+            ..Default::default()
+        };
+        let v = proof.serialize_with_header(&group, &both);
+        assert_eq!(
+            Proof::deserialize_with_header(v, &group).unwrap(),
+            (both, proof.clone())
+        );
+
+        let raw = proof.serialize_raw(&group);
+        assert_eq!(Proof::deserialize_raw(raw, &group).unwrap(), proof);
+
+        // proofs serialized before the header existed, and before the padding
+        let legacy = proof.serialize_compact();
+        let header = ProofHeader::read(&legacy).unwrap();
+        assert_eq!(header.version, LEGACY_PROOF_VERSION);
+        let compact = ProofHeader {
+            version: COMPACT_PROOF_VERSION,
+            created_at: Some(created_at),
+            group: None,
+        };
+        let compact = [compact.serialize(), proof.serialize_compact()].concat();
+        for old in [legacy, compact] {
+            assert_eq!(
+                Proof::deserialize(old.clone(), &group),
+                Err(Error::UnsupportedVersion)
+            );
+            let upgraded = Proof::upgrade_encoding(old, &group).unwrap();
+            let header = ProofHeader::read(&upgraded).unwrap();
+            assert_eq!(upgraded, proof.serialize_with_header(&group, &header));
+        }
+        let v = proof.serialize_with_timestamp(&group, created_at);
+        assert_eq!(Proof::upgrade_encoding(v.clone(), &group), Ok(v));
+
+        let mut unknown = proof.serialize(&group);
+        unknown[0] = PROOF_VERSION + 1;
+        assert_eq!(
+            Proof::deserialize(unknown, &group),
+            Err(Error::UnsupportedVersion)
+        );
+
+        let mut flags = proof.serialize(&group);
+        flags[1] = 0x80;
+        assert_eq!(
+            Proof::deserialize(flags, &group),
+            Err(Error::InvalidSerialization)
+        );
+    }
+
+    #[test]
+    fn test_verify_proof_with_expiry() {
+        let max_age = Duration::from_secs(60);
+
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+
+            let created_at = SystemTime::now();
+            let proof = group.create_proof_with_timestamp(&x, created_at).unwrap();
+            let v = proof.serialize_with_timestamp(&group, created_at);
+            let (header, proof) = Proof::deserialize_with_header(v, &group).unwrap();
+            assert!(group
+                .verify_proof_with_expiry(&y1, &y2, &header, &proof, max_age)
+                .unwrap());
+
+            let old = created_at - Duration::from_secs(120);
+            let proof = group.create_proof_with_timestamp(&x, old).unwrap();
+            let v = proof.serialize_with_timestamp(&group, old);
+            let (header, proof) = Proof::deserialize_with_header(v, &group).unwrap();
+            assert_eq!(
+                group.verify_proof_with_expiry(&y1, &y2, &header, &proof, max_age),
+                Err(Error::Expired)
+            );
+
+            // refreshing the timestamp of an old proof breaks it, challenges
+            // of the integer group are too small to never collide
+            let v = proof.serialize_with_timestamp(&group, created_at);
+            let (header, proof) = Proof::deserialize_with_header(v, &group).unwrap();
+            if matches!(group.kind(), GroupKind::EllipticCurve) {
+                assert!(!group
+                    .verify_proof_with_expiry(&y1, &y2, &header, &proof, max_age)
+                    .unwrap());
+            }
+
+            let (header, proof) =
+                Proof::deserialize_with_header(proof.serialize(&group), &group).unwrap();
+            assert_eq!(
+                group.verify_proof_with_expiry(&y1, &y2, &header, &proof, max_age),
+                Err(Error::MissingTimestamp)
+            );
+        }
+    }
+
+    #[test]
+    fn test_interactive_protocol() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (p, _, g, h) = get_constants(&group);
+
+            let x = get_random_number();
+            let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+
+            let (k, commitment) = group.commit().unwrap();
+            let c = group.challenge();
+            let proof = group.respond(&commitment, &k, &c, &x);
+
+            assert!(group
+                .verify_interactive(&y1, &y2, &commitment, &c, &proof)
+                .unwrap());
+
+            // the verifier holds another challenge
+            let other = &c + BigUint::one();
+            assert!(!group
+                .verify_interactive(&y1, &y2, &commitment, &other, &proof)
+                .unwrap());
+        }
+    }
+
+    #[test]
+    fn test_ensure_valid_interactive() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let (k, commitment) = group.commit().unwrap();
+        let c = group.challenge();
+        let proof = group.respond(&commitment, &k, &c, &x);
+        let ensure = |c: &BigUint, proof: &Proof| {
+            group.ensure_valid_interactive(&y1, &y2, &commitment, c, proof)
+        };
+        assert_eq!(ensure(&c, &proof), Ok(()));
+
+        // answer to a stale challenge
+        let other = group.challenge();
+        let stale = group.respond(&commitment, &k, &other, &x);
+        assert_eq!(ensure(&c, &stale), Err(Error::ChallengeMismatch));
+        let mut forged = proof.clone();
+        forged.s += 1u32;
+        assert_eq!(ensure(&c, &forged), Err(Error::InvalidProof));
+    }
+
+    #[test]
+    fn test_interactive_hides_secret() {
+        // the verifier sees s = k - c * x, which must not give x away as
+        // (q - s) / c when the challenge and the secrets are small
+        let group = Group::named(GroupId::Modp2048);
+        let (_, q, _, _) = get_constants(&group);
+        let (x, y1, y2) = group.generate_key().unwrap();
+        for _ in 0..4 {
+            let (k, commitment) = group.commit().unwrap();
+            let c = group.challenge();
+            assert!(!c.is_zero() && c < q);
+            let proof = group.respond(&commitment, &k, &c, &x);
+            assert!(group
+                .verify_interactive(&y1, &y2, &commitment, &c, &proof)
+                .unwrap());
+            let guess = (&q - &proof.s) / &c;
+            assert!(guess != x && guess + 1u32 != x);
+        }
+    }
+
+    #[test]
+    fn test_commitment_serialize_deserialize() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+
+            let (k, commitment) = group.commit().unwrap();
+            let deserialized = Commitment::deserialize(commitment.serialize(), &group).unwrap();
+            assert_eq!(deserialized, commitment);
+
+            let c = group.challenge();
+            let proof = group.respond(&deserialized, &k, &c, &x);
+            assert!(group
+                .verify_interactive(&y1, &y2, &commitment, &c, &proof)
+                .unwrap());
+
+            let v = commitment.serialize();
+            assert_eq!(
+                Commitment::deserialize(v[..v.len() - 1].to_vec(), &group),
+                Err(Error::InvalidSerialization)
+            );
+            assert!(Commitment::deserialize(vec![], &group).is_err());
+        }
+    }
+
+    #[test]
+    fn test_proof_size() {
+        for group in [
+            Group::Scalar,
+            Group::EllipticCurve,
+            Group::named(GroupId::Modp2048),
+        ] {
+            let size = group.proof_size();
+            for _ in 0..2 {
+                let (x, _, _) = group.generate_key().unwrap();
+                let proof = group.create_proof(&x).unwrap();
+                assert_eq!(proof.serialize(&group).len(), size);
+            }
+
+            let cost = group.estimated_proof_cost().unwrap();
+            assert!(cost > Duration::ZERO);
+            assert_eq!(group.estimated_proof_cost().unwrap(), cost);
+        }
+    }
+
+    /// Checks the keys and proofs of `testdata/vectors.json`, shared with the
+    /// implementations in other languages. The proofs use the fixed random
+    /// number `k` of the vectors. If this test fails after a change of the
+    /// encodings, the vectors must be updated on purpose.
+    #[test]
+    fn test_known_vectors() {
+        let vectors: serde_json::Value =
+            serde_json::from_str(include_str!("../testdata/vectors.json")).unwrap();
+        let field = |vector: &serde_json::Value, name: &str| {
+            hex::decode(vector[name].as_str().unwrap()).unwrap()
+        };
+
+        for vector in vectors["vectors"].as_array().unwrap() {
+            let group = match vector["group"].as_str().unwrap() {
+                "scalar" => Group::Scalar,
+                "secp256k1" => Group::EllipticCurve,
+                name => Group::named(name.parse().unwrap()),
+            };
+
+            let (p, q, g, h) = group.params();
+            assert_eq!(p, field(vector, "p"));
+            assert_eq!(q, field(vector, "q"));
+            assert_eq!(g, field(vector, "g"));
+            assert_eq!(h, field(vector, "h"));
+
+            let (x, y1, y2) = group
+                .generate_key_from_seed(&field(vector, "seed"))
+                .unwrap();
+            assert_eq!(x.to_bytes_be(), field(vector, "x"));
+            assert_eq!(y1.serialize(), field(vector, "y1"));
+            assert_eq!(y2.serialize(), field(vector, "y2"));
+
+            let (p, q, g, h) = get_constants(&group);
+            let k = BigUint::from_bytes_be(&field(vector, "k"));
+            let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+            let commitment = Commitment { r1, r2 };
+            let points = [&g, &h, &y1, &y2, &commitment.r1, &commitment.r2];
+            let c = fiat_shamir_challenge(&points, &q, ChallengeHash::default(), &[]);
+            let proof = group.respond(&commitment, &k, &c, &x);
+            assert_eq!(proof.serialize(&group), field(vector, "proof"));
+
+            let proof = Proof::deserialize(field(vector, "proof"), &group).unwrap();
+            assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+        }
+    }
 
     #[test]
-    fn test_get_random_array() {
-        let a = get_random_array::<32>();
-        let b = get_random_array::<32>();
-        let c = get_random_array::<32>();
-        let d = get_random_array::<32>();
-        assert_ne!(a, b);
-        assert_ne!(b, c);
-        assert_ne!(c, d);
+    fn test_generate_key_timeout() {
+        let group = Group::Scalar;
+        let (x, y1, y2) = group.generate_key_timeout(Duration::from_secs(60)).unwrap();
+        let (p, _, g, h) = get_constants(&group);
+        assert_eq!(exponentiates_points(&x, &g, &h, &p).unwrap(), (y1, y2));
+
+        let group = Group::named(GroupId::Modp4096);
+        assert_eq!(
+            group.generate_key_timeout(Duration::ZERO),
+            Err(Error::Timeout)
+        );
     }
 
     #[test]
-    fn test_get_random_number() {
-        let a = get_random_number();
-        let b = get_random_number();
-        let c = get_random_number();
-        let d = get_random_number();
-        assert_ne!(a, b);
-        assert_ne!(b, c);
-        assert_ne!(c, d);
+    fn test_generate_key_checked() {
+        assert_eq!(check_entropy(), Ok(()));
+
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key_checked().unwrap();
+        assert_eq!(group.public_key(&x).unwrap(), (y1, y2));
     }
 
     #[test]
-    fn test_exponentiates_points_scalar() {
-        let p = BigUint::from(10009u32);
-        let g = BigUint::from(3u32);
-        let h = BigUint::from(2892u32);
+    fn test_create_proof_deterministic() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key_from_seed(b"0123456789abcdef").unwrap();
 
-        let secret = BigUint::from(300u32);
+            let proof = group.create_proof_deterministic(&x, b"build 42").unwrap();
+            assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+            assert_eq!(
+                group.create_proof_deterministic(&x, b"build 42").unwrap(),
+                proof
+            );
 
-        let (y1, y2) = exponentiates_points_scalar(&secret, &g, &h, &p);
+            // the integer group is too small for the commitments to never
+            // collide
+            if matches!(group.kind(), GroupKind::EllipticCurve) {
+                let other = group.create_proof_deterministic(&x, b"build 43").unwrap();
+                assert_ne!(other, proof);
+            }
+        }
+    }
 
-        assert_eq!(y1, Point::Scalar(BigUint::from(6419u32)));
-        assert_eq!(y2, Point::Scalar(BigUint::from(4984u32)));
+    #[test]
+    fn test_self_test() {
+        let custom = Group::new_with_params(&[23], &[11], &[4], &[9]).unwrap();
+        for group in [Group::Scalar, Group::EllipticCurve, custom] {
+            assert_eq!(group.self_test(), Ok(()));
+        }
     }
 
     #[test]
-    fn test_solve_zk_challenge_s() {
-        // test positive k - cx
-        let x = BigUint::from(3u32);
-        let c = BigUint::from(3u32);
-        let k = BigUint::from(10u32);
-        let q = BigUint::from(10u32);
+    fn test_create_and_verify_proof() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (p, _, g, h) = get_constants(&group);
 
-        // s = 10 - 3 * 3 mod 10 = 1
-        assert_eq!(solve_zk_challenge_s(&x, &k, &c, &q), BigUint::one());
+            let x = get_random_number();
+            let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
 
-        // test negative k - cx
-        let x = BigUint::from(4u32);
-        let c = BigUint::from(3u32);
-        let k = BigUint::from(10u32);
-        let q = BigUint::from(10u32);
+            let proof = group.create_proof(&x).unwrap();
+            assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
 
-        // s = 10 - 3 * 4 mod 10 = 8
-        assert_eq!(solve_zk_challenge_s(&x, &k, &c, &q), BigUint::from(8u32));
+            // a proof for another secret doesn't verify
+            let proof = group.create_proof(&(&x + BigUint::one())).unwrap();
+            assert!(!group.verify_proof(&y1, &y2, &proof).unwrap());
+        }
     }
 
     #[test]
-    fn test_verify_scalar_success_toy_example_1() {
-        let p = BigUint::from(10009u32);
-        let q = (&p - BigUint::one()) / BigUint::from(2u32);
+    fn test_shared_group_between_threads() {
+        fn assert_send_sync<T: Send + Sync>() {}
+        assert_send_sync::<Group>();
+        assert_send_sync::<Proof>();
 
-        let x = BigUint::from(300u32);
-        let g = Point::Scalar(BigUint::from(3u32));
-        let h = Point::Scalar(BigUint::from(2892u32));
+        let group = std::sync::Arc::new(Group::Scalar);
+        let handles: Vec<_> = (0..64)
+            .map(|_| {
+                let group = group.clone();
+                std::thread::spawn(move || {
+                    let (x, y1, y2) = group.generate_key().unwrap();
+                    let proof = group.create_proof(&x).unwrap();
+                    group.verify_proof(&y1, &y2, &proof).unwrap()
+                })
+            })
+            .collect();
 
-        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+        for handle in handles {
+            assert!(handle.join().unwrap());
+        }
+    }
 
-        let k = BigUint::from(10u32);
-        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+    #[test]
+    fn test_create_proof_with_rng() {
+        use rand::{rngs::StdRng, SeedableRng};
 
-        let c = BigUint::from(894u32);
+        struct FailingRng;
 
-        let s = solve_zk_challenge_s(&x, &k, &c, &q);
+        impl RngCore for FailingRng {
+            fn next_u32(&mut self) -> u32 {
+                unimplemented!()
+            }
+            fn next_u64(&mut self) -> u64 {
+                unimplemented!()
+            }
+            fn fill_bytes(&mut self, _: &mut [u8]) {
+                unimplemented!()
+            }
+            fn try_fill_bytes(&mut self, _: &mut [u8]) -> Result<(), rand::Error> {
+                Err(rand::Error::new("no more bytes"))
+            }
+        }
 
-        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
-        assert!(verification)
+        impl CryptoRng for FailingRng {}
+
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+
+            let proof1 = group
+                .create_proof_with_rng(&x, &mut StdRng::from_seed([7; 32]))
+                .unwrap();
+            let proof2 = group
+                .create_proof_with_rng(&x, &mut StdRng::from_seed([7; 32]))
+                .unwrap();
+            assert_eq!(proof1, proof2);
+            assert!(group.verify_proof(&y1, &y2, &proof1).unwrap());
+
+            assert_eq!(
+                group.create_proof_with_rng(&x, &mut FailingRng),
+                Err(Error::RandomnessFailure)
+            );
+        }
     }
 
+    /// Compares the time taken to verify valid and forged proofs. Timings are
+    /// noisy on shared machines, so it only runs when asked with `--ignored`.
     #[test]
-    fn test_verify_scalar_success_toy_example_2() {
-        let p = BigUint::from(23u32);
-        let q = BigUint::from(11u32);
+    #[ignore]
+    fn test_verify_proof_timing() {
+        let group = Group::named(GroupId::Modp2048);
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let valid = group.create_proof(&x).unwrap();
+        let mut forged = valid.clone();
+        forged.c += 1u32;
 
-        let x = BigUint::from(6u32);
-        let g = Point::Scalar(BigUint::from(4u32));
-        let h = Point::Scalar(BigUint::from(9u32));
+        let median = |proof: &Proof| {
+            let mut times: Vec<_> = (0..51)
+                .map(|_| {
+                    let start = std::time::Instant::now();
+                    group.verify_proof(&y1, &y2, proof).unwrap();
+                    start.elapsed()
+                })
+                .collect();
+            times.sort();
+            times[times.len() / 2].as_secs_f64()
+        };
 
-        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+        let ratio = median(&valid) / median(&forged);
+        assert!((0.8..1.25).contains(&ratio), "timing ratio {}", ratio);
+    }
 
-        assert_eq!(y1, Point::Scalar(BigUint::from(2u32)));
-        assert_eq!(y2, Point::Scalar(BigUint::from(3u32)));
+    #[test]
+    fn test_generate_keys() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let keys = group.generate_keys(8).unwrap();
+            assert_eq!(keys.len(), 8);
 
-        let k = BigUint::from(7u32);
-        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+            let (p, _, g, h) = get_constants(&group);
+            for (x, y1, y2) in &keys {
+                let (expected_y1, expected_y2) = exponentiates_points(x, &g, &h, &p).unwrap();
+                assert_eq!((y1, y2), (&expected_y1, &expected_y2));
+            }
+        }
 
-        assert_eq!(r1, Point::Scalar(BigUint::from(8u32)));
-        assert_eq!(r2, Point::Scalar(BigUint::from(4u32)));
+        assert_eq!(Group::Scalar.generate_keys(0), Err(Error::InvalidKeyCount));
+    }
 
-        let c = BigUint::from(4u32);
+    #[test]
+    fn test_create_proof_with_hash() {
+        let hashes = [
+            ChallengeHash::Sha256,
+            ChallengeHash::Sha512,
+            ChallengeHash::Sha3_256,
+        ];
 
-        let s = solve_zk_challenge_s(&x, &k, &c, &q);
-        assert_eq!(s, BigUint::from(5u32));
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
 
-        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
-        assert!(verification)
+            for hash in hashes {
+                let proof = group.create_proof_with_hash(&x, hash).unwrap();
+                assert!(group
+                    .verify_proof_with_hash(&y1, &y2, &proof, hash)
+                    .unwrap());
+            }
+
+            let proof = group.create_proof(&x).unwrap();
+            assert!(group
+                .verify_proof_with_hash(&y1, &y2, &proof, ChallengeHash::Sha256)
+                .unwrap());
+        }
+
+        // the order of the scalar group is too small to rule out collisions
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        for hash in hashes {
+            let proof = group.create_proof_with_hash(&x, hash).unwrap();
+            for other in hashes.into_iter().filter(|other| *other != hash) {
+                assert!(!group
+                    .verify_proof_with_hash(&y1, &y2, &proof, other)
+                    .unwrap());
+            }
+        }
     }
 
     #[test]
-    fn test_verify_scalar_failure_toy_example_1() {
-        let p = BigUint::from(23u32);
-        let q = BigUint::from(11u32);
+    fn test_create_proof_with_context() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
 
-        let x = BigUint::from(6u32);
+        let proof = group.create_proof_with_context(&x, b"app-A").unwrap();
+        assert!(group
+            .verify_proof_with_context(&y1, &y2, &proof, b"app-A")
+            .unwrap());
+        assert!(!group
+            .verify_proof_with_context(&y1, &y2, &proof, b"app-B")
+            .unwrap());
+        assert!(!group.verify_proof(&y1, &y2, &proof).unwrap());
 
-        let g = Point::Scalar(BigUint::from(4u32));
-        let h = Point::Scalar(BigUint::from(9u32));
+        // an empty context is the same as no context
+        let proof = group.create_proof_with_context(&x, b"").unwrap();
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+        let proof = group.create_proof(&x).unwrap();
+        assert!(group
+            .verify_proof_with_context(&y1, &y2, &proof, b"")
+            .unwrap());
+    }
 
-        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
-        assert_eq!(y1, Point::Scalar(BigUint::from(2u32)));
-        assert_eq!(y2, Point::Scalar(BigUint::from(3u32)));
+    #[test]
+    fn test_create_proof_for_nonce() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
 
-        let k = BigUint::from(7u32);
-        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+        let nonce = group.new_nonce();
+        assert_eq!(nonce.len(), NONCE_LENGTH);
+        assert_ne!(nonce, group.new_nonce());
 
-        assert_eq!(r1, Point::Scalar(BigUint::from(8u32)));
-        assert_eq!(r2, Point::Scalar(BigUint::from(4u32)));
+        let proof = group.create_proof_for_nonce(&x, &nonce).unwrap();
+        assert!(group
+            .verify_proof_for_nonce(&y1, &y2, &proof, &nonce)
+            .unwrap());
+        assert!(!group
+            .verify_proof_for_nonce(&y1, &y2, &proof, &group.new_nonce())
+            .unwrap());
+        assert!(!group.verify_proof(&y1, &y2, &proof).unwrap());
+        assert!(!group
+            .verify_proof_with_context(&y1, &y2, &proof, &nonce)
+            .unwrap());
+    }
 
-        let c = BigUint::from(4u32);
+    #[test]
+    fn test_verify_proof_batch_parallel() {
+        let group = Group::EllipticCurve;
+        let mut public_keys = Vec::new();
+        let mut proofs = Vec::new();
+        for _ in 0..6 {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            proofs.push(group.create_proof(&x).unwrap());
+            public_keys.push((y1, y2));
+        }
+        proofs[4].s += 1u32;
 
-        let mut s = solve_zk_challenge_s(&x, &k, &c, &q);
+        let cancel = AtomicBool::new(false);
+        let expected = vec![true, true, true, true, false, true];
+        for workers in [0, 1, 4, 8] {
+            let results = group
+                .verify_proof_batch_parallel(&public_keys, &proofs, workers, &cancel)
+                .unwrap();
+            assert_eq!(results, expected);
+        }
 
-        // we compute `s` slightly bad
-        s = s - BigUint::one();
+        assert_eq!(
+            group.verify_proof_batch_parallel(&public_keys, &proofs[1..], 4, &cancel),
+            Err(Error::LengthMismatch)
+        );
 
-        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
-        assert!(!verification)
+        cancel.store(true, Ordering::Relaxed);
+        assert_eq!(
+            group.verify_proof_batch_parallel(&public_keys, &proofs, 4, &cancel),
+            Err(Error::Cancelled)
+        );
     }
 
     #[test]
-    fn test_verify_elliptic_curve_success_example_1() {
-        let p = Secp256k1Point::prime();
-        let q = Secp256k1Point::n();
+    fn test_verify_proof_detailed() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
 
-        let x = BigUint::from(300u32);
-        let g = Secp256k1Point::generator();
-        let h = g.clone().scale(BigUint::from(13u32));
+        let result = group.verify_proof_detailed(&y1, &y2, &proof);
+        assert!(result.valid);
+        assert_eq!(result.code, RejectCode::Accepted);
 
-        let g = Point::from_secp256k1(&g);
-        let h = Point::from_secp256k1(&h);
-        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+        let mut forged = proof.clone();
+        forged.c += 1u32;
+        let result = group.verify_proof_detailed(&y1, &y2, &forged);
+        assert!(!result.valid);
+        assert_eq!(result.code, RejectCode::BadCommitment);
 
-        let k = BigUint::from(10u32);
-        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+        let mut forged = proof.clone();
+        forged.s += 1u32;
+        assert_eq!(
+            group.verify_proof_detailed(&y1, &y2, &forged).code,
+            RejectCode::BadResponse
+        );
 
-        let c = BigUint::from(894u32);
+        let (_, _, y) = Group::Scalar.generate_key().unwrap();
+        let result = group.verify_proof_detailed(&y1, &y, &proof);
+        assert_eq!(result.code, RejectCode::Malformed);
+        assert_eq!(result.reason(), "a point is not an element of the group");
+    }
 
-        let s = solve_zk_challenge_s(&x, &k, &c, &q);
+    #[test]
+    fn test_verify_proof_batch_detailed() {
+        let group = Group::EllipticCurve;
+        let mut public_keys = Vec::new();
+        let mut proofs = Vec::new();
+        for _ in 0..4 {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            proofs.push(group.create_proof(&x).unwrap());
+            public_keys.push((y1, y2));
+        }
+        proofs[1].s += 1u32;
+        public_keys[3].1 = Group::Scalar.generate_key().unwrap().1;
 
-        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
-        assert!(verification)
+        let results = group
+            .verify_proof_batch_detailed(&public_keys, &proofs)
+            .unwrap();
+        let codes: Vec<RejectCode> = results.iter().map(|result| result.code).collect();
+        assert_eq!(
+            codes,
+            [
+                RejectCode::Accepted,
+                RejectCode::BadResponse,
+                RejectCode::Accepted,
+                RejectCode::Malformed
+            ]
+        );
+        assert!(!results.iter().all(|result| result.valid));
+
+        assert_eq!(
+            group.verify_proof_batch_detailed(&public_keys, &proofs[1..]),
+            Err(Error::LengthMismatch)
+        );
     }
 
     #[test]
-    fn test_verify_elliptic_curve_failure_example_1() {
-        let p = Secp256k1Point::prime();
-        let q = Secp256k1Point::n();
+    fn test_generate_key_from_seed() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let seed = b"0123456789abcdef";
 
-        let x = BigUint::from(300u32);
-        let g = Secp256k1Point::generator();
-        let h = g.clone().scale(BigUint::from(13u32));
+            let (x1, y1, y2) = group.generate_key_from_seed(seed).unwrap();
+            let (x2, y1_again, y2_again) = group.generate_key_from_seed(seed).unwrap();
+            assert_eq!(x1, x2);
+            assert_eq!(y1, y1_again);
+            assert_eq!(y2, y2_again);
 
-        let g = Point::from_secp256k1(&g);
-        let h = Point::from_secp256k1(&h);
-        let (y1, y2) = exponentiates_points(&x, &g, &h, &p).unwrap();
+            let (x3, _, _) = group.generate_key_from_seed(b"0123456789abcdeg").unwrap();
+            assert_ne!(x1, x3);
 
-        let k = BigUint::from(10u32);
-        let (r1, r2) = exponentiates_points(&k, &g, &h, &p).unwrap();
+            let proof = group.create_proof(&x1).unwrap();
+            assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+        }
 
-        let c = BigUint::from(894u32);
+        assert_eq!(
+            Group::Scalar.generate_key_from_seed(b"too short"),
+            Err(Error::InvalidSeed)
+        );
 
-        let s = solve_zk_challenge_s(&x, &k, &c, &q) + BigUint::one();
+        // the seed is stretched past the order of the large groups, whose
+        // keys would be read off their proofs otherwise
+        let group = Group::named(GroupId::Modp2048);
+        let (x, _, _) = group.generate_key_from_seed(b"0123456789abcdef").unwrap();
+        assert!(x.bits() > 2000);
+    }
 
-        let verification = verify(&r1, &r2, &y1, &y2, &g, &h, &c, &s, &p).unwrap();
-        assert!(!verification)
+    #[test]
+    fn test_public_key() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key_from_seed(b"0123456789abcdef").unwrap();
+            assert_eq!(group.public_key(&x).unwrap(), (y1, y2));
+
+            let (_, q, _, _) = get_constants(&group);
+            assert_eq!(
+                group.public_key(&BigUint::zero()),
+                Err(Error::InvalidSecret)
+            );
+            assert_eq!(group.public_key(&BigUint::one()), Err(Error::InvalidSecret));
+            assert_eq!(group.public_key(&q), Err(Error::InvalidSecret));
+        }
+
+        // a secret of the elliptic curve group is too big for the scalar one
+        let (x, _, _) = Group::EllipticCurve
+            .generate_key_from_seed(b"0123456789abcdef")
+            .unwrap();
+        assert_eq!(Group::Scalar.public_key(&x), Err(Error::InvalidSecret));
     }
 
     #[test]
-    fn test_serialize() {
-        let p = Point::Scalar(BigUint::from(65256u32));
+    fn test_verify_proof_any() {
+        // a proof of the integer group verifies for other keys now and then
+        let group = Group::EllipticCurve;
+        let keys: Vec<_> = (0..3).map(|_| group.generate_key().unwrap()).collect();
+        let public_keys: Vec<(Point, Point)> = keys
+            .iter()
+            .map(|(_, y1, y2)| (y1.clone(), y2.clone()))
+            .collect();
 
-        assert_eq!(p.serialize(), vec![0xfe, 0xe8]);
+        for (i, (x, _, _)) in keys.iter().enumerate() {
+            let proof = group.create_proof(x).unwrap();
+            assert_eq!(group.verify_proof_any(&public_keys, &proof), Ok(Some(i)));
+        }
+        let (x, _, _) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        assert_eq!(group.verify_proof_any(&public_keys, &proof), Ok(None));
+        assert_eq!(group.verify_proof_any(&[], &proof), Ok(None));
+    }
 
-        let p = Point::ECPoint(BigUint::from(65256u32), BigUint::from(8475u32));
+    #[test]
+    fn test_verify_proof_batch() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let mut public_keys = Vec::new();
+            let mut proofs = Vec::new();
+            for _ in 0..4 {
+                let (x, y1, y2) = group.generate_key().unwrap();
+                proofs.push(group.create_proof(&x).unwrap());
+                public_keys.push((y1, y2));
+            }
 
-        assert_eq!(p.serialize(), vec![0xfe, 0xe8, 0x21, 0x1b]);
+            assert_eq!(
+                group.verify_proof_batch(&public_keys, &proofs).unwrap(),
+                vec![true; 4]
+            );
+            assert!(group
+                .verify_proof_batch_fast(&public_keys, &proofs)
+                .unwrap());
 
-        // one array is longer than the other
-        let p = Point::ECPoint(BigUint::from(65256u32), BigUint::from(83957234u32));
+            proofs[2].s += BigUint::one();
+            assert_eq!(
+                group.verify_proof_batch(&public_keys, &proofs).unwrap(),
+                vec![true, true, false, true]
+            );
+            assert!(!group
+                .verify_proof_batch_fast(&public_keys, &proofs)
+                .unwrap());
+
+            assert_eq!(
+                group.verify_proof_batch(&public_keys[1..], &proofs),
+                Err(Error::LengthMismatch)
+            );
+        }
 
+        // a commitment times the element of order 2 fails alone, but would
+        // pass the combination when its weight is even
+        let group = Group::Scalar;
+        let (p, q, g, h) = get_constants(&group);
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let (k, commitment) = group.commit().unwrap();
+        let r1 = match &commitment.r1 {
+            Point::Scalar(r1) => Point::Scalar(r1 * (&p - 1u32) % &p),
+            _ => unreachable!(),
+        };
+        let commitment = Commitment {
+            r1,
+            r2: commitment.r2,
+        };
+        let points = [&g, &h, &y1, &y2, &commitment.r1, &commitment.r2];
+        let c = fiat_shamir_challenge(&points, &q, ChallengeHash::default(), &[]);
+        let proof = group.respond(&commitment, &k, &c, &x);
+        assert!(!group.verify_proof(&y1, &y2, &proof).unwrap());
         assert_eq!(
-            p.serialize(),
-            vec![0x00, 0x00, 0xfe, 0xe8, 0x05, 0x01, 0x15, 0xf2]
+            group.verify_proof_batch_fast(&[(y1, y2)], &[proof]),
+            Err(Error::InvalidPoint)
         );
+    }
 
-        // the other way around
-        let p = Point::ECPoint(BigUint::from(83957234u32), BigUint::from(65256u32));
+    #[tokio::test]
+    async fn test_create_proof_async() {
+        let group = Group::Scalar;
+        let (x, y1, y2) = group.generate_key().unwrap();
 
-        assert_eq!(
-            p.serialize(),
-            vec![0x05, 0x01, 0x15, 0xf2, 0x00, 0x00, 0xfe, 0xe8]
-        );
+        let proof = group.create_proof_async(&x).await.unwrap();
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+
+        // the caller may stop waiting for the proof at any time
+        tokio::select! {
+            biased;
+            _ = async {} => {}
+            _ = group.create_proof_async(&x) => panic!("the proof should be cancelled"),
+        }
     }
 
     #[test]
-    fn test_deserialize() {
-        let p = Point::deserialize(vec![0xfe, 0xe8], &Group::Scalar);
+    fn test_new_with_params() {
+        let group = Group::new_with_params(&[23], &[11], &[4], &[9]).unwrap();
 
-        assert_eq!(p, Point::Scalar(BigUint::from(65256u32)));
+        let (p, q, g, h) = group.params();
+        assert_eq!((p, q, g, h), (vec![23], vec![11], vec![4], vec![9]));
 
-        let p = Point::deserialize(vec![0xfe, 0xe8, 0x21, 0x1b], &Group::EllipticCurve);
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
 
-        assert_eq!(
-            p,
-            Point::ECPoint(BigUint::from(65256u32), BigUint::from(8475u32))
-        );
+        let invalid: [([u8; 4], Error); 12] = [
+            // p is not prime
+            ([21, 10, 4, 9], Error::NotPrime),
+            ([1, 1, 4, 9], Error::NotPrime),
+            // q doesn't divide p - 1
+            ([23, 7, 4, 9], Error::BadOrder),
+            ([23, 0, 4, 9], Error::BadOrder),
+            // q divides p - 1 but is not prime
+            ([23, 22, 4, 9], Error::BadOrder),
+            // 5 is a generator of the whole group of order 22
+            ([23, 11, 5, 9], Error::BadGenerator),
+            ([23, 11, 4, 5], Error::BadGenerator),
+            // the identity, zero and numbers out of the group
+            ([23, 11, 4, 1], Error::BadGenerator),
+            ([23, 11, 0, 9], Error::BadGenerator),
+            ([23, 11, 27, 9], Error::BadGenerator),
+            ([23, 11, 4, 4], Error::SameGenerators),
+            ([23, 11, 9, 9], Error::SameGenerators),
+        ];
+        for ([p, q, g, h], err) in invalid {
+            assert!(
+                matches!(Group::new_with_params(&[p], &[q], &[g], &[h]), Err(e) if e == err),
+                "p {} q {} g {} h {}",
+                p,
+                q,
+                g,
+                h
+            );
+        }
 
-        // one array is longer than the other
-        let p = Point::deserialize(
-            vec![0x00, 0x00, 0xfe, 0xe8, 0x05, 0x01, 0x15, 0xf2],
-            &Group::EllipticCurve,
-        );
+        // the parameters read back from a group create the same group
+        let (p, q, g, h) = Group::Scalar.params();
+        let group = Group::new_with_params(&p, &q, &g, &h).unwrap();
+        assert_eq!(get_constants(&group), get_constants(&Group::Scalar));
+
+        let (p, q, g, h) = Group::named(GroupId::Modp3072).params();
+        let group = Group::new_with_params(&p, &q, &g, &h).unwrap();
+        assert_proofs_hide_secret(&group);
+    }
+
+    /// Creates proofs in a large group and checks that their secret isn't
+    /// `(q - s) / c` rounded up, which it is when `k` and `x` are much smaller
+    /// than `q`.
+    fn assert_proofs_hide_secret(group: &Group) {
+        let (_, q, _, _) = get_constants(group);
+        for _ in 0..4 {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+            assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+            let guess = (&q - &proof.s) / &proof.c;
+            assert!(guess != x && guess + 1u32 != x);
+        }
+    }
+
+    #[test]
+    fn test_generate_params() {
+        let cancel = AtomicBool::new(false);
+        let mut candidates = Vec::new();
+        let progress = |n| candidates.push(n);
+        let group =
+            Group::generate_safe_prime_group(64, &mut thread_rng(), progress, &cancel).unwrap();
+        let expected: Vec<u64> = (1..=candidates.len() as u64).collect();
+        assert_eq!(candidates, expected);
+
+        // the parameters are valid and can be used right away
+        let (p, q, g, h) = group.params();
+        let params = Group::new_with_params(&p, &q, &g, &h).unwrap();
+        assert_eq!(params.fingerprint(), group.fingerprint());
+
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+
+        assert!(matches!(
+            Group::generate_params(1024, &mut thread_rng()),
+            Err(Error::InvalidGroupParameters)
+        ));
+
+        cancel.store(true, Ordering::Relaxed);
+        assert!(matches!(
+            Group::generate_params_with_progress(2048, &mut thread_rng(), |_| {}, &cancel),
+            Err(Error::Cancelled)
+        ));
+    }
+
+    /// Creates proofs in a freshly generated 2048-bit group. Finding the safe
+    /// prime takes minutes, so it only runs when asked with `--ignored`.
+    #[test]
+    #[ignore]
+    fn test_generate_params_proof() {
+        let group = Group::generate_params(2048, &mut thread_rng()).unwrap();
+        assert_proofs_hide_secret(&group);
+    }
+
+    #[test]
+    fn test_is_safe_prime() {
+        for id in [GroupId::Modp2048, GroupId::Modp3072, GroupId::Modp4096] {
+            assert_eq!(Group::named(id).is_safe_prime(), Ok(true));
+        }
+        let group = Group::new_with_params(&[23], &[11], &[4], &[9]).unwrap();
+        assert_eq!(group.is_safe_prime(), Ok(true));
+        let cancel = AtomicBool::new(false);
+        let group =
+            Group::generate_safe_prime_group(64, &mut thread_rng(), |_| {}, &cancel).unwrap();
+        assert_eq!(group.is_safe_prime(), Ok(true));
+
+        assert_eq!(Group::Scalar.is_safe_prime(), Ok(true));
+        // (29 - 1) / 7 = 4
+        let group = Group::new_with_params(&[29], &[7], &[16], &[23]).unwrap();
+        assert_eq!(group.is_safe_prime(), Ok(false));
 
         assert_eq!(
-            p,
-            Point::ECPoint(BigUint::from(65256u32), BigUint::from(83957234u32))
+            Group::EllipticCurve.is_safe_prime(),
+            Err(Error::Unsupported)
         );
+    }
 
-        // the other way around
-        let p = Point::deserialize(
-            vec![0x05, 0x01, 0x15, 0xf2, 0x00, 0x00, 0xfe, 0xe8],
-            &Group::EllipticCurve,
-        );
+    #[test]
+    fn test_fingerprint() {
+        let (p, q, g, h) = Group::Scalar.params();
+        let group = Group::new_with_params(&p, &q, &g, &h).unwrap();
+        assert_eq!(group.fingerprint(), Group::Scalar.fingerprint());
 
-        assert_eq!(
-            p,
-            Point::ECPoint(BigUint::from(83957234u32), BigUint::from(65256u32))
+        let named = Group::named(GroupId::Modp2048);
+        let (p, q, g, h) = named.params();
+        let group = Group::new_with_params(&p, &q, &g, &h).unwrap();
+        assert_eq!(group.fingerprint(), named.fingerprint());
+
+        assert_ne!(
+            Group::Scalar.fingerprint(),
+            Group::EllipticCurve.fingerprint()
         );
+        assert_ne!(Group::Scalar.fingerprint(), named.fingerprint());
     }
 }
@@ -0,0 +1,225 @@
+//! Proofs of knowledge of a key that belongs to a published set, checked
+//! against the root of a Merkle tree of the set instead of the whole set.
+//!
+//! The tree is the one of RFC 9162 (Certificate Transparency 2.0) over the
+//! public keys, with the hash chosen by the caller:
+//!
+//! ```text
+//! leaf = H(0x00 || len(y1) || y1 || len(y2) || y2)
+//! node = H(0x01 || left || right)
+//! ```
+//!
+//! where `y1` and `y2` are serialized like `Point::serialize` and `len` is
+//! their 4-byte big-endian length. A tree of `n > 1` keys is the node of the
+//! tree of the first `k` keys and of the tree of the others, `k` being the
+//! largest power of two below `n`, so no key is ever duplicated.
+use crate::{write_length_prefixed, ChallengeHash, Error, Group, Proof, PublicKey};
+
+/// Position of a key in the tree and the hashes of the siblings of the nodes
+/// from its leaf up to the root, the audit path of RFC 9162.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct MerklePath {
+    pub index: u64,
+    pub leaf_count: u64,
+    pub siblings: Vec<Vec<u8>>,
+}
+
+/// Returns the root of the tree of `keys`, `Error::InvalidKeyCount` if there
+/// are none.
+pub fn merkle_root(keys: &[PublicKey], hash: ChallengeHash) -> Result<Vec<u8>, Error> {
+    if keys.is_empty() {
+        return Err(Error::InvalidKeyCount);
+    }
+    Ok(tree_hash(keys, hash))
+}
+
+/// Returns the path of the key at `index` in the tree of `keys`, to hand to
+/// its owner. `Error::InvalidArguments` if there is no such key.
+pub fn merkle_path(
+    keys: &[PublicKey],
+    index: usize,
+    hash: ChallengeHash,
+) -> Result<MerklePath, Error> {
+    if index >= keys.len() {
+        return Err(Error::InvalidArguments);
+    }
+
+    let (path_index, leaf_count) = (to_u64(index)?, to_u64(keys.len())?);
+    let mut siblings = Vec::new();
+    let (mut keys, mut index) = (keys, index);
+    // the siblings are found from the root down and listed from the leaf up
+    while keys.len() > 1 {
+        let k = split(keys.len());
+        if index < k {
+            siblings.push(tree_hash(&keys[k..], hash));
+            keys = &keys[..k];
+        } else {
+            siblings.push(tree_hash(&keys[..k], hash));
+            keys = &keys[k..];
+            index -= k;
+        }
+    }
+    siblings.reverse();
+
+    Ok(MerklePath {
+        index: path_index,
+        leaf_count,
+        siblings,
+    })
+}
+
+impl Group {
+    /// Verifies the proof for `key` like `verify_proof_with_key`, and that
+    /// `key` is the leaf of `path` in the tree whose root is `root`. The
+    /// proof is verified even if the key is not in the tree, so the time
+    /// taken doesn't tell which check failed.
+    pub fn verify_proof_with_membership(
+        self: &Self,
+        key: &PublicKey,
+        proof: &Proof,
+        path: &MerklePath,
+        root: &[u8],
+        hash: ChallengeHash,
+    ) -> Result<bool, Error> {
+        let valid = self.verify_proof_with_key(key, proof)?;
+        Ok(is_member(key, path, root, hash) & valid)
+    }
+}
+
+/// Checks the audit path of `key` with the algorithm of RFC 9162, section
+/// 2.1.3.2.
+fn is_member(key: &PublicKey, path: &MerklePath, root: &[u8], hash: ChallengeHash) -> bool {
+    if path.index >= path.leaf_count {
+        return false;
+    }
+
+    let (mut node, mut last) = (path.index, path.leaf_count - 1);
+    let mut r = leaf_hash(key, hash);
+    for sibling in &path.siblings {
+        if last == 0 {
+            return false;
+        }
+        if node & 1 == 1 || node == last {
+            r = node_hash(sibling, &r, hash);
+            while node & 1 == 0 && node != 0 {
+                node >>= 1;
+                last >>= 1;
+            }
+        } else {
+            r = node_hash(&r, sibling, hash);
+        }
+        node >>= 1;
+        last >>= 1;
+    }
+    last == 0 && r == root
+}
+
+fn tree_hash(keys: &[PublicKey], hash: ChallengeHash) -> Vec<u8> {
+    match keys {
+        [key] => leaf_hash(key, hash),
+        _ => {
+            let k = split(keys.len());
+            node_hash(
+                &tree_hash(&keys[..k], hash),
+                &tree_hash(&keys[k..], hash),
+                hash,
+            )
+        }
+    }
+}
+
+/// Returns the largest power of two below `n`, for `n > 1`.
+fn split(n: usize) -> usize {
+    1 << (usize::BITS - 1 - (n - 1).leading_zeros())
+}
+
+fn leaf_hash(key: &PublicKey, hash: ChallengeHash) -> Vec<u8> {
+    let mut v = vec![0x00];
+    write_length_prefixed(&mut v, &key.y1.serialize());
+    write_length_prefixed(&mut v, &key.y2.serialize());
+    hash.digest(&v)
+}
+
+fn node_hash(left: &[u8], right: &[u8], hash: ChallengeHash) -> Vec<u8> {
+    hash.digest(&[&[0x01], left, right].concat())
+}
+
+fn to_u64(n: usize) -> Result<u64, Error> {
+    u64::try_from(n).map_err(|_| Error::InvalidArguments)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn keys(group: &Group, n: usize) -> Vec<PublicKey> {
+        (0..n)
+            .map(|_| group.generate_private_key().unwrap())
+            .map(|key| key.public_key(group).unwrap())
+            .collect()
+    }
+
+    #[test]
+    fn test_merkle_tree() {
+        let group = Group::EllipticCurve;
+        let hash = ChallengeHash::Sha256;
+        assert_eq!(split(2), 1);
+        assert_eq!((split(5), split(8), split(9)), (4, 4, 8));
+
+        let keys = keys(&group, 7);
+        let left = node_hash(&leaf_hash(&keys[0], hash), &leaf_hash(&keys[1], hash), hash);
+        assert_eq!(merkle_root(&keys[..2], hash), Ok(left));
+        assert_eq!(merkle_root(&keys[..1], hash), Ok(leaf_hash(&keys[0], hash)));
+        assert_eq!(merkle_root(&[], hash), Err(Error::InvalidKeyCount));
+
+        for n in 1..=keys.len() {
+            let root = merkle_root(&keys[..n], hash).unwrap();
+            for (i, key) in keys[..n].iter().enumerate() {
+                let path = merkle_path(&keys[..n], i, hash).unwrap();
+                assert!(is_member(key, &path, &root, hash));
+                // another key at the same position
+                assert!(!is_member(&keys[(i + 1) % keys.len()], &path, &root, hash));
+            }
+        }
+        assert_eq!(
+            merkle_path(&keys, keys.len(), hash),
+            Err(Error::InvalidArguments)
+        );
+    }
+
+    #[test]
+    fn test_verify_proof_with_membership() {
+        let group = Group::EllipticCurve;
+        let hash = ChallengeHash::Sha3_256;
+        let mut keys = keys(&group, 4);
+        let private_key = group.generate_private_key().unwrap();
+        let key = private_key.public_key(&group).unwrap();
+        keys.insert(2, key.clone());
+
+        let root = merkle_root(&keys, hash).unwrap();
+        let path = merkle_path(&keys, 2, hash).unwrap();
+        let proof = group.create_proof_with_key(&private_key).unwrap();
+        let verify = |path: &MerklePath, root: &[u8], hash| {
+            group
+                .verify_proof_with_membership(&key, &proof, path, root, hash)
+                .unwrap()
+        };
+        assert!(verify(&path, &root, hash));
+
+        assert!(!verify(&path, &root, ChallengeHash::Sha256));
+        let other_root = merkle_root(&keys[..4], hash).unwrap();
+        assert!(!verify(&path, &other_root, hash));
+        let mut moved = path.clone();
+        moved.index = 3;
+        assert!(!verify(&moved, &root, hash));
+        let mut extended = path.clone();
+        extended.siblings.push(root.clone());
+        assert!(!verify(&extended, &root, hash));
+
+        let mut tampered = proof.clone();
+        tampered.s += 1u32;
+        assert!(!group
+            .verify_proof_with_membership(&key, &tampered, &path, &root, hash)
+            .unwrap());
+    }
+}
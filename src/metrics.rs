@@ -0,0 +1,199 @@
+//! Counters and latency histograms of the proofs created and verified by the
+//! process, for monitoring. They count the non-interactive proofs created by
+//! the `create_proof*` methods of all the groups and `start_proof`, the
+//! answers of the interactive protocol and the proofs checked by the
+//! `verify_proof*` methods, `verify_interactive` and the Verifier, one per
+//! proof for the batches. Aggregate, conjunctive, ring and DLEQ proofs are not
+//! counted. The metrics can be exported in the text format of Prometheus
+//! without any dependency:
+//!
+//! - `cpzkp_proofs_created_total`
+//! - `cpzkp_verifications_total{result="valid|invalid|error"}`
+//! - `cpzkp_proof_creation_seconds` and `cpzkp_verification_seconds`
+use std::fmt::Write;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::OnceLock;
+use std::time::Duration;
+
+use crate::Error;
+
+/// Upper bounds in seconds of the buckets of the latency histograms.
+const BUCKETS: [f64; 10] = [0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1.0, 5.0];
+
+/// Histogram of durations with the cumulative buckets of Prometheus.
+#[derive(Debug, Default)]
+struct Histogram {
+    buckets: [AtomicU64; BUCKETS.len()],
+    count: AtomicU64,
+    sum_nanos: AtomicU64,
+}
+
+impl Histogram {
+    fn observe(self: &Self, duration: Duration) {
+        let secs = duration.as_secs_f64();
+        for (bucket, bound) in self.buckets.iter().zip(BUCKETS) {
+            if secs <= bound {
+                bucket.fetch_add(1, Ordering::Relaxed);
+            }
+        }
+        self.count.fetch_add(1, Ordering::Relaxed);
+        let nanos = u64::try_from(duration.as_nanos()).unwrap_or(u64::MAX);
+        self.sum_nanos.fetch_add(nanos, Ordering::Relaxed);
+    }
+
+    fn render(self: &Self, out: &mut String, name: &str, help: &str) {
+        let count = self.count.load(Ordering::Relaxed);
+        let sum = self.sum_nanos.load(Ordering::Relaxed) as f64 / 1e9;
+
+        let _ = writeln!(out, "# HELP {} {}", name, help);
+        let _ = writeln!(out, "# TYPE {} histogram", name);
+        for (bucket, bound) in self.buckets.iter().zip(BUCKETS) {
+            let n = bucket.load(Ordering::Relaxed);
+            let _ = writeln!(out, "{}_bucket{{le=\"{}\"}} {}", name, bound, n);
+        }
+        let _ = writeln!(out, "{}_bucket{{le=\"+Inf\"}} {}", name, count);
+        let _ = writeln!(out, "{}_sum {}", name, sum);
+        let _ = writeln!(out, "{}_count {}", name, count);
+    }
+}
+
+/// Metrics of the process, see `metrics`.
+#[derive(Debug, Default)]
+pub struct Metrics {
+    proofs_created: AtomicU64,
+    valid: AtomicU64,
+    invalid: AtomicU64,
+    failed: AtomicU64,
+    creation_latency: Histogram,
+    verification_latency: Histogram,
+}
+
+impl Metrics {
+    pub fn proofs_created(self: &Self) -> u64 {
+        self.proofs_created.load(Ordering::Relaxed)
+    }
+
+    /// Returns the number of verifications that accepted the proof, rejected
+    /// it and failed with an error.
+    pub fn verifications(self: &Self) -> (u64, u64, u64) {
+        (
+            self.valid.load(Ordering::Relaxed),
+            self.invalid.load(Ordering::Relaxed),
+            self.failed.load(Ordering::Relaxed),
+        )
+    }
+
+    /// Renders the metrics in the text exposition format of Prometheus, to be
+    /// served on the metrics endpoint of the application.
+    pub fn render_prometheus(self: &Self) -> String {
+        let mut out = String::new();
+        let _ = writeln!(
+            out,
+            "# HELP cpzkp_proofs_created_total Number of proofs created."
+        );
+        let _ = writeln!(out, "# TYPE cpzkp_proofs_created_total counter");
+        let _ = writeln!(out, "cpzkp_proofs_created_total {}", self.proofs_created());
+
+        let (valid, invalid, failed) = self.verifications();
+        let _ = writeln!(
+            out,
+            "# HELP cpzkp_verifications_total Number of proofs verified by result."
+        );
+        let _ = writeln!(out, "# TYPE cpzkp_verifications_total counter");
+        for (result, n) in [("valid", valid), ("invalid", invalid), ("error", failed)] {
+            let _ = writeln!(
+                out,
+                "cpzkp_verifications_total{{result=\"{}\"}} {}",
+                result, n
+            );
+        }
+
+        self.creation_latency.render(
+            &mut out,
+            "cpzkp_proof_creation_seconds",
+            "Time taken to create a proof.",
+        );
+        self.verification_latency.render(
+            &mut out,
+            "cpzkp_verification_seconds",
+            "Time taken to verify a proof.",
+        );
+        out
+    }
+
+    pub(crate) fn record_creation(self: &Self, duration: Duration) {
+        self.proofs_created.fetch_add(1, Ordering::Relaxed);
+        self.creation_latency.observe(duration);
+    }
+
+    pub(crate) fn record_verification(
+        self: &Self,
+        result: &Result<bool, Error>,
+        duration: Duration,
+    ) {
+        let counter = match result {
+            Ok(true) => &self.valid,
+            Ok(false) => &self.invalid,
+            Err(_) => &self.failed,
+        };
+        counter.fetch_add(1, Ordering::Relaxed);
+        self.verification_latency.observe(duration);
+    }
+}
+
+/// Returns the metrics of the proofs of all the groups of the process.
+pub fn metrics() -> &'static Metrics {
+    static METRICS: OnceLock<Metrics> = OnceLock::new();
+    METRICS.get_or_init(Default::default)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::Group;
+
+    #[test]
+    fn test_metrics() {
+        // the metrics are shared with the other tests running concurrently,
+        // so only increases can be checked
+        let group = Group::Scalar;
+        let (x, y1, y2) = group.generate_key().unwrap();
+
+        let created = metrics().proofs_created();
+        let proof = group.create_proof(&x).unwrap();
+        assert!(metrics().proofs_created() > created);
+
+        let (valid, invalid, failed) = metrics().verifications();
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+        let mut wrong = proof.clone();
+        wrong.s += 1u32;
+        group.verify_proof(&y1, &y2, &wrong).unwrap();
+        let (_, other, _) = Group::EllipticCurve.generate_key().unwrap();
+        assert!(group.verify_proof(&y1, &other, &proof).is_err());
+
+        let after = metrics().verifications();
+        assert!(after.0 > valid && after.1 >= invalid && after.2 > failed);
+
+        let text = metrics().render_prometheus();
+        assert!(text.contains("# TYPE cpzkp_proofs_created_total counter\n"));
+        assert!(text.contains("cpzkp_verifications_total{result=\"valid\"} "));
+        assert!(text.contains("cpzkp_proof_creation_seconds_bucket{le=\"+Inf\"} "));
+        assert!(text.contains("cpzkp_verification_seconds_count "));
+    }
+
+    #[test]
+    fn test_histogram() {
+        let histogram = Histogram::default();
+        histogram.observe(Duration::from_millis(2));
+        histogram.observe(Duration::from_secs(10));
+
+        let mut out = String::new();
+        histogram.render(&mut out, "test", "Test.");
+        assert!(out.contains("test_bucket{le=\"0.001\"} 0\n"));
+        assert!(out.contains("test_bucket{le=\"0.005\"} 1\n"));
+        assert!(out.contains("test_bucket{le=\"5\"} 1\n"));
+        assert!(out.contains("test_bucket{le=\"+Inf\"} 2\n"));
+        assert!(out.contains("test_sum 10.002\n"));
+        assert!(out.contains("test_count 2\n"));
+    }
+}
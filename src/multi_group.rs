@@ -0,0 +1,104 @@
+//! Verification of proofs of several groups at once, e.g. while rotating to
+//! stronger parameters: proofs created with the previous group keep verifying
+//! until the rotation is over. Each proof is routed to its group by the
+//! fingerprint written by `Proof::serialize_with_group`.
+use crate::{Error, Group, Point, Proof, ProofHeader};
+
+/// Verifier of the proofs of a set of groups, identified by their
+/// fingerprints.
+#[derive(Debug, Clone, Default)]
+pub struct MultiGroupVerifier {
+    groups: Vec<([u8; 32], Group)>,
+}
+
+impl MultiGroupVerifier {
+    pub fn new(groups: Vec<Group>) -> MultiGroupVerifier {
+        let mut verifier = MultiGroupVerifier::default();
+        for group in groups {
+            verifier.add(group);
+        }
+        verifier
+    }
+
+    /// Adds `group` to the groups of the verifier, unless a group with the
+    /// same parameters is already there.
+    pub fn add(self: &mut Self, group: Group) {
+        let fingerprint = group.fingerprint();
+        if !self.groups.iter().any(|(f, _)| *f == fingerprint) {
+            self.groups.push((fingerprint, group));
+        }
+    }
+
+    /// Removes the group with the fingerprint `fingerprint`, e.g. once the
+    /// rotation away from it is over. Returns `false` if it wasn't there.
+    pub fn remove(self: &mut Self, fingerprint: &[u8; 32]) -> bool {
+        let len = self.groups.len();
+        self.groups.retain(|(f, _)| f != fingerprint);
+        self.groups.len() != len
+    }
+
+    /// Returns the group of the serialized proof `v`, e.g. to look up the
+    /// public values of the prover in it. Proofs without fingerprint or of a
+    /// group the verifier doesn't hold return `Error::UnknownGroup`.
+    pub fn group_of(self: &Self, v: &[u8]) -> Result<&Group, Error> {
+        let header = ProofHeader::read(v)?;
+        let fingerprint = header.group.ok_or(Error::UnknownGroup)?;
+
+        self.groups
+            .iter()
+            .find(|(f, _)| *f == fingerprint)
+            .map(|(_, group)| group)
+            .ok_or(Error::UnknownGroup)
+    }
+
+    /// Deserializes the proof `v` with its group, see `group_of`, and verifies
+    /// it against the public values `(y1, y2)`, which must belong to the same
+    /// group.
+    pub fn verify(self: &Self, y1: &Point, y2: &Point, v: Vec<u8>) -> Result<bool, Error> {
+        let group = self.group_of(&v)?;
+        let proof = Proof::deserialize(v, group)?;
+        group.verify_proof(y1, y2, &proof)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::GroupId;
+
+    #[test]
+    fn test_multi_group_verifier() {
+        let old = Group::named(GroupId::Modp2048);
+        let new = Group::EllipticCurve;
+        let mut verifier = MultiGroupVerifier::new(vec![old.clone(), new.clone(), new.clone()]);
+
+        for group in [&old, &new] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let v = group.create_proof(&x).unwrap().serialize_with_group(group);
+
+            assert_eq!(
+                verifier.group_of(&v).unwrap().fingerprint(),
+                group.fingerprint()
+            );
+            assert_eq!(verifier.verify(&y1, &y2, v), Ok(true));
+        }
+
+        let (x, y1, y2) = Group::Scalar.generate_key().unwrap();
+        let proof = Group::Scalar.create_proof(&x).unwrap();
+        assert_eq!(
+            verifier.verify(&y1, &y2, proof.serialize_with_group(&Group::Scalar)),
+            Err(Error::UnknownGroup)
+        );
+        assert_eq!(
+            verifier.verify(&y1, &y2, proof.serialize(&Group::Scalar)),
+            Err(Error::UnknownGroup)
+        );
+
+        // the rotation is over
+        let (x, y1, y2) = old.generate_key().unwrap();
+        let v = old.create_proof(&x).unwrap().serialize_with_group(&old);
+        assert!(verifier.remove(&old.fingerprint()));
+        assert!(!verifier.remove(&old.fingerprint()));
+        assert_eq!(verifier.verify(&y1, &y2, v), Err(Error::UnknownGroup));
+    }
+}
@@ -0,0 +1,185 @@
+//! Cache of the custom groups of a service using many of them, e.g. one per
+//! tenant, so that the parameters of each group are validated once rather
+//! than by every `Group::new_with_params`.
+use num_bigint::BigUint;
+use std::collections::HashMap;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Mutex;
+
+use crate::{Error, Group, GroupParameters};
+
+/// Default of `GroupPool::max_groups`.
+pub const DEFAULT_MAX_POOLED_GROUPS: usize = 1024;
+
+/// Custom groups validated so far, keyed by fingerprint. The pool is shared
+/// between threads by reference or behind an `Arc`. The groups it returns
+/// are clones that stay valid after they are removed from the pool or the
+/// pool is dropped, so there is nothing to give back.
+///
+/// The pool keeps at most `max_groups` groups: adding one more forgets the
+/// group that was asked for the longest time ago, which is validated again
+/// if it comes back.
+#[derive(Debug)]
+pub struct GroupPool {
+    // the groups with the tick of their last use
+    groups: Mutex<HashMap<[u8; 32], (Group, u64)>>,
+    ticks: AtomicU64,
+    max_groups: usize,
+}
+
+impl Default for GroupPool {
+    fn default() -> GroupPool {
+        GroupPool::with_max_groups(DEFAULT_MAX_POOLED_GROUPS)
+    }
+}
+
+impl GroupPool {
+    pub fn new() -> GroupPool {
+        Default::default()
+    }
+
+    /// Creates a pool keeping at most `max_groups` groups, at least one.
+    pub fn with_max_groups(max_groups: usize) -> GroupPool {
+        GroupPool {
+            groups: Mutex::new(HashMap::new()),
+            ticks: AtomicU64::new(0),
+            max_groups: max_groups.max(1),
+        }
+    }
+
+    pub fn max_groups(self: &Self) -> usize {
+        self.max_groups
+    }
+
+    /// Returns the group of the parameters, read like `Group::new_with_params`
+    /// and validated only the first time they are seen. Invalid parameters
+    /// return the errors of `new_with_params` and are not cached. Threads
+    /// getting a group validated by another one meanwhile don't wait for it.
+    pub fn get(self: &Self, p: &[u8], q: &[u8], g: &[u8], h: &[u8]) -> Result<Group, Error> {
+        let key = Group::Custom(GroupParameters {
+            p: BigUint::from_bytes_be(p),
+            q: BigUint::from_bytes_be(q),
+            g: BigUint::from_bytes_be(g),
+            h: BigUint::from_bytes_be(h),
+        })
+        .fingerprint();
+        if let Some((group, used)) = self.groups.lock().unwrap().get_mut(&key) {
+            *used = self.ticks.fetch_add(1, Ordering::Relaxed);
+            return Ok(group.clone());
+        }
+
+        // validated without holding the lock, which would block every other
+        // tenant. Two threads may both validate a new group and one of the
+        // results is kept
+        let group = Group::new_with_params(p, q, g, h)?;
+        let groups = &mut *self.groups.lock().unwrap();
+        if groups.len() >= self.max_groups && !groups.contains_key(&key) {
+            let oldest = groups
+                .iter()
+                .min_by_key(|(_, (_, used))| *used)
+                .map(|(key, _)| *key);
+            if let Some(oldest) = oldest {
+                groups.remove(&oldest);
+            }
+        }
+        let used = self.ticks.fetch_add(1, Ordering::Relaxed);
+        Ok(groups.entry(key).or_insert((group, used)).0.clone())
+    }
+
+    /// Removes the group from the pool, e.g. when its tenant leaves, and tells
+    /// if it was there.
+    pub fn remove(self: &Self, group: &Group) -> bool {
+        let groups = &mut *self.groups.lock().unwrap();
+        groups.remove(&group.fingerprint()).is_some()
+    }
+
+    /// Returns the number of groups in the pool.
+    pub fn len(self: &Self) -> usize {
+        self.groups.lock().unwrap().len()
+    }
+
+    pub fn is_empty(self: &Self) -> bool {
+        self.len() == 0
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::GroupId;
+    use std::sync::Arc;
+    use std::thread;
+
+    #[test]
+    fn test_group_pool() {
+        let pool = GroupPool::new();
+        assert!(pool.is_empty());
+        let (p, q, g, h) = Group::Scalar.params();
+
+        let group = pool.get(&p, &q, &g, &h).unwrap();
+        assert_eq!(group.fingerprint(), Group::Scalar.fingerprint());
+        // leading zeros don't make another group
+        let mut padded = vec![0];
+        padded.extend(&p);
+        let again = pool.get(&padded, &q, &g, &h).unwrap();
+        assert_eq!(again.fingerprint(), group.fingerprint());
+        assert_eq!(pool.len(), 1);
+
+        assert!(matches!(
+            pool.get(&p, &q, &g, &g),
+            Err(Error::SameGenerators)
+        ));
+        assert_eq!(pool.len(), 1);
+
+        assert!(pool.remove(&group));
+        assert!(!pool.remove(&group));
+        assert!(pool.is_empty());
+        let (x, _, _) = group.generate_key().unwrap();
+        assert!(group.create_proof(&x).is_ok());
+    }
+
+    #[test]
+    fn test_group_pool_bounded() {
+        let pool = GroupPool::with_max_groups(2);
+        assert_eq!(pool.max_groups(), 2);
+        let params = [
+            Group::Scalar.params(),
+            Group::named(GroupId::Modp2048).params(),
+            Group::new_with_params(&[23], &[11], &[4], &[9])
+                .unwrap()
+                .params(),
+        ];
+        let get = |(p, q, g, h): &(Vec<u8>, Vec<u8>, Vec<u8>, Vec<u8>)| pool.get(p, q, g, h);
+
+        let scalar = get(&params[0]).unwrap();
+        let modp = get(&params[1]).unwrap();
+        // the integer group was used last, so the 2048-bit one is forgotten
+        get(&params[0]).unwrap();
+        get(&params[2]).unwrap();
+        assert_eq!(pool.len(), 2);
+        assert!(!pool.remove(&modp));
+        assert!(pool.remove(&scalar));
+    }
+
+    #[test]
+    fn test_group_pool_threads() {
+        let pool = Arc::new(GroupPool::new());
+        let handles: Vec<_> = [Group::Scalar, Group::named(GroupId::Modp2048)]
+            .into_iter()
+            .cycle()
+            .take(8)
+            .map(|group| {
+                let pool = Arc::clone(&pool);
+                thread::spawn(move || {
+                    let (p, q, g, h) = group.params();
+                    let pooled = pool.get(&p, &q, &g, &h).unwrap();
+                    assert_eq!(pooled.fingerprint(), group.fingerprint());
+                })
+            })
+            .collect();
+        for handle in handles {
+            handle.join().unwrap();
+        }
+        assert_eq!(pool.len(), 2);
+    }
+}
@@ -0,0 +1,169 @@
+//! Primality testing used to validate the parameters of integer cyclic groups,
+//! and generation of safe primes for new ones.
+use num::traits::{One, Zero};
+use num_bigint::BigUint;
+use rand::{CryptoRng, Rng, RngCore};
+use std::sync::atomic::{AtomicBool, Ordering};
+
+use crate::rng::DefaultRng;
+use crate::Error;
+
+/// Small primes used to discard most composite numbers before running the
+/// Miller-Rabin test.
+const SMALL_PRIMES: [u32; 25] = [
+    2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73, 79, 83, 89, 97,
+];
+
+/// Number of Miller-Rabin rounds. The probability of a composite number passing
+/// the test is at most 4^-rounds.
+pub const MILLER_RABIN_ROUNDS: usize = 40;
+
+/// Returns `true` if `n` is prime with overwhelming probability using the
+/// Miller-Rabin test with random bases.
+pub fn is_probable_prime(n: &BigUint) -> bool {
+    let two = BigUint::from(2u32);
+    if *n < two {
+        return false;
+    }
+
+    for prime in SMALL_PRIMES {
+        let prime = BigUint::from(prime);
+        if *n == prime {
+            return true;
+        }
+        if (n % &prime).is_zero() {
+            return false;
+        }
+    }
+
+    // n - 1 = d * 2^r with d odd
+    let n_minus_one = n - BigUint::one();
+    let mut d = n_minus_one.clone();
+    let mut r = 0u32;
+    while (&d % &two).is_zero() {
+        d = d >> 1;
+        r += 1;
+    }
+
+    let len = n.to_bytes_be().len();
+    'witness: for _ in 0..MILLER_RABIN_ROUNDS {
+        // random base in [2, n - 2]
+        let mut bytes = vec![0u8; len + 8];
+        DefaultRng.fill(&mut bytes[..]);
+        let a = BigUint::from_bytes_be(&bytes) % (n - BigUint::from(3u32)) + &two;
+
+        let mut x = a.modpow(&d, n);
+        if x.is_one() || x == n_minus_one {
+            continue;
+        }
+        for _ in 1..r {
+            x = x.modpow(&two, n);
+            if x == n_minus_one {
+                continue 'witness;
+            }
+        }
+        return false;
+    }
+
+    true
+}
+
+/// Returns `true` if `n` is divisible by one of the small primes, `n` itself
+/// excepted.
+fn has_small_factor(n: &BigUint) -> bool {
+    SMALL_PRIMES.iter().any(|&prime| {
+        let prime = BigUint::from(prime);
+        *n != prime && (n % &prime).is_zero()
+    })
+}
+
+/// Generates a random safe prime `p = 2q + 1`, with `q` prime, of exactly
+/// `bits` bits (at least 3). `progress` is called with the number of
+/// candidates tried so far, and setting `cancel` makes the search stop with
+/// `Error::Cancelled`.
+pub fn generate_safe_prime<R: RngCore + CryptoRng, F: FnMut(u64)>(
+    bits: usize,
+    rng: &mut R,
+    mut progress: F,
+    cancel: &AtomicBool,
+) -> Result<BigUint, Error> {
+    if bits < 3 {
+        return Err(Error::InvalidArguments);
+    }
+
+    // q has bits - 1 bits with the top one set, so that 2q + 1 has bits bits
+    let q_bits = bits - 1;
+    let mut bytes = vec![0u8; q_bits.div_ceil(8)];
+    let mut candidates = 0u64;
+    loop {
+        if cancel.load(Ordering::Relaxed) {
+            return Err(Error::Cancelled);
+        }
+
+        rng.try_fill_bytes(&mut bytes)
+            .map_err(|_| Error::RandomnessFailure)?;
+        let excess = bytes.len() * 8 - q_bits;
+        bytes[0] &= 0xff >> excess;
+        bytes[0] |= 0x80 >> excess;
+        let last = bytes.len() - 1;
+        bytes[last] |= 1;
+
+        let q = BigUint::from_bytes_be(&bytes);
+        let p = (&q << 1) + BigUint::one();
+
+        candidates += 1;
+        progress(candidates);
+
+        if has_small_factor(&q) || has_small_factor(&p) {
+            continue;
+        }
+        if is_probable_prime(&q) && is_probable_prime(&p) {
+            return Ok(p);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use rand::thread_rng;
+
+    #[test]
+    fn test_is_probable_prime() {
+        for prime in [2u32, 3, 23, 97, 10009, 65537] {
+            assert!(is_probable_prime(&BigUint::from(prime)));
+        }
+
+        // 561 is a Carmichael number
+        for composite in [0u32, 1, 4, 561, 5004, 10011] {
+            assert!(!is_probable_prime(&BigUint::from(composite)));
+        }
+
+        // the prime of the secp256k1 curve
+        let p = BigUint::parse_bytes(
+            b"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+            16,
+        )
+        .unwrap();
+        assert!(is_probable_prime(&p));
+        assert!(!is_probable_prime(&(p + BigUint::from(2u32))));
+    }
+
+    #[test]
+    fn test_generate_safe_prime() {
+        let cancel = AtomicBool::new(false);
+        let mut candidates = 0;
+        let p = generate_safe_prime(64, &mut thread_rng(), |n| candidates = n, &cancel).unwrap();
+
+        assert_eq!(p.bits(), 64);
+        assert!(is_probable_prime(&p));
+        assert!(is_probable_prime(&(&p >> 1)));
+        assert!(candidates > 0);
+
+        cancel.store(true, Ordering::Relaxed);
+        assert_eq!(
+            generate_safe_prime(64, &mut thread_rng(), |_| {}, &cancel),
+            Err(Error::Cancelled)
+        );
+    }
+}
@@ -0,0 +1,130 @@
+//! Conversions from and to the Protocol Buffers messages of
+//! `proto/cpzkp.proto`, for systems exchanging the proofs as typed messages
+//! rather than as the opaque bytes of `Proof::serialize`. The messages are
+//! generated by the build script in the module `pb`.
+use num_bigint::BigUint;
+
+use crate::{Commitment, Error, Point, Proof};
+
+/// Messages generated from `proto/cpzkp.proto`.
+pub mod pb {
+    include!("cpzkp.rs");
+}
+
+use pb::point::Value;
+
+impl Point {
+    /// Returns the point as a message, with the numbers in big-endian.
+    pub fn to_proto(self: &Self) -> pb::Point {
+        let value = match self {
+            Point::Scalar(n) => Value::Scalar(n.to_bytes_be()),
+            Point::ECPoint(x, y) => Value::EcPoint(pb::EcPoint {
+                x: x.to_bytes_be(),
+                y: y.to_bytes_be(),
+            }),
+        };
+        pb::Point { value: Some(value) }
+    }
+
+    /// Reads the point of a message, `Error::InvalidSerialization` if it has
+    /// no value. Like the other conversions it doesn't check that the point
+    /// belongs to a group, `Group::verify_proof` does.
+    pub fn from_proto(m: &pb::Point) -> Result<Point, Error> {
+        match &m.value {
+            Some(Value::Scalar(n)) => Ok(Point::Scalar(BigUint::from_bytes_be(n))),
+            Some(Value::EcPoint(p)) => Ok(Point::ECPoint(
+                BigUint::from_bytes_be(&p.x),
+                BigUint::from_bytes_be(&p.y),
+            )),
+            None => Err(Error::InvalidSerialization),
+        }
+    }
+}
+
+impl Commitment {
+    pub fn to_proto(self: &Self) -> pb::Commitment {
+        pb::Commitment {
+            r1: Some(self.r1.to_proto()),
+            r2: Some(self.r2.to_proto()),
+        }
+    }
+
+    /// Reads the commitment of a message, `Error::InvalidSerialization` if a
+    /// point is missing.
+    pub fn from_proto(m: &pb::Commitment) -> Result<Commitment, Error> {
+        Ok(Commitment {
+            r1: Point::from_proto(m.r1.as_ref().ok_or(Error::InvalidSerialization)?)?,
+            r2: Point::from_proto(m.r2.as_ref().ok_or(Error::InvalidSerialization)?)?,
+        })
+    }
+}
+
+impl Proof {
+    pub fn to_proto(self: &Self) -> pb::Proof {
+        let commitment = Commitment {
+            r1: self.r1.clone(),
+            r2: self.r2.clone(),
+        };
+        pb::Proof {
+            commitment: Some(commitment.to_proto()),
+            c: self.c.to_bytes_be(),
+            s: self.s.to_bytes_be(),
+        }
+    }
+
+    /// Reads the proof of a message, `Error::InvalidSerialization` if the
+    /// commitment or one of its points is missing.
+    pub fn from_proto(m: &pb::Proof) -> Result<Proof, Error> {
+        let commitment = m.commitment.as_ref().ok_or(Error::InvalidSerialization)?;
+        let Commitment { r1, r2 } = Commitment::from_proto(commitment)?;
+        Ok(Proof {
+            r1,
+            r2,
+            c: BigUint::from_bytes_be(&m.c),
+            s: BigUint::from_bytes_be(&m.s),
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::Group;
+
+    #[test]
+    fn test_proof_proto() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+
+            let m = proof.to_proto();
+            assert_eq!(m.c, proof.c.to_bytes_be());
+            let read = Proof::from_proto(&m).unwrap();
+            assert_eq!(read, proof);
+            assert!(group.verify_proof(&y1, &y2, &read).unwrap());
+            assert_eq!(Point::from_proto(&y1.to_proto()), Ok(y1));
+        }
+    }
+
+    #[test]
+    fn test_proof_proto_missing_fields() {
+        let group = Group::EllipticCurve;
+        let (x, _, _) = group.generate_key().unwrap();
+        let m = group.create_proof(&x).unwrap().to_proto();
+
+        let mut no_commitment = m.clone();
+        no_commitment.commitment = None;
+        assert_eq!(
+            Proof::from_proto(&no_commitment),
+            Err(Error::InvalidSerialization)
+        );
+        let mut no_point = m;
+        no_point.commitment.as_mut().unwrap().r2 = None;
+        assert_eq!(
+            Proof::from_proto(&no_point),
+            Err(Error::InvalidSerialization)
+        );
+        let empty = pb::Point { value: None };
+        assert_eq!(Point::from_proto(&empty), Err(Error::InvalidSerialization));
+    }
+}
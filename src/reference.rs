@@ -0,0 +1,121 @@
+//! Slow reference implementation of the verification of the non-interactive
+//! proofs in the integer groups, written independently of the rest of the
+//! library: the challenge is hashed from the big-endian bytes of the values
+//! and the exponentiations are done bit by bit. It is only meant to cross-check
+//! `verify_proof` in tests or staging, not to be fast.
+use num::traits::One;
+use num_bigint::BigUint;
+use sha2::{Digest, Sha256};
+
+use crate::{get_constants, Error, Group, Point, Proof};
+
+/// Computes `base^exp mod p` by left-to-right square and multiply.
+fn slow_modpow(base: &BigUint, exp: &BigUint, p: &BigUint) -> BigUint {
+    let mut result = BigUint::one() % p;
+    for i in (0..exp.bits()).rev() {
+        result = (&result * &result) % p;
+        if exp.bit(i) {
+            result = (result * base) % p;
+        }
+    }
+    result
+}
+
+/// Verifies `proof` for the integer values `g, h, y1, y2` of the group of
+/// modulus `p` and order `q`.
+fn reference_verify(values: [&BigUint; 4], p: &BigUint, q: &BigUint, proof: [&BigUint; 4]) -> bool {
+    let [g, h, y1, y2] = values;
+    let [r1, r2, c, s] = proof;
+
+    // challenge: SHA-256 of the 4-byte length and the bytes of each value
+    let mut hasher = Sha256::new();
+    for value in [g, h, y1, y2, r1, r2] {
+        let bytes = value.to_bytes_be();
+        hasher.update((bytes.len() as u32).to_be_bytes());
+        hasher.update(&bytes);
+    }
+    let challenge = BigUint::from_bytes_be(&hasher.finalize()) % q;
+
+    let rhs1 = (slow_modpow(g, s, p) * slow_modpow(y1, c, p)) % p;
+    let rhs2 = (slow_modpow(h, s, p) * slow_modpow(y2, c, p)) % p;
+
+    challenge == *c && *r1 == rhs1 && *r2 == rhs2
+}
+
+impl Group {
+    /// Same as `verify_proof` but also verifies the proof with the reference
+    /// implementation of this module and returns `Error::CrossCheckFailed` if
+    /// both disagree. It is several times slower, for test and staging
+    /// environments only. Only the integer groups are covered, secp256k1
+    /// returns `Error::Unsupported`.
+    pub fn verify_proof_cross_checked(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        proof: &Proof,
+    ) -> Result<bool, Error> {
+        let (p, q, g, h) = get_constants(self);
+        let values = match (&g, &h, y1, y2, &proof.r1, &proof.r2) {
+            (
+                Point::Scalar(g),
+                Point::Scalar(h),
+                Point::Scalar(y1),
+                Point::Scalar(y2),
+                Point::Scalar(r1),
+                Point::Scalar(r2),
+            ) => ([g, h, y1, y2], [r1, r2, &proof.c, &proof.s]),
+            (Point::ECPoint(..), ..) => return Err(Error::Unsupported),
+            _ => return Err(Error::InvalidArguments),
+        };
+
+        let valid = self.verify_proof(y1, y2, proof)?;
+        if valid != reference_verify(values.0, &p, &q, values.1) {
+            log::error!("cross-check of {} in group {} failed", proof, self);
+            return Err(Error::CrossCheckFailed);
+        }
+        Ok(valid)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::GroupId;
+
+    #[test]
+    fn test_slow_modpow() {
+        let p = BigUint::from(10009u32);
+        for (base, exp) in [(3u32, 0u32), (3, 1), (2892, 5004), (10008, 12345)] {
+            let (base, exp) = (BigUint::from(base), BigUint::from(exp));
+            assert_eq!(slow_modpow(&base, &exp, &p), base.modpow(&exp, &p));
+        }
+    }
+
+    #[test]
+    fn test_verify_proof_cross_checked() {
+        for group in [Group::Scalar, Group::named(GroupId::Modp2048)] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+            assert_eq!(group.verify_proof_cross_checked(&y1, &y2, &proof), Ok(true));
+
+            let mut wrong = proof.clone();
+            wrong.s += 1u32;
+            assert_eq!(
+                group.verify_proof_cross_checked(&y1, &y2, &wrong),
+                group.verify_proof(&y1, &y2, &wrong)
+            );
+        }
+
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        assert_eq!(
+            group.verify_proof_cross_checked(&y1, &y2, &proof),
+            Err(Error::Unsupported)
+        );
+        assert_eq!(
+            Group::Scalar.verify_proof_cross_checked(&y1, &y2, &proof),
+            Err(Error::InvalidArguments)
+        );
+    }
+}
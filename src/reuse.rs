@@ -0,0 +1,136 @@
+//! Detection of proofs created with the same random number `k`, the mark of a
+//! broken prover. Two responses to different challenges for the same
+//! commitment reveal the secret:
+//!
+//! s_a - s_b = (c_b - c_a) * x mod q
+//!
+//! so such proofs are found and the key revoked before anyone else does it.
+//! Recovering the secret itself is only built with the `audit` feature.
+#[cfg(any(test, feature = "audit"))]
+use num::{
+    traits::{One, Zero},
+    BigInt, Integer,
+};
+#[cfg(any(test, feature = "audit"))]
+use num_bigint::BigUint;
+
+use crate::{get_constants, verify, Error, Group, Point, Proof};
+
+/// Returns the inverse of `a` modulo `q`, if there is one.
+#[cfg(any(test, feature = "audit"))]
+fn mod_inverse(a: &BigUint, q: &BigUint) -> Option<BigUint> {
+    // extended Euclidean algorithm, keeping only the coefficients of `a`
+    let (mut r0, mut r1) = (BigInt::from(q.clone()), BigInt::from(a.clone()));
+    let (mut t0, mut t1) = (BigInt::zero(), BigInt::one());
+    while !r1.is_zero() {
+        let quotient = r0.div_floor(&r1);
+        let r2 = &r0 - &quotient * &r1;
+        let t2 = &t0 - &quotient * &t1;
+        (r0, r1) = (r1, r2);
+        (t0, t1) = (t1, t2);
+    }
+    if !r0.is_one() {
+        return None;
+    }
+    t0.mod_floor(&BigInt::from(q.clone())).to_biguint()
+}
+
+impl Group {
+    /// Tells if the proofs `a` and `b` of the public values `(y1, y2)` were
+    /// created with the same random number, i.e. they share the commitment
+    /// but answer different challenges. The same proof twice is not a reuse.
+    /// Returns `Error::InvalidProof` if one of them is not a valid response
+    /// for the public values.
+    pub fn detect_nonce_reuse(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        a: &Proof,
+        b: &Proof,
+    ) -> Result<bool, Error> {
+        let (p, q, g, h) = get_constants(self);
+        for proof in [a, b] {
+            if !verify(&proof.r1, &proof.r2, y1, y2, &g, &h, &proof.c, &proof.s, &p)? {
+                return Err(Error::InvalidProof);
+            }
+        }
+
+        let same_commitment = a.r1 == b.r1 && a.r2 == b.r2;
+        Ok(same_commitment && &a.c % &q != &b.c % &q)
+    }
+
+    /// Recovers the private key `x` of `(y1, y2)` from two proofs for which
+    /// `detect_nonce_reuse` is true. The key lets anyone impersonate the owner
+    /// of the proofs, so this is only built with the `audit` feature, to show
+    /// what the reuse exposes. Returns `Error::InvalidArguments` if the random
+    /// number was not reused or the secret can't be told among several
+    /// candidates, which only happens in groups whose order is not prime.
+    #[cfg(any(test, feature = "audit"))]
+    pub fn recover_secret_from_reuse(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        a: &Proof,
+        b: &Proof,
+    ) -> Result<BigUint, Error> {
+        if !self.detect_nonce_reuse(y1, y2, a, b)? {
+            return Err(Error::InvalidArguments);
+        }
+
+        let (_, q, _, _) = get_constants(self);
+        let ds = (&a.s % &q + &q - &b.s % &q) % &q;
+        let dc = (&b.c % &q + &q - &a.c % &q) % &q;
+        let x = match mod_inverse(&dc, &q) {
+            Some(inverse) => (ds * inverse) % &q,
+            None => return Err(Error::InvalidArguments),
+        };
+
+        if self.public_key(&x) != Ok((y1.clone(), y2.clone())) {
+            return Err(Error::InvalidArguments);
+        }
+        Ok(x)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_detect_nonce_reuse() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let (k, commitment) = group.commit().unwrap();
+        let a = group.respond(&commitment, &k, &group.challenge(), &x);
+        let b = group.respond(&commitment, &k, &group.challenge(), &x);
+
+        assert_eq!(group.detect_nonce_reuse(&y1, &y2, &a, &b), Ok(true));
+        assert_eq!(
+            group.recover_secret_from_reuse(&y1, &y2, &a, &b),
+            Ok(x.clone())
+        );
+
+        assert_eq!(group.detect_nonce_reuse(&y1, &y2, &a, &a), Ok(false));
+        let fresh = group.create_proof(&x).unwrap();
+        assert_eq!(group.detect_nonce_reuse(&y1, &y2, &a, &fresh), Ok(false));
+        assert_eq!(
+            group.recover_secret_from_reuse(&y1, &y2, &a, &fresh),
+            Err(Error::InvalidArguments)
+        );
+
+        let (_, other1, other2) = group.generate_key().unwrap();
+        assert_eq!(
+            group.detect_nonce_reuse(&other1, &other2, &a, &b),
+            Err(Error::InvalidProof)
+        );
+    }
+
+    #[test]
+    fn test_mod_inverse() {
+        let q = BigUint::from(5004u32);
+        let inverse = mod_inverse(&BigUint::from(5u32), &q).unwrap();
+        assert_eq!((inverse * 5u32) % &q, BigUint::one());
+        assert_eq!(mod_inverse(&BigUint::from(6u32), &q), None);
+        assert_eq!(mod_inverse(&BigUint::zero(), &q), None);
+    }
+}
@@ -0,0 +1,192 @@
+//! Safe prime MODP groups from RFC 3526 (https://www.rfc-editor.org/rfc/rfc3526).
+use num::traits::{One, Zero};
+use num_bigint::BigUint;
+use sha2::{Digest, Sha256};
+use std::str::FromStr;
+
+use crate::{Error, GroupParameters};
+
+/// Identifiers of the well-known MODP groups of RFC 3526. All of them are
+/// defined by a safe prime `p = 2q + 1` and use `g = 2` as generator.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum GroupId {
+    /// 2048-bit MODP group, estimated security strength of 112 bits.
+    Modp2048,
+    /// 3072-bit MODP group, estimated security strength of 128 bits.
+    Modp3072,
+    /// 4096-bit MODP group, estimated security strength of 152 bits.
+    Modp4096,
+}
+
+impl FromStr for GroupId {
+    type Err = Error;
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.trim().to_lowercase().as_str() {
+            "modp2048" => Ok(GroupId::Modp2048),
+            "modp3072" => Ok(GroupId::Modp3072),
+            "modp4096" => Ok(GroupId::Modp4096),
+            _ => Err(Error::UnknownGroup),
+        }
+    }
+}
+
+impl GroupId {
+    fn prime_hex(self: &Self) -> &'static str {
+        match self {
+            GroupId::Modp2048 => MODP_2048,
+            GroupId::Modp3072 => MODP_3072,
+            GroupId::Modp4096 => MODP_4096,
+        }
+    }
+
+    fn name(self: &Self) -> &'static str {
+        match self {
+            GroupId::Modp2048 => "modp2048",
+            GroupId::Modp3072 => "modp3072",
+            GroupId::Modp4096 => "modp4096",
+        }
+    }
+
+    /// Returns the parameters of the group. RFC 3526 only defines `g`, so `h`
+    /// is derived by hashing the name of the group and squaring the result,
+    /// which lands in the subgroup of order `q` and makes its discrete
+    /// logarithm unknown to everybody.
+    pub fn params(self: &Self) -> GroupParameters {
+        let p = BigUint::parse_bytes(self.prime_hex().as_bytes(), 16).unwrap();
+        let q = (&p - BigUint::one()) >> 1;
+        let g = BigUint::from(2u32);
+        let h = hash_to_subgroup(self.name().as_bytes(), &p);
+
+        GroupParameters { p, q, g, h }
+    }
+}
+
+/// Tells if `p` is the prime of one of the groups of RFC 3526.
+pub(crate) fn is_named_prime(p: &BigUint) -> bool {
+    [GroupId::Modp2048, GroupId::Modp3072, GroupId::Modp4096]
+        .iter()
+        .any(|id| BigUint::parse_bytes(id.prime_hex().as_bytes(), 16).as_ref() == Some(p))
+}
+
+/// Maps a label to an element of the subgroup of quadratic residues modulo the
+/// safe prime `p`.
+pub(crate) fn hash_to_subgroup(label: &[u8], p: &BigUint) -> BigUint {
+    let len = p.to_bytes_be().len() + 16;
+
+    let mut counter = 0u32;
+    loop {
+        let mut v = Vec::new();
+        let mut block = 0u32;
+        while v.len() < len {
+            let digest = Sha256::new()
+                .chain_update(b"chaum-pedersen-zkp generator")
+                .chain_update(counter.to_be_bytes())
+                .chain_update(block.to_be_bytes())
+                .chain_update(label)
+                .finalize();
+            v.extend_from_slice(&digest);
+            block += 1;
+        }
+
+        let x = BigUint::from_bytes_be(&v[..len]) % p;
+        let h = x.modpow(&BigUint::from(2u32), p);
+        if !h.is_zero() && !h.is_one() {
+            return h;
+        }
+        counter += 1;
+    }
+}
+
+const MODP_2048: &str = concat!(
+    "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74",
+    "020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437",
+    "4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED",
+    "EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05",
+    "98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB",
+    "9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B",
+    "E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718",
+    "3995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF",
+);
+
+const MODP_3072: &str = concat!(
+    "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74",
+    "020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437",
+    "4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED",
+    "EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05",
+    "98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB",
+    "9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B",
+    "E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718",
+    "3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33",
+    "A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7",
+    "ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864",
+    "D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2",
+    "08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF",
+);
+
+const MODP_4096: &str = concat!(
+    "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74",
+    "020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437",
+    "4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED",
+    "EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05",
+    "98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB",
+    "9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B",
+    "E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718",
+    "3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33",
+    "A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7",
+    "ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864",
+    "D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2",
+    "08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A92108011A723C12A787E6D7",
+    "88719A10BDBA5B2699C327186AF4E23C1A946834B6150BDA2583E9CA2AD44CE8",
+    "DBBBC2DB04DE8EF92E8EFC141FBECAA6287C59474E6BC05D99B2964FA090C3A2",
+    "233BA186515BE7ED1F612970CEE2D7AFB81BDD762170481CD0069127D5B05AA9",
+    "93B4EA988D8FDDC186FFB7DC90A6C08F4DF435C934063199FFFFFFFFFFFFFFFF",
+);
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{get_constants, Group};
+
+    #[test]
+    fn test_named_groups() {
+        for (name, bits) in [("modp2048", 2048), ("MODP3072", 3072), ("modp4096", 4096)] {
+            let id: GroupId = name.parse().unwrap();
+            let params = id.params();
+
+            assert_eq!(params.p.bits(), bits);
+            assert_eq!(&params.q * 2u32 + 1u32, params.p);
+            assert!(params.g.modpow(&params.q, &params.p).is_one());
+            assert!(params.h.modpow(&params.q, &params.p).is_one());
+        }
+
+        assert_eq!("modp1024".parse::<GroupId>(), Err(Error::UnknownGroup));
+    }
+
+    #[test]
+    fn test_named_group_proof() {
+        let group = Group::named(GroupId::Modp2048);
+        assert_eq!(
+            get_constants(&group),
+            get_constants(&Group::named(GroupId::Modp2048))
+        );
+
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+    }
+
+    #[test]
+    fn test_named_group_proof_hides_secret() {
+        // with k and x much smaller than q, s = q - (c * x - k) isn't reduced
+        // and x is (q - s) / c rounded up
+        let group = Group::named(GroupId::Modp2048);
+        let (_, q, _, _) = get_constants(&group);
+        for _ in 0..8 {
+            let (x, _, _) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+            let guess = (&q - &proof.s) / &proof.c;
+            assert!(guess != x && guess + 1u32 != x);
+        }
+    }
+}
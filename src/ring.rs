@@ -0,0 +1,274 @@
+//! Ring proofs: the prover shows they know the secret of one of several public
+//! keys without revealing which one. A real proof for their key is combined
+//! with simulated proofs for the other members of the ring (OR-composition of
+//! Cramer, Damgård and Schoenmakers):
+//!
+//! c = c_1 + ... + c_n mod q
+//!
+//! where `c` is the Fiat-Shamir challenge of all the commitments. A simulated
+//! proof needs its challenge `c_j` before its commitment, so the prover can
+//! only leave the challenge of the key they know free.
+use num_bigint::BigUint;
+
+use crate::{
+    check_serialized_size, fiat_shamir_challenge, get_constants, read_length_prefixed,
+    solve_zk_challenge_s, write_length_prefixed, ChallengeHash, Error, Group, Point, Scalar,
+};
+
+/// Structure holding the challenges `c` and the solutions `s` of the proofs of
+/// every member of the ring, in the order of the ring. The commitments are not
+/// stored as the verifier recomputes them.
+#[derive(Debug, Clone, PartialEq)]
+pub struct RingProof {
+    pub c: Vec<BigUint>,
+    pub s: Vec<BigUint>,
+}
+
+impl RingProof {
+    /// Serializes the RingProof structure to an array of bytes: the size of
+    /// the ring as 4 big-endian bytes followed by the challenge and the
+    /// solution of every member, each one preceded by its 4-byte big-endian
+    /// length.
+    pub fn serialize(self: &Self) -> Vec<u8> {
+        let mut v = Vec::new();
+        v.extend_from_slice(&(self.c.len() as u32).to_be_bytes());
+        for (c, s) in self.c.iter().zip(&self.s) {
+            write_length_prefixed(&mut v, &c.to_bytes_be());
+            write_length_prefixed(&mut v, &s.to_bytes_be());
+        }
+        v
+    }
+
+    /// Deserializes the RingProof structure from an array of bytes. Empty,
+    /// truncated inputs, trailing bytes or an empty ring return an error.
+    pub fn deserialize(v: Vec<u8>) -> Result<RingProof, Error> {
+        check_serialized_size(v.len())?;
+        if v.len() < 4 {
+            return Err(Error::InvalidSerialization);
+        }
+        let (count, mut data) = v.split_at(4);
+        let count = u32::from_be_bytes([count[0], count[1], count[2], count[3]]) as usize;
+        if count == 0 {
+            return Err(Error::InvalidSerialization);
+        }
+
+        // the count is not trusted to reserve memory, every member takes at
+        // least 8 bytes
+        let mut c = Vec::with_capacity(count.min(data.len() / 8));
+        let mut s = Vec::with_capacity(count.min(data.len() / 8));
+        for _ in 0..count {
+            let c_j = read_length_prefixed(&mut data)?;
+            let s_j = read_length_prefixed(&mut data)?;
+            if c_j.is_empty() || s_j.is_empty() {
+                return Err(Error::InvalidSerialization);
+            }
+            c.push(BigUint::from_bytes_be(c_j));
+            s.push(BigUint::from_bytes_be(s_j));
+        }
+
+        if !data.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+        Ok(RingProof { c, s })
+    }
+}
+
+impl Group {
+    /// Creates a RingProof of the knowledge of the secret `x` of one of the
+    /// public keys `(y1, y2)` of `ring`. Verifying it only tells that the
+    /// prover knows the secret of a member, not of which one. The key of `x`
+    /// must appear exactly once in the ring, otherwise
+    /// `Error::InvalidArguments` is returned. Secrets that `public_key`
+    /// rejects, such as 0 and 1, return `Error::InvalidSecret`.
+    pub fn create_ring_proof(
+        self: &Self,
+        x: &BigUint,
+        ring: &[(Point, Point)],
+    ) -> Result<RingProof, Error> {
+        let (y1, y2) = self.public_key(x)?;
+        let members: Vec<usize> = (0..ring.len())
+            .filter(|&j| ring[j].0 == y1 && ring[j].1 == y2)
+            .collect();
+        let [i] = members[..] else {
+            return Err(Error::InvalidArguments);
+        };
+
+        let (_, q, g, h) = get_constants(self);
+        let k = self.random_scalar();
+
+        let mut c = Vec::with_capacity(ring.len());
+        let mut s = Vec::with_capacity(ring.len());
+        let mut commitments = Vec::with_capacity(ring.len());
+        for (j, (y1, y2)) in ring.iter().enumerate() {
+            if j == i {
+                // filled once the challenges of the others are known
+                c.push(BigUint::default());
+                s.push(BigUint::default());
+                commitments.push((self.scalar_mult(&g, &k)?, self.scalar_mult(&h, &k)?));
+                continue;
+            }
+
+            let (c_j, s_j) = (self.random_scalar(), self.random_scalar());
+            commitments.push((
+                self.simulated_commitment(&g, y1, &c_j, &s_j)?,
+                self.simulated_commitment(&h, y2, &c_j, &s_j)?,
+            ));
+            c.push(c_j.value().clone());
+            s.push(s_j.value().clone());
+        }
+
+        let challenge = self.composite_challenge(b"ring", ring, &commitments, &q);
+        let others = c.iter().sum::<BigUint>() % &q;
+        c[i] = (challenge + &q - others) % &q;
+        s[i] = solve_zk_challenge_s(x, k.value(), &c[i], &q);
+
+        Ok(RingProof { c, s })
+    }
+
+    /// Verifies a RingProof created with `create_ring_proof` for the same
+    /// ring, in the same order. Rings of another size than the proof return
+    /// `Error::LengthMismatch`.
+    pub fn verify_ring_proof(
+        self: &Self,
+        ring: &[(Point, Point)],
+        proof: &RingProof,
+    ) -> Result<bool, Error> {
+        if ring.is_empty() {
+            return Err(Error::InvalidArguments);
+        }
+        if proof.c.len() != ring.len() || proof.s.len() != ring.len() {
+            return Err(Error::LengthMismatch);
+        }
+
+        let (_, q, g, h) = get_constants(self);
+        // challenges out of range would give other encodings of the same proof
+        if proof.c.iter().any(|c| *c >= q) {
+            return Ok(false);
+        }
+
+        let mut commitments = Vec::with_capacity(ring.len());
+        for ((y1, y2), (c, s)) in ring.iter().zip(proof.c.iter().zip(&proof.s)) {
+            let (c, s) = (Scalar::new(c, self), Scalar::new(s, self));
+            commitments.push((
+                self.simulated_commitment(&g, y1, &c, &s)?,
+                self.simulated_commitment(&h, y2, &c, &s)?,
+            ));
+        }
+
+        let challenge = self.composite_challenge(b"ring", ring, &commitments, &q);
+        Ok(proof.c.iter().sum::<BigUint>() % &q == challenge)
+    }
+
+    /// Computes the commitment `base^s * y^c` that a proof with the challenge
+    /// `c` and the solution `s` answers.
+    pub(crate) fn simulated_commitment(
+        self: &Self,
+        base: &Point,
+        y: &Point,
+        c: &Scalar,
+        s: &Scalar,
+    ) -> Result<Point, Error> {
+        self.point_add(&self.scalar_mult(base, s)?, &self.scalar_mult(y, c)?)
+    }
+
+    /// Computes the Fiat-Shamir challenge of the keys of a composite statement
+    /// and of the commitments of their proofs. The `label` of the kind of
+    /// statement keeps the challenges from colliding with the ones of the
+    /// other proofs.
+    pub(crate) fn composite_challenge(
+        self: &Self,
+        label: &[u8],
+        keys: &[(Point, Point)],
+        commitments: &[(Point, Point)],
+        q: &BigUint,
+    ) -> BigUint {
+        let (_, _, g, h) = get_constants(self);
+        let mut points = vec![&g, &h];
+        for ((y1, y2), (r1, r2)) in keys.iter().zip(commitments) {
+            points.extend([y1, y2, r1, r2]);
+        }
+
+        let mut context = Vec::new();
+        write_length_prefixed(&mut context, label);
+        fiat_shamir_challenge(&points, q, ChallengeHash::default(), &context)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn new_ring(group: &Group, n: usize) -> (Vec<BigUint>, Vec<(Point, Point)>) {
+        let keys = group.generate_keys(n).unwrap();
+        let secrets = keys.iter().map(|(x, _, _)| x.clone()).collect();
+        let ring = keys.into_iter().map(|(_, y1, y2)| (y1, y2)).collect();
+        (secrets, ring)
+    }
+
+    #[test]
+    fn test_ring_proof() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (secrets, ring) = new_ring(&group, 4);
+            for x in &secrets {
+                let proof = group.create_ring_proof(x, &ring).unwrap();
+                assert!(group.verify_ring_proof(&ring, &proof).unwrap());
+
+                let v = proof.serialize();
+                assert_eq!(RingProof::deserialize(v), Ok(proof));
+            }
+
+            // a ring of a single key is a plain proof
+            let proof = group.create_ring_proof(&secrets[0], &ring[..1]).unwrap();
+            assert!(group.verify_ring_proof(&ring[..1], &proof).unwrap());
+            assert_eq!(
+                group.verify_ring_proof(&ring, &proof),
+                Err(Error::LengthMismatch)
+            );
+        }
+    }
+
+    #[test]
+    fn test_ring_proof_invalid() {
+        let group = Group::EllipticCurve;
+        let (secrets, ring) = new_ring(&group, 3);
+        let (outsider, others) = new_ring(&group, 1);
+
+        assert_eq!(
+            group.create_ring_proof(&outsider[0], &ring),
+            Err(Error::InvalidArguments)
+        );
+        let duplicated = [ring.clone(), ring[..1].to_vec()].concat();
+        assert_eq!(
+            group.create_ring_proof(&secrets[0], &duplicated),
+            Err(Error::InvalidArguments)
+        );
+        assert_eq!(
+            group.create_ring_proof(&secrets[0], &[]),
+            Err(Error::InvalidArguments)
+        );
+        let (_, _, g, h) = get_constants(&group);
+        assert_eq!(
+            group.create_ring_proof(&BigUint::from(1u32), &[ring.clone(), vec![(g, h)]].concat()),
+            Err(Error::InvalidSecret)
+        );
+
+        let proof = group.create_ring_proof(&secrets[0], &ring).unwrap();
+        let mut wrong = ring.clone();
+        wrong[2] = others[0].clone();
+        assert!(!group.verify_ring_proof(&wrong, &proof).unwrap());
+
+        let mut large = proof.clone();
+        large.c[1] += get_constants(&group).1;
+        assert!(!group.verify_ring_proof(&ring, &large).unwrap());
+
+        let mut tampered = proof.clone();
+        tampered.s[0] += 1u32;
+        assert!(!group.verify_ring_proof(&ring, &tampered).unwrap());
+
+        assert!(RingProof::deserialize(vec![0, 0, 0, 0]).is_err());
+        let v = proof.serialize();
+        for len in 0..v.len() {
+            assert!(RingProof::deserialize(v[..len].to_vec()).is_err());
+        }
+    }
+}
@@ -0,0 +1,121 @@
+//! Random number generator used by default by all the randomized operations
+//! of the library: secrets of `generate_key`, random numbers of the proofs,
+//! `random_scalar`, challenges and random strings. It is the thread-local
+//! generator of `rand` unless the application sets another one once at
+//! startup with `set_default_rng`, e.g. a hardware generator or a DRBG of its
+//! own. The methods taking an `rng` argument keep using that one.
+use rand::{thread_rng, CryptoRng, RngCore};
+use std::sync::Mutex;
+
+static DEFAULT_RNG: Mutex<Option<Box<dyn RngCore + Send>>> = Mutex::new(None);
+
+/// Makes `rng` the generator of all the following randomized operations of
+/// every group, replacing the previous one. It can be set before or after the
+/// groups are created. As it is shared by all the threads, its calls are
+/// serialized.
+pub fn set_default_rng<R: RngCore + CryptoRng + Send + 'static>(rng: R) {
+    *DEFAULT_RNG.lock().unwrap() = Some(Box::new(rng));
+}
+
+/// Goes back to the thread-local generator of `rand`.
+pub fn reset_default_rng() {
+    *DEFAULT_RNG.lock().unwrap() = None;
+}
+
+/// Handle on the default generator, to pass where an `rng` is expected.
+#[derive(Debug, Clone, Copy, Default)]
+pub(crate) struct DefaultRng;
+
+impl DefaultRng {
+    fn with<T>(f: impl FnOnce(&mut dyn RngCore) -> T) -> T {
+        let mut rng = DEFAULT_RNG.lock().unwrap();
+        if let Some(rng) = rng.as_mut() {
+            return f(rng.as_mut());
+        }
+        // the thread-local generator doesn't need the lock
+        drop(rng);
+        f(&mut thread_rng())
+    }
+}
+
+impl RngCore for DefaultRng {
+    fn next_u32(&mut self) -> u32 {
+        DefaultRng::with(|rng| rng.next_u32())
+    }
+
+    fn next_u64(&mut self) -> u64 {
+        DefaultRng::with(|rng| rng.next_u64())
+    }
+
+    fn fill_bytes(&mut self, dest: &mut [u8]) {
+        DefaultRng::with(|rng| rng.fill_bytes(dest))
+    }
+
+    fn try_fill_bytes(&mut self, dest: &mut [u8]) -> Result<(), rand::Error> {
+        DefaultRng::with(|rng| rng.try_fill_bytes(dest))
+    }
+}
+
+/// Only cryptographically secure generators can be set as default.
+impl CryptoRng for DefaultRng {}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::Group;
+    use rand::rngs::StdRng;
+    use rand::SeedableRng;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+    use std::sync::Arc;
+
+    /// Generator counting the bytes it provides.
+    struct CountingRng(StdRng, Arc<AtomicUsize>);
+
+    impl RngCore for CountingRng {
+        fn next_u32(&mut self) -> u32 {
+            self.1.fetch_add(4, Ordering::Relaxed);
+            self.0.next_u32()
+        }
+
+        fn next_u64(&mut self) -> u64 {
+            self.1.fetch_add(8, Ordering::Relaxed);
+            self.0.next_u64()
+        }
+
+        fn fill_bytes(&mut self, dest: &mut [u8]) {
+            self.1.fetch_add(dest.len(), Ordering::Relaxed);
+            self.0.fill_bytes(dest)
+        }
+
+        fn try_fill_bytes(&mut self, dest: &mut [u8]) -> Result<(), rand::Error> {
+            self.1.fetch_add(dest.len(), Ordering::Relaxed);
+            self.0.try_fill_bytes(dest)
+        }
+    }
+
+    impl CryptoRng for CountingRng {}
+
+    #[test]
+    fn test_default_rng() {
+        // the generator is shared with the other tests running concurrently,
+        // so only increases of the count can be checked
+        let count = Arc::new(AtomicUsize::new(0));
+        set_default_rng(CountingRng(StdRng::from_seed([3; 32]), count.clone()));
+
+        let group = Group::EllipticCurve;
+        let before = count.load(Ordering::Relaxed);
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let after_key = count.load(Ordering::Relaxed);
+        let proof = group.create_proof(&x).unwrap();
+        let after_proof = count.load(Ordering::Relaxed);
+        group.random_scalar();
+        let after_scalar = count.load(Ordering::Relaxed);
+        reset_default_rng();
+
+        assert!(before < after_key && after_key < after_proof && after_proof < after_scalar);
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+
+        group.create_proof(&x).unwrap();
+        assert_eq!(count.load(Ordering::Relaxed), after_scalar);
+    }
+}
@@ -0,0 +1,130 @@
+//! Numbers modulo the order `q` of a group, like the secrets `x`, the
+//! challenges `c` and the solutions `s` of the protocol.
+use num_bigint::BigUint;
+use rand::{CryptoRng, RngCore};
+use zeroize::Zeroizing;
+
+use crate::rng::DefaultRng;
+use crate::{check_serialized_size, get_constants, zeroize, Error, Group};
+
+/// A number in the range `[0, q)` of the group it was created for. Its number
+/// is kept in a buffer of its exact size, see `zeroize`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Scalar(BigUint);
+
+impl Scalar {
+    /// Creates the Scalar `n mod q` of `group`.
+    pub fn new(n: &BigUint, group: &Group) -> Scalar {
+        let (_, q, _, _) = get_constants(group);
+        Scalar::from_value(n % q)
+    }
+
+    /// Wraps `n` without reducing it, for the formats that don't carry the
+    /// group like JSON. The digits are moved to a new buffer without spare
+    /// capacity, the one of `n` is overwritten.
+    pub(crate) fn from_value(mut n: BigUint) -> Scalar {
+        let digits = Zeroizing::new(n.to_u32_digits());
+        zeroize(&mut n);
+        Scalar(BigUint::from_slice(&digits))
+    }
+
+    pub fn value(self: &Self) -> &BigUint {
+        &self.0
+    }
+
+    pub fn into_value(mut self: Self) -> BigUint {
+        std::mem::take(&mut self.0)
+    }
+
+    /// Serializes the Scalar as its big-endian bytes.
+    pub fn serialize(self: &Self) -> Vec<u8> {
+        self.0.to_bytes_be()
+    }
+
+    /// Deserializes a Scalar of `group`. Empty inputs and numbers out of the
+    /// range `[0, q)` return an error.
+    pub fn deserialize(v: Vec<u8>, group: &Group) -> Result<Scalar, Error> {
+        check_serialized_size(v.len())?;
+        if v.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+
+        let (_, q, _, _) = get_constants(group);
+        let n = BigUint::from_bytes_be(&v);
+        if n >= q {
+            return Err(Error::InvalidSerialization);
+        }
+        Ok(Scalar::from_value(n))
+    }
+}
+
+impl From<Scalar> for BigUint {
+    fn from(scalar: Scalar) -> BigUint {
+        scalar.into_value()
+    }
+}
+
+/// Scalars are usually secrets, so their memory is overwritten with zeros
+/// before being released.
+impl Drop for Scalar {
+    fn drop(&mut self) {
+        zeroize(&mut self.0);
+    }
+}
+
+impl Group {
+    /// Returns a uniformly distributed random Scalar of the group. 16 extra
+    /// random bytes are drawn so the bias of the modular reduction is
+    /// negligible.
+    pub fn random_scalar(self: &Self) -> Scalar {
+        self.random_scalar_with_rng(&mut DefaultRng)
+            .expect("Fail to generate array of random number.")
+    }
+
+    /// Same as `random_scalar` but draws the bytes from `rng`. It is the
+    /// sampler of the secrets, random numbers `k` and challenges of every
+    /// group, whatever the size of `q`.
+    pub(crate) fn random_scalar_with_rng<R: RngCore + CryptoRng>(
+        self: &Self,
+        rng: &mut R,
+    ) -> Result<Scalar, Error> {
+        let (_, q, _, _) = get_constants(self);
+
+        let mut v = Zeroizing::new(vec![0u8; q.to_bytes_be().len() + 16]);
+        rng.try_fill_bytes(&mut v[..])
+            .map_err(|_| Error::RandomnessFailure)?;
+
+        Ok(Scalar::from_value(BigUint::from_bytes_be(&v) % q))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_scalar() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (_, q, _, _) = get_constants(&group);
+
+            let a = group.random_scalar();
+            assert!(*a.value() < q);
+
+            let b = Scalar::deserialize(a.serialize(), &group).unwrap();
+            assert_eq!(a, b);
+
+            assert_eq!(
+                Scalar::new(&(&q + 5u32), &group).into_value(),
+                BigUint::from(5u32)
+            );
+            assert_eq!(
+                Scalar::deserialize(q.to_bytes_be(), &group),
+                Err(Error::InvalidSerialization)
+            );
+            assert_eq!(
+                Scalar::deserialize(vec![], &group),
+                Err(Error::InvalidSerialization)
+            );
+        }
+    }
+}
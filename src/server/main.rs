@@ -1,12 +1,9 @@
 use num_bigint::BigUint;
-use std::collections::HashMap;
 use std::env;
-use std::sync::Mutex;
 use tonic::{transport::Server, Code, Request, Response, Status};
 
 use chaum_pedersen_zkp::{
-    get_constants, get_random_number, get_random_string, parse_group_from_command_line, verify,
-    Group, Point,
+    get_random_string, parse_group_from_command_line, Authenticator, Commitment, Error, Point,
 };
 
 pub mod zkp_auth {
@@ -19,29 +16,9 @@ use zkp_auth::{
     AuthenticationChallengeResponse, RegisterRequest, RegisterResponse,
 };
 
-#[derive(Default)]
+#[derive(Debug, Default)]
 pub struct AuthImpl {
-    user_registry: Mutex<HashMap<String, UserInfo>>,
-    auth_registry: Mutex<HashMap<String, AuthInfo>>,
-    group: Group,
-}
-
-#[derive(Debug, Clone)]
-pub struct UserInfo {
-    pub user: String,
-    pub y1: Point,
-    pub y2: Point,
-}
-
-#[derive(Debug, Clone)]
-pub struct AuthInfo {
-    pub auth_id: String,
-    pub y1: Point,
-    pub y2: Point,
-    pub r1: Point,
-    pub r2: Point,
-    pub c: BigUint,
-    pub session_id: String,
+    authenticator: Authenticator,
 }
 
 #[tonic::async_trait]
@@ -53,18 +30,19 @@ impl Auth for AuthImpl {
         let register_request = request.into_inner();
         let response = RegisterResponse {};
 
-        let user_name = register_request.user.clone();
+        let user_name = register_request.user;
         println!("[SERVER] Registering user: {}", user_name);
 
-        // we add a new UserInfo, replace old y1 & y2 if the user was already register.
-        let user_info = UserInfo {
-            user: user_name,
-            y1: Point::deserialize(register_request.y1, &self.group),
-            y2: Point::deserialize(register_request.y2, &self.group),
-        };
+        let group = self.authenticator.group();
+        let y1 = Point::deserialize(register_request.y1, group)
+            .map_err(|_| Status::new(Code::InvalidArgument, "(Server) Invalid y1"))?;
+        let y2 = Point::deserialize(register_request.y2, group)
+            .map_err(|_| Status::new(Code::InvalidArgument, "(Server) Invalid y2"))?;
 
-        let user_registry = &mut *self.user_registry.lock().unwrap();
-        user_registry.insert(register_request.user, user_info);
+        // replaces old y1 & y2 if the user was already registered.
+        self.authenticator
+            .register(&user_name, y1, y2)
+            .map_err(|_| Status::new(Code::InvalidArgument, "(Server) Invalid y1 or y2"))?;
 
         Ok(Response::new(response))
     }
@@ -77,39 +55,36 @@ impl Auth for AuthImpl {
 
         let user = register_request.user;
 
-        let r1 = Point::deserialize(register_request.r1, &self.group);
-        let r2 = Point::deserialize(register_request.r2, &self.group);
-
-        let user_registry = &mut *self.user_registry.lock().unwrap();
-        let auth_registry = &mut *self.auth_registry.lock().unwrap();
-
-        let auth_id = get_random_string(10);
-
-        if let Some(user_info) = user_registry.get(&user) {
-            let c = get_random_number();
-
-            auth_registry.insert(
-                auth_id.clone(),
-                AuthInfo {
-                    auth_id: auth_id.clone(),
-                    y1: user_info.y1.clone(),
-                    y2: user_info.y2.clone(),
-                    r1,
-                    r2,
-                    c: c.clone(),
-                    session_id: String::new(),
-                },
-            );
-
-            let response = AuthenticationChallengeResponse {
-                auth_id,
-                c: c.to_bytes_be(),
-            };
-
-            Ok(Response::new(response))
-        } else {
-            println!("[SERVER] User {} not found\n", user);
-            return Err(Status::new(Code::NotFound, "(Server) User not found"));
+        let group = self.authenticator.group();
+        let r1 = Point::deserialize(register_request.r1, group)
+            .map_err(|_| Status::new(Code::InvalidArgument, "(Server) Invalid r1"))?;
+        let r2 = Point::deserialize(register_request.r2, group)
+            .map_err(|_| Status::new(Code::InvalidArgument, "(Server) Invalid r2"))?;
+
+        match self
+            .authenticator
+            .create_auth_challenge(&user, Commitment { r1, r2 })
+        {
+            Ok((auth_id, c)) => {
+                let response = AuthenticationChallengeResponse {
+                    auth_id,
+                    c: c.to_bytes_be(),
+                };
+
+                Ok(Response::new(response))
+            }
+            Err(Error::UnknownUser) => {
+                println!("[SERVER] User {} not found\n", user);
+                Err(Status::new(Code::NotFound, "(Server) User not found"))
+            }
+            Err(Error::TooManyChallenges) => Err(Status::new(
+                Code::ResourceExhausted,
+                "(Server) Too many pending challenges",
+            )),
+            Err(_) => Err(Status::new(
+                Code::InvalidArgument,
+                "(Server) Invalid r1 or r2",
+            )),
         }
     }
 
@@ -123,52 +98,42 @@ impl Auth for AuthImpl {
         let s = register_request.s;
         let s = BigUint::from_bytes_be(&s);
 
-        let auth_registry = &mut *self.auth_registry.lock().unwrap();
-
-        let (p, _, g, h) = get_constants(&self.group);
-
-        if let Some(info) = auth_registry.get_mut(&auth_id) {
-            match verify(
-                &info.r1, &info.r2, &info.y1, &info.y2, &g, &h, &info.c, &s, &p,
-            ) {
-                Ok(verification) => {
-                    if verification {
-                        let session_id = get_random_string(10);
-                        info.session_id = session_id.clone();
-
-                        let response = AuthenticationAnswerResponse {
-                            session_id: session_id.clone(),
-                        };
-
-                        println!("[SERVER] Successful login auth_id: {}\n", auth_id);
-                        Ok(Response::new(response))
-                    } else {
-                        println!(
-                            "[SERVER] Error: challenge not solved properly auth_id: {}\n",
-                            auth_id
-                        );
-
-                        return Err(Status::new(
-                            Code::NotFound,
-                            "(Server): challenge not solved properly",
-                        ));
-                    }
-                }
-                Err(error) => {
-                    println!(
-                        "[SERVER] algorithm error during verification: {:?}\n",
-                        error
-                    );
-
-                    return Err(Status::new(
-                        Code::NotFound,
-                        "(Server): algorithm error during verification",
-                    ));
-                }
+        match self.authenticator.verify_auth_response(&auth_id, &s) {
+            Ok(Some(_)) => {
+                let session_id = get_random_string(10);
+
+                let response = AuthenticationAnswerResponse { session_id };
+
+                println!("[SERVER] Successful login auth_id: {}\n", auth_id);
+                Ok(Response::new(response))
+            }
+            Ok(None) => {
+                println!(
+                    "[SERVER] Error: challenge not solved properly auth_id: {}\n",
+                    auth_id
+                );
+
+                Err(Status::new(
+                    Code::NotFound,
+                    "(Server): challenge not solved properly",
+                ))
+            }
+            Err(Error::UnknownChallenge) => {
+                println!("[SERVER] auth_id {} not found", auth_id);
+                Err(Status::new(Code::NotFound, "auth_id doesn't exist"))
+            }
+            Err(Error::Expired) => {
+                println!("[SERVER] auth_id {} expired", auth_id);
+                Err(Status::new(Code::DeadlineExceeded, "auth_id expired"))
+            }
+            Err(error) => {
+                println!("[SERVER] algorithm error during verification: {}\n", error);
+
+                Err(Status::new(
+                    Code::NotFound,
+                    "(Server): algorithm error during verification",
+                ))
             }
-        } else {
-            println!("[SERVER] auth_id {} not found", auth_id);
-            return Err(Status::new(Code::NotFound, "auth_id doesn't exist"));
         }
     }
 }
@@ -176,14 +141,16 @@ impl Auth for AuthImpl {
 #[tokio::main]
 async fn main() -> Result<(), Box<dyn std::error::Error>> {
     let addr = "127.0.0.1:50051".parse().unwrap();
-    let mut auth = AuthImpl::default();
 
     let args: Vec<String> = env::args().collect();
-    auth.group = parse_group_from_command_line(args);
+    let auth = AuthImpl {
+        authenticator: Authenticator::new(parse_group_from_command_line(args)),
+    };
 
     println!(
-        "Bookstore server listening on {} ZKP: {:?}",
-        addr, auth.group
+        "Bookstore server listening on {} ZKP: {}",
+        addr,
+        auth.authenticator.group()
     );
 
     Server::builder()
@@ -0,0 +1,240 @@
+//! Proofs created a bounded amount of work at a time, so that a cooperative
+//! scheduler, e.g. the main loop of an embedded device, can interleave the
+//! exponentiations of large groups with its other tasks instead of blocking
+//! in `create_proof`.
+use num::traits::Zero;
+use num_bigint::BigUint;
+use std::fmt;
+use std::mem;
+use std::time::{Duration, Instant};
+
+use crate::secp256k1::Secp256k1Point;
+use crate::{
+    fiat_shamir_challenge, get_constants, metrics, solve_zk_challenge_s, zeroize, ChallengeHash,
+    Error, Group, Point, PrivateKey, Proof, Scalar,
+};
+
+/// Number of bits of the exponents processed by each `ProofSession::step`.
+pub const SESSION_STEP_BITS: u64 = 16;
+
+/// Power of a base computed by square-and-multiply, from the least
+/// significant bit of the exponent.
+enum Power {
+    Integer {
+        base: BigUint,
+        acc: BigUint,
+    },
+    Curve {
+        base: Secp256k1Point,
+        acc: Secp256k1Point,
+    },
+}
+
+impl Power {
+    fn new(base: &Point) -> Power {
+        match base {
+            Point::Scalar(n) => Power::Integer {
+                base: n.clone(),
+                acc: 1u32.into(),
+            },
+            Point::ECPoint(x, y) => Power::Curve {
+                base: Secp256k1Point::from_bigint(x, y),
+                acc: Secp256k1Point::Zero,
+            },
+        }
+    }
+
+    fn step(self: &mut Self, bit: bool, p: &BigUint) {
+        match self {
+            Power::Integer { base, acc } => {
+                if bit {
+                    *acc = &*acc * &*base % p;
+                }
+                *base = &*base * &*base % p;
+            }
+            Power::Curve { base, acc } => {
+                if bit {
+                    *acc = base.clone() + mem::replace(acc, Secp256k1Point::Zero);
+                }
+                *base = base.clone() + base.clone();
+            }
+        }
+    }
+
+    /// Returns the power, `Error::InvalidSecret` for the point at infinity.
+    fn point(self: &Self) -> Result<Point, Error> {
+        match self {
+            Power::Integer { acc, .. } => Ok(Point::Scalar(acc.clone())),
+            Power::Curve {
+                acc: Secp256k1Point::Zero,
+                ..
+            } => Err(Error::InvalidSecret),
+            Power::Curve { acc, .. } => Ok(Point::from_secp256k1(acc)),
+        }
+    }
+}
+
+impl Drop for Power {
+    /// The intermediate powers reveal the low bits of the exponent.
+    fn drop(&mut self) {
+        match self {
+            Power::Integer { base, acc } => {
+                zeroize(base);
+                zeroize(acc);
+            }
+            Power::Curve { base, acc } => {
+                for point in [base, acc] {
+                    if let Secp256k1Point::Coor { x, y, .. } = point {
+                        zeroize(&mut x.number);
+                        zeroize(&mut y.number);
+                    }
+                }
+            }
+        }
+    }
+}
+
+/// Proof of knowledge of a secret created step by step, see
+/// `Group::start_proof`. The secret, the random number `k` and the
+/// intermediate powers are overwritten with zeros when the session is
+/// dropped, whether it finished or not.
+pub struct ProofSession {
+    group: Group,
+    x: Scalar,
+    k: Scalar,
+    /// `g^x`, `h^x`, `g^k` and `h^k`.
+    powers: [Power; 4],
+    bit: u64,
+    bits: u64,
+    elapsed: Duration,
+    proof: Option<Proof>,
+}
+
+impl Group {
+    /// Starts a proof of knowledge of the secret of `key`, the same as the
+    /// one of `create_proof_with_key`. No exponentiation is done yet, call
+    /// `ProofSession::step` until it returns `true` and then
+    /// `ProofSession::proof`.
+    pub fn start_proof(self: &Self, key: &PrivateKey) -> Result<ProofSession, Error> {
+        let (_, _, g, h) = get_constants(self);
+        // a zero k can't be committed to on the curve
+        let k = loop {
+            let k = self.random_scalar();
+            if !k.value().is_zero() {
+                break k;
+            }
+        };
+        let x = key.secret().clone();
+        let bits = x.value().bits().max(k.value().bits());
+
+        Ok(ProofSession {
+            group: self.clone(),
+            x,
+            k,
+            powers: [
+                Power::new(&g),
+                Power::new(&h),
+                Power::new(&g),
+                Power::new(&h),
+            ],
+            bit: 0,
+            bits,
+            elapsed: Duration::ZERO,
+            proof: None,
+        })
+    }
+}
+
+impl ProofSession {
+    /// Processes the next `SESSION_STEP_BITS` bits of the exponents, or
+    /// creates the proof once they are all processed. Returns `true` when the
+    /// proof is ready, further calls do nothing.
+    pub fn step(self: &mut Self) -> Result<bool, Error> {
+        if self.proof.is_some() {
+            return Ok(true);
+        }
+        let start = Instant::now();
+        let (p, q, g, h) = get_constants(&self.group);
+
+        if self.bit < self.bits {
+            let end = self.bits.min(self.bit + SESSION_STEP_BITS);
+            for i in self.bit..end {
+                let (x, k) = (self.x.value().bit(i), self.k.value().bit(i));
+                for (power, bit) in self.powers.iter_mut().zip([x, x, k, k]) {
+                    power.step(bit, &p);
+                }
+            }
+            self.bit = end;
+            self.elapsed += start.elapsed();
+            return Ok(false);
+        }
+
+        let [y1, y2, r1, r2] = [0, 1, 2, 3].map(|i| self.powers[i].point());
+        let (y1, y2, r1, r2) = (y1?, y2?, r1?, r2?);
+        let points = [&g, &h, &y1, &y2, &r1, &r2];
+        let c = fiat_shamir_challenge(&points, &q, ChallengeHash::default(), &[]);
+        let s = solve_zk_challenge_s(self.x.value(), self.k.value(), &c, &q);
+        let proof = Proof { r1, r2, c, s };
+
+        metrics().record_creation(self.elapsed + start.elapsed());
+        log::debug!("created {} in group {} for y1 {}", proof, self.group, y1);
+        self.proof = Some(proof);
+        Ok(true)
+    }
+
+    /// Returns the proof, or `Error::ProofNotReady` until `step` returned
+    /// `true`.
+    pub fn proof(self: &Self) -> Result<Proof, Error> {
+        self.proof.clone().ok_or(Error::ProofNotReady)
+    }
+}
+
+impl fmt::Debug for ProofSession {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_struct("ProofSession")
+            .field("group", &self.group)
+            .field("done", &self.proof.is_some())
+            .finish_non_exhaustive()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::GroupId;
+
+    #[test]
+    fn test_proof_session() {
+        for group in [
+            Group::Scalar,
+            Group::named(GroupId::Modp2048),
+            Group::EllipticCurve,
+        ] {
+            let key_pair = group.generate_key_pair().unwrap();
+            let mut session = group.start_proof(&key_pair.private_key()).unwrap();
+            assert_eq!(session.proof(), Err(Error::ProofNotReady));
+
+            let mut steps = 1;
+            while !session.step().unwrap() {
+                steps += 1;
+            }
+            let (_, q, _, _) = get_constants(&group);
+            assert!(steps > 1 && steps <= q.bits().div_ceil(SESSION_STEP_BITS) + 1);
+            assert!(session.step().unwrap());
+
+            let proof = session.proof().unwrap();
+            let (y1, y2) = key_pair.public_key();
+            assert!(group.verify_proof(y1, y2, &proof).unwrap());
+        }
+    }
+
+    #[test]
+    fn test_proof_session_abandoned() {
+        let group = Group::EllipticCurve;
+        let key = group.generate_private_key().unwrap();
+        let mut session = group.start_proof(&key).unwrap();
+        assert!(!session.step().unwrap());
+        let debug = format!("{:?}", session);
+        assert!(debug.starts_with("ProofSession {") && !debug.contains("x:"));
+    }
+}
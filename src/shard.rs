@@ -0,0 +1,189 @@
+//! Verification of a batch of proofs split between machines: every shard
+//! checks its own part of the batch with `Group::partial_verify` and sends
+//! the serialized PartialResult to a coordinator, which decides for the whole
+//! batch with `combine_partials`. The shards are trusted, the coordinator
+//! only checks that together they cover the batch.
+use crate::{Error, Group, Point, Proof};
+
+/// Length of a serialized PartialResult.
+const PARTIAL_RESULT_LENGTH: usize = 13;
+
+/// Decision of one shard on its part of a batch.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct PartialResult {
+    pub shard: u32,
+    pub total_shards: u32,
+    /// Number of proofs of the whole batch, not only of the shard.
+    pub batch_len: u32,
+    pub valid: bool,
+}
+
+impl PartialResult {
+    /// Serializes the PartialResult structure to an array of bytes: `shard`,
+    /// `total_shards` and `batch_len` as 4-byte big-endian numbers followed by
+    /// 1 or 0 for `valid`.
+    pub fn serialize(self: &Self) -> Vec<u8> {
+        let mut v = Vec::with_capacity(PARTIAL_RESULT_LENGTH);
+        for n in [self.shard, self.total_shards, self.batch_len] {
+            v.extend_from_slice(&n.to_be_bytes());
+        }
+        v.push(self.valid as u8);
+        v
+    }
+
+    /// Deserializes the PartialResult structure from an array of bytes.
+    /// Inputs of another length, or with a byte other than 0 or 1 for `valid`,
+    /// return an error.
+    pub fn deserialize(v: Vec<u8>) -> Result<PartialResult, Error> {
+        if v.len() != PARTIAL_RESULT_LENGTH || v[12] > 1 {
+            return Err(Error::InvalidSerialization);
+        }
+        let number = |i: usize| u32::from_be_bytes(v[i..i + 4].try_into().unwrap());
+        Ok(PartialResult {
+            shard: number(0),
+            total_shards: number(4),
+            batch_len: number(8),
+            valid: v[12] == 1,
+        })
+    }
+}
+
+impl Group {
+    /// Verifies the part of the batch of shard `shard` out of `total_shards`
+    /// with `verify_proof_batch_fast`. The batch is split into contiguous
+    /// parts of the same size but the last, like in
+    /// `verify_proof_batch_parallel`, so every shard must be given the whole
+    /// batch in the same order. Shards past the end of a small batch have
+    /// nothing to verify and are valid. Returns `Error::InvalidArguments` if
+    /// `shard` is not below `total_shards`.
+    pub fn partial_verify(
+        self: &Self,
+        public_keys: &[(Point, Point)],
+        proofs: &[Proof],
+        shard: u32,
+        total_shards: u32,
+    ) -> Result<PartialResult, Error> {
+        if public_keys.len() != proofs.len() {
+            return Err(Error::LengthMismatch);
+        }
+        if shard >= total_shards {
+            return Err(Error::InvalidArguments);
+        }
+        let batch_len = u32::try_from(proofs.len()).map_err(|_| Error::SizeLimitExceeded)?;
+
+        let chunk = proofs.len().div_ceil(total_shards as usize);
+        let start = (shard as usize * chunk).min(proofs.len());
+        let end = (start + chunk).min(proofs.len());
+        let valid = self.verify_proof_batch_fast(&public_keys[start..end], &proofs[start..end])?;
+
+        Ok(PartialResult {
+            shard,
+            total_shards,
+            batch_len,
+            valid,
+        })
+    }
+}
+
+/// Decides for the whole batch from the results of its shards: `true` only
+/// if every shard found its part valid. Returns `Error::IncompleteShards`
+/// unless there is exactly one result per shard, all of the same batch.
+pub fn combine_partials(parts: &[PartialResult]) -> Result<bool, Error> {
+    let first = parts.first().ok_or(Error::IncompleteShards)?;
+    if parts.len() != first.total_shards as usize {
+        return Err(Error::IncompleteShards);
+    }
+
+    let mut seen = vec![false; parts.len()];
+    for part in parts {
+        let same_batch =
+            part.total_shards == first.total_shards && part.batch_len == first.batch_len;
+        if !same_batch || part.shard >= part.total_shards || seen[part.shard as usize] {
+            return Err(Error::IncompleteShards);
+        }
+        seen[part.shard as usize] = true;
+    }
+    Ok(parts.iter().all(|part| part.valid))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn batch(group: &Group, n: usize) -> (Vec<(Point, Point)>, Vec<Proof>) {
+        (0..n)
+            .map(|_| {
+                let (x, y1, y2) = group.generate_key().unwrap();
+                ((y1, y2), group.create_proof(&x).unwrap())
+            })
+            .unzip()
+    }
+
+    #[test]
+    fn test_partial_verify() {
+        let group = Group::EllipticCurve;
+        let (public_keys, mut proofs) = batch(&group, 5);
+
+        let verify_shards = |proofs: &[Proof], total_shards| -> Vec<PartialResult> {
+            (0..total_shards)
+                .map(|shard| {
+                    let part = group
+                        .partial_verify(&public_keys, proofs, shard, total_shards)
+                        .unwrap();
+                    PartialResult::deserialize(part.serialize()).unwrap()
+                })
+                .collect()
+        };
+        for total_shards in [1, 2, 3, 8] {
+            let parts = verify_shards(&proofs, total_shards);
+            assert_eq!(combine_partials(&parts), Ok(true));
+        }
+
+        proofs[4].s += 1u32;
+        let parts = verify_shards(&proofs, 2);
+        assert_eq!(
+            parts.iter().map(|part| part.valid).collect::<Vec<_>>(),
+            [true, false]
+        );
+        assert_eq!(combine_partials(&parts), Ok(false));
+
+        assert_eq!(
+            group.partial_verify(&public_keys, &proofs, 2, 2),
+            Err(Error::InvalidArguments)
+        );
+    }
+
+    #[test]
+    fn test_combine_incomplete_partials() {
+        let part = PartialResult {
+            shard: 0,
+            total_shards: 2,
+            batch_len: 4,
+            valid: true,
+        };
+        let other = PartialResult { shard: 1, ..part };
+        assert_eq!(combine_partials(&[part, other]), Ok(true));
+
+        assert_eq!(combine_partials(&[]), Err(Error::IncompleteShards));
+        assert_eq!(combine_partials(&[part]), Err(Error::IncompleteShards));
+        assert_eq!(
+            combine_partials(&[part, part]),
+            Err(Error::IncompleteShards)
+        );
+        let other_batch = PartialResult {
+            batch_len: 5,
+            ..other
+        };
+        assert_eq!(
+            combine_partials(&[part, other_batch]),
+            Err(Error::IncompleteShards)
+        );
+
+        let mut v = part.serialize();
+        v[12] = 2;
+        assert_eq!(
+            PartialResult::deserialize(v),
+            Err(Error::InvalidSerialization)
+        );
+    }
+}
@@ -0,0 +1,194 @@
+//! Proofs created without the secret in the memory of the process, e.g. when
+//! it lives in a hardware security module. A `Signer` holds the secret `x`
+//! and the random numbers `k` and performs the only steps that need them; the
+//! library computes the Fiat-Shamir challenge and assembles the proof.
+//! `LocalSigner` keeps the secret in memory and is the reference for other
+//! implementations.
+//!
+//! No signer for PKCS#11 tokens is included: the standard has no mechanism
+//! computing `s = k - c * x mod q`, so such a signer depends on the vendor
+//! extensions of the token and belongs in the application.
+use num::traits::Zero;
+use num_bigint::BigUint;
+use std::collections::HashMap;
+use std::fmt;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+
+use crate::{
+    exponentiates_points, get_constants, metrics, solve_zk_challenge_s, Commitment, Error, Group,
+    PrivateKey, Proof, PublicKey, Scalar,
+};
+
+/// Holder of a secret `x` of a group that answers challenges without
+/// revealing it. Knowing `k` and the answer for it gives away `x`, so `k`
+/// must stay in the signer as well and be used for a single answer.
+pub trait Signer: Send + Sync {
+    /// Returns the public values `(g^x, h^x)` of the secret.
+    fn public_key(self: &Self) -> Result<PublicKey, Error>;
+
+    /// Draws a fresh random `k`, keeps it and returns an identifier of it
+    /// with the commitment `(g^k, h^k)`.
+    fn commit(self: &Self) -> Result<(u64, Commitment), Error>;
+
+    /// Returns the solution `s = k - c * x mod q` of the challenge `c` for
+    /// the `k` of `nonce`, and forgets `k`. Unknown or already used nonces
+    /// return `Error::UnknownChallenge`.
+    fn respond(self: &Self, nonce: u64, c: &BigUint) -> Result<BigUint, Error>;
+}
+
+/// Maximum number of nonces a `LocalSigner` keeps for answers to come.
+const MAX_PENDING_NONCES: usize = 1024;
+
+/// Time after which a `LocalSigner` forgets a nonce that wasn't answered.
+const NONCE_LIFETIME: Duration = Duration::from_secs(60);
+
+/// Signer keeping its secret in memory, overwritten with zeros when dropped
+/// like the numbers `k` not used yet. It keeps at most `MAX_PENDING_NONCES`
+/// nonces, each for `NONCE_LIFETIME`: `commit` returns
+/// `Error::TooManyChallenges` when that many are waiting for an answer.
+pub struct LocalSigner {
+    group: Group,
+    key: PrivateKey,
+    nonces: Mutex<HashMap<u64, (Scalar, Instant)>>,
+    next_nonce: AtomicU64,
+}
+
+impl LocalSigner {
+    pub fn new(group: &Group, key: PrivateKey) -> LocalSigner {
+        LocalSigner {
+            group: group.clone(),
+            key,
+            nonces: Mutex::new(HashMap::new()),
+            next_nonce: AtomicU64::new(0),
+        }
+    }
+}
+
+impl Signer for LocalSigner {
+    fn public_key(self: &Self) -> Result<PublicKey, Error> {
+        self.key.public_key(&self.group)
+    }
+
+    fn commit(self: &Self) -> Result<(u64, Commitment), Error> {
+        let (p, _, g, h) = get_constants(&self.group);
+        // a zero k can't be committed to on the curve
+        let k = loop {
+            let k = self.group.random_scalar();
+            if !k.value().is_zero() {
+                break k;
+            }
+        };
+        let (r1, r2) = exponentiates_points(k.value(), &g, &h, &p)?;
+
+        let now = Instant::now();
+        let mut nonces = self.nonces.lock().unwrap();
+        if nonces.len() >= MAX_PENDING_NONCES {
+            nonces.retain(|_, (_, created_at)| now - *created_at < NONCE_LIFETIME);
+            if nonces.len() >= MAX_PENDING_NONCES {
+                return Err(Error::TooManyChallenges);
+            }
+        }
+        let nonce = self.next_nonce.fetch_add(1, Ordering::Relaxed);
+        nonces.insert(nonce, (k, now));
+        Ok((nonce, Commitment { r1, r2 }))
+    }
+
+    fn respond(self: &Self, nonce: u64, c: &BigUint) -> Result<BigUint, Error> {
+        let k = match self.nonces.lock().unwrap().remove(&nonce) {
+            Some((k, created_at)) if created_at.elapsed() < NONCE_LIFETIME => k,
+            _ => return Err(Error::UnknownChallenge),
+        };
+        let (_, q, _, _) = get_constants(&self.group);
+        Ok(solve_zk_challenge_s(
+            self.key.secret().value(),
+            k.value(),
+            c,
+            &q,
+        ))
+    }
+}
+
+impl fmt::Debug for LocalSigner {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_struct("LocalSigner")
+            .field("group", &self.group)
+            .finish_non_exhaustive()
+    }
+}
+
+impl Group {
+    /// Same as `create_proof_with_key` with the secret held by `signer`. The
+    /// commitment it returns must be made of elements of the group,
+    /// `Error::InvalidPoint` otherwise.
+    pub fn create_proof_with_signer(self: &Self, signer: &dyn Signer) -> Result<Proof, Error> {
+        let start = Instant::now();
+        let PublicKey { y1, y2 } = signer.public_key()?;
+        let (nonce, commitment) = signer.commit()?;
+        if !self.contains(&commitment.r1) || !self.contains(&commitment.r2) {
+            return Err(Error::InvalidPoint);
+        }
+
+        let c = self
+            .transcript_challenge(&y1, &y2, &commitment)
+            .into_value();
+        let s = signer.respond(nonce, &c)?;
+        let proof = Proof {
+            r1: commitment.r1,
+            r2: commitment.r2,
+            c,
+            s,
+        };
+        metrics().record_creation(start.elapsed());
+        log::debug!("created {} in group {} for y1 {}", proof, self, y1);
+        Ok(proof)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_create_proof_with_signer() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let key = group.generate_private_key().unwrap();
+            let public_key = key.public_key(&group).unwrap();
+            let signer = LocalSigner::new(&group, key);
+            assert_eq!(signer.public_key(), Ok(public_key.clone()));
+
+            let proof = group.create_proof_with_signer(&signer).unwrap();
+            assert!(group.verify_proof_with_key(&public_key, &proof).unwrap());
+            assert!(!format!("{:?}", signer).contains("key"));
+        }
+    }
+
+    #[test]
+    fn test_signer_nonces_used_once() {
+        let group = Group::EllipticCurve;
+        let signer = LocalSigner::new(&group, group.generate_private_key().unwrap());
+        let (nonce, _) = signer.commit().unwrap();
+        let (other, _) = signer.commit().unwrap();
+        assert_ne!(nonce, other);
+
+        let c = BigUint::from(7u32);
+        assert!(signer.respond(nonce, &c).is_ok());
+        assert_eq!(signer.respond(nonce, &c), Err(Error::UnknownChallenge));
+        assert!(signer.respond(other, &c).is_ok());
+    }
+
+    #[test]
+    fn test_signer_nonces_bounded() {
+        let group = Group::Scalar;
+        let signer = LocalSigner::new(&group, group.generate_private_key().unwrap());
+        let nonces: Vec<u64> = (0..MAX_PENDING_NONCES)
+            .map(|_| signer.commit().unwrap().0)
+            .collect();
+        assert_eq!(signer.commit().unwrap_err(), Error::TooManyChallenges);
+
+        // an answer frees its nonce
+        signer.respond(nonces[0], &BigUint::from(7u32)).unwrap();
+        assert!(signer.commit().is_ok());
+    }
+}
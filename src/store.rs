@@ -0,0 +1,358 @@
+//! Storage of the registered users and of the outstanding challenges of an
+//! Authenticator. The `Store` trait lets a deployment of several instances
+//! keep them in a shared database; `MemoryStore` keeps them in the memory of
+//! the process and is the default.
+use num_bigint::BigUint;
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+use std::sync::Mutex;
+use std::time::SystemTime;
+
+use crate::{AuthLimits, Commitment, Error, Point};
+
+/// Challenge sent to `user` for their `commitment`, waiting for its answer.
+#[derive(Debug, Clone, PartialEq)]
+pub struct PendingChallenge {
+    pub user: String,
+    pub commitment: Commitment,
+    pub c: BigUint,
+    /// Time after which the challenge can't be answered anymore.
+    pub expires_at: SystemTime,
+}
+
+impl PendingChallenge {
+    /// Returns the SHA-256 digest of the commitment, which is all a Store
+    /// needs to remember to detect that the user sends it again.
+    pub fn commitment_fingerprint(self: &Self) -> [u8; 32] {
+        Sha256::digest(self.commitment.serialize()).into()
+    }
+}
+
+/// Backend of an Authenticator. It is shared by all the threads serving the
+/// requests, and possibly by several processes, so each method must be
+/// atomic. Failures of the backend are returned as `Error::StoreFailure`.
+pub trait Store: Send + Sync {
+    /// Saves the public values of `user`, replacing the previous ones.
+    fn save_user(self: &Self, user: &str, y1: &Point, y2: &Point) -> Result<(), Error>;
+
+    /// Returns the public values of `user`, if registered.
+    fn load_user(self: &Self, user: &str) -> Result<Option<(Point, Point)>, Error>;
+
+    /// Saves `challenge` under `auth_id` and remembers the fingerprint of its
+    /// commitment for the commitment window of `limits`. Nothing is saved if
+    /// its user or all the users together already have as many challenges
+    /// not expired as `limits` allow, or if as many commitments are
+    /// remembered, in which case `Error::TooManyChallenges` is returned, nor
+    /// if the user already sent the commitment within the window, in which
+    /// case `Error::CommitmentReuse` is returned. The limits are checked
+    /// first, and checking and saving must be a single atomic operation.
+    fn save_challenge(
+        self: &Self,
+        auth_id: &str,
+        challenge: &PendingChallenge,
+        limits: &AuthLimits,
+    ) -> Result<(), Error>;
+
+    /// Removes the challenge `auth_id` and returns it, if any. Only one of
+    /// concurrent calls for the same challenge may get it, so that it can't
+    /// be answered twice.
+    fn consume_challenge(self: &Self, auth_id: &str) -> Result<Option<PendingChallenge>, Error>;
+
+    /// Returns the number of challenges, expired ones included.
+    fn pending_challenges(self: &Self) -> Result<usize, Error>;
+
+    /// Removes the challenges expired at `now` and returns how many there
+    /// were. The commitments to forget at `now` are removed as well.
+    fn remove_expired_challenges(self: &Self, now: SystemTime) -> Result<usize, Error>;
+}
+
+/// Store keeping the users and challenges in memory. They are lost when the
+/// process stops and are not shared with other instances.
+#[derive(Debug, Default)]
+pub struct MemoryStore {
+    users: Mutex<HashMap<String, (Point, Point)>>,
+    challenges: Mutex<Challenges>,
+}
+
+/// Outstanding challenges and remembered commitments of a MemoryStore, under
+/// the same lock so that a challenge and its commitment are saved together.
+#[derive(Debug, Default)]
+struct Challenges {
+    pending: HashMap<String, PendingChallenge>,
+    // identifiers of the pending challenges of each user, never more than
+    // the limit per user, so that it is checked without a scan of them all
+    by_user: HashMap<String, Vec<String>>,
+    // time at which each commitment of a user is forgotten
+    commitments: HashMap<(String, [u8; 32]), SystemTime>,
+}
+
+impl Challenges {
+    fn insert(self: &mut Self, auth_id: &str, challenge: &PendingChallenge) {
+        self.remove(auth_id);
+        self.pending.insert(auth_id.to_string(), challenge.clone());
+        let ids = self.by_user.entry(challenge.user.clone()).or_default();
+        ids.push(auth_id.to_string());
+    }
+
+    fn remove(self: &mut Self, auth_id: &str) -> Option<PendingChallenge> {
+        let pending = self.pending.remove(auth_id)?;
+        if let Some(ids) = self.by_user.get_mut(&pending.user) {
+            ids.retain(|id| id != auth_id);
+            if ids.is_empty() {
+                self.by_user.remove(&pending.user);
+            }
+        }
+        Some(pending)
+    }
+
+    /// Removes the challenges expired at `now` and returns how many there
+    /// were.
+    fn remove_expired(self: &mut Self, now: SystemTime) -> usize {
+        let expired: Vec<String> = self
+            .pending
+            .iter()
+            .filter(|(_, pending)| pending.expires_at <= now)
+            .map(|(auth_id, _)| auth_id.clone())
+            .collect();
+        for auth_id in &expired {
+            self.remove(auth_id);
+        }
+        expired.len()
+    }
+
+    /// Removes the challenges of `user` expired at `now` and returns the
+    /// number of those left.
+    fn outstanding(self: &mut Self, user: &str, now: SystemTime) -> usize {
+        let Some(ids) = self.by_user.get(user) else {
+            return 0;
+        };
+        let expired: Vec<String> = ids
+            .iter()
+            .filter(|auth_id| self.pending[*auth_id].expires_at <= now)
+            .cloned()
+            .collect();
+        for auth_id in &expired {
+            self.remove(auth_id);
+        }
+        self.by_user.get(user).map_or(0, Vec::len)
+    }
+}
+
+impl MemoryStore {
+    pub fn new() -> MemoryStore {
+        Default::default()
+    }
+}
+
+impl Store for MemoryStore {
+    fn save_user(self: &Self, user: &str, y1: &Point, y2: &Point) -> Result<(), Error> {
+        let users = &mut *self.users.lock().unwrap();
+        users.insert(user.to_string(), (y1.clone(), y2.clone()));
+        Ok(())
+    }
+
+    fn load_user(self: &Self, user: &str) -> Result<Option<(Point, Point)>, Error> {
+        Ok(self.users.lock().unwrap().get(user).cloned())
+    }
+
+    fn save_challenge(
+        self: &Self,
+        auth_id: &str,
+        challenge: &PendingChallenge,
+        limits: &AuthLimits,
+    ) -> Result<(), Error> {
+        let now = SystemTime::now();
+        let challenges = &mut *self.challenges.lock().unwrap();
+        if challenges.pending.len() >= limits.max_total {
+            challenges.remove_expired(now);
+        }
+        let outstanding = challenges.outstanding(&challenge.user, now);
+        if challenges.pending.len() >= limits.max_total || outstanding >= limits.max_per_user {
+            return Err(Error::TooManyChallenges);
+        }
+
+        let commitments = &mut challenges.commitments;
+        let key = (challenge.user.clone(), challenge.commitment_fingerprint());
+        if commitments
+            .get(&key)
+            .is_some_and(|&remembered| remembered > now)
+        {
+            return Err(Error::CommitmentReuse);
+        }
+        if commitments.len() >= limits.max_commitments {
+            commitments.retain(|_, forget_at| *forget_at > now);
+            if commitments.len() >= limits.max_commitments {
+                return Err(Error::TooManyChallenges);
+            }
+        }
+
+        commitments.insert(key, now + limits.commitment_window);
+        challenges.insert(auth_id, challenge);
+        Ok(())
+    }
+
+    fn consume_challenge(self: &Self, auth_id: &str) -> Result<Option<PendingChallenge>, Error> {
+        Ok(self.challenges.lock().unwrap().remove(auth_id))
+    }
+
+    fn pending_challenges(self: &Self) -> Result<usize, Error> {
+        Ok(self.challenges.lock().unwrap().pending.len())
+    }
+
+    fn remove_expired_challenges(self: &Self, now: SystemTime) -> Result<usize, Error> {
+        let challenges = &mut *self.challenges.lock().unwrap();
+        challenges
+            .commitments
+            .retain(|_, forget_at| *forget_at > now);
+        Ok(challenges.remove_expired(now))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::Group;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+    use std::time::Duration;
+
+    #[test]
+    fn test_memory_store() {
+        let store = MemoryStore::new();
+        let group = Group::Scalar;
+        let (_, y1, y2) = group.generate_key().unwrap();
+        assert_eq!(store.load_user("alice"), Ok(None));
+        store.save_user("alice", &y1, &y2).unwrap();
+        assert_eq!(store.load_user("alice"), Ok(Some((y1, y2))));
+
+        let (_, commitment) = group.commit().unwrap();
+        let now = SystemTime::now();
+        let challenge = PendingChallenge {
+            user: "alice".to_string(),
+            commitment,
+            c: group.challenge(),
+            expires_at: now + Duration::from_secs(60),
+        };
+        let limits = AuthLimits::default();
+        store.save_challenge("id", &challenge, &limits).unwrap();
+        assert_eq!(store.pending_challenges(), Ok(1));
+        assert_eq!(store.remove_expired_challenges(now), Ok(0));
+        let later = now + Duration::from_secs(60);
+        assert_eq!(store.remove_expired_challenges(later), Ok(1));
+
+        // only one of the concurrent consumers gets the challenge
+        let challenge = PendingChallenge {
+            commitment: group.commit().unwrap().1,
+            ..challenge
+        };
+        store.save_challenge("id", &challenge, &limits).unwrap();
+        let consumed = AtomicUsize::new(0);
+        std::thread::scope(|scope| {
+            for _ in 0..8 {
+                scope.spawn(|| {
+                    if store.consume_challenge("id").unwrap().is_some() {
+                        consumed.fetch_add(1, Ordering::Relaxed);
+                    }
+                });
+            }
+        });
+        assert_eq!(consumed.load(Ordering::Relaxed), 1);
+        assert_eq!(store.pending_challenges(), Ok(0));
+
+        // the commitment of a consumed challenge is still remembered
+        assert_eq!(
+            store.save_challenge("other", &challenge, &limits),
+            Err(Error::CommitmentReuse)
+        );
+        let bob = PendingChallenge {
+            user: "bob".to_string(),
+            ..challenge.clone()
+        };
+        store.save_challenge("bob", &bob, &limits).unwrap();
+        let forget_at = SystemTime::now() + limits.commitment_window;
+        store.remove_expired_challenges(forget_at).unwrap();
+        assert_eq!(store.challenges.lock().unwrap().commitments.len(), 0);
+    }
+
+    #[test]
+    fn test_memory_store_rejected_challenges() {
+        let store = MemoryStore::new();
+        let group = Group::Scalar;
+        let limits = AuthLimits {
+            max_per_user: 1,
+            max_commitments: 2,
+            ..Default::default()
+        };
+        let challenge = || PendingChallenge {
+            user: "alice".to_string(),
+            commitment: group.commit().unwrap().1,
+            c: group.challenge(),
+            expires_at: SystemTime::now() + Duration::from_secs(60),
+        };
+
+        // challenges over the limits don't leave their commitment behind
+        store.save_challenge("1", &challenge(), &limits).unwrap();
+        for _ in 0..4 {
+            assert_eq!(
+                store.save_challenge("2", &challenge(), &limits),
+                Err(Error::TooManyChallenges)
+            );
+        }
+        assert_eq!(store.challenges.lock().unwrap().commitments.len(), 1);
+
+        // nor do they when the commitments remembered reach their limit
+        store.consume_challenge("1").unwrap();
+        store.save_challenge("2", &challenge(), &limits).unwrap();
+        store.consume_challenge("2").unwrap();
+        assert_eq!(
+            store.save_challenge("3", &challenge(), &limits),
+            Err(Error::TooManyChallenges)
+        );
+        let challenges = store.challenges.lock().unwrap();
+        assert_eq!(challenges.commitments.len(), 2);
+        assert!(challenges.pending.is_empty());
+        assert!(challenges.by_user.is_empty());
+    }
+
+    #[test]
+    fn test_memory_store_challenges_per_user() {
+        let store = MemoryStore::new();
+        let group = Group::Scalar;
+        let limits = AuthLimits {
+            max_per_user: 2,
+            ..Default::default()
+        };
+        let challenge = |user: &str, ttl| PendingChallenge {
+            user: user.to_string(),
+            commitment: group.commit().unwrap().1,
+            c: group.challenge(),
+            expires_at: SystemTime::now() + ttl,
+        };
+        let minute = Duration::from_secs(60);
+
+        // the expired challenges of the user don't count
+        store
+            .save_challenge("1", &challenge("alice", Duration::ZERO), &limits)
+            .unwrap();
+        store
+            .save_challenge("2", &challenge("alice", minute), &limits)
+            .unwrap();
+        store
+            .save_challenge("3", &challenge("alice", minute), &limits)
+            .unwrap();
+        assert_eq!(
+            store.save_challenge("4", &challenge("alice", minute), &limits),
+            Err(Error::TooManyChallenges)
+        );
+        store
+            .save_challenge("4", &challenge("bob", minute), &limits)
+            .unwrap();
+
+        store.consume_challenge("2").unwrap();
+        store
+            .save_challenge("5", &challenge("alice", minute), &limits)
+            .unwrap();
+        let later = SystemTime::now() + minute;
+        assert_eq!(store.remove_expired_challenges(later), Ok(3));
+        assert!(store.challenges.lock().unwrap().by_user.is_empty());
+    }
+}
@@ -0,0 +1,583 @@
+//! Streaming serialization of points and proofs. Every object is framed as a
+//! 4-byte big-endian length followed by its serialized bytes, which allows
+//! appending many of them to the same stream and reading them back in order.
+use std::io::{self, Read, Write};
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{mpsc, Condvar, Mutex};
+use std::time::Duration;
+
+use crate::{max_serialized_size, Error, Group, Point, Proof};
+
+impl Point {
+    /// Writes the framed Point into `w`, returning the number of bytes written.
+    pub fn write_to<W: Write>(self: &Self, w: &mut W) -> io::Result<u64> {
+        write_frame(w, &self.serialize())
+    }
+
+    /// Reads the next framed Point of `group` from `r`. Malformed data returns
+    /// an error of kind `InvalidData`.
+    pub fn read_from<R: Read>(r: &mut R, group: &Group) -> io::Result<Point> {
+        Point::deserialize(read_frame(r)?, group)
+            .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+    }
+}
+
+impl Proof {
+    /// Writes the framed Proof of `group` into `w`, returning the number of
+    /// bytes written.
+    pub fn write_to<W: Write>(self: &Self, w: &mut W, group: &Group) -> io::Result<u64> {
+        write_frame(w, &self.serialize(group))
+    }
+
+    /// Reads the next framed Proof of `group` from `r`. Malformed data returns
+    /// an error of kind `InvalidData`.
+    pub fn read_from<R: Read>(r: &mut R, group: &Group) -> io::Result<Proof> {
+        Proof::deserialize(read_frame(r)?, group)
+            .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+    }
+}
+
+/// Iterator over the framed points of a stream, created with
+/// `Point::read_all_from`. It yields the points until the stream ends at the
+/// boundary of a frame, and ends after the first error, which is returned like
+/// by `Point::read_from`. No buffer is kept between the items, every point is
+/// owned by the caller.
+#[derive(Debug)]
+pub struct PointReader<'a, R> {
+    frames: FrameReader<R>,
+    group: &'a Group,
+}
+
+impl<R: Read> Iterator for PointReader<'_, R> {
+    type Item = io::Result<Point>;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        let frame = self.frames.next()?;
+        let point = frame.and_then(|frame| {
+            Point::deserialize(frame, self.group)
+                .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+        });
+        self.frames.done |= point.is_err();
+        Some(point)
+    }
+}
+
+/// Same as PointReader for the framed proofs, created with
+/// `Proof::read_all_from`.
+#[derive(Debug)]
+pub struct ProofReader<'a, R> {
+    frames: FrameReader<R>,
+    group: &'a Group,
+}
+
+impl<R: Read> Iterator for ProofReader<'_, R> {
+    type Item = io::Result<Proof>;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        let frame = self.frames.next()?;
+        let proof = frame.and_then(|frame| {
+            Proof::deserialize(frame, self.group)
+                .map_err(|e| io::Error::new(io::ErrorKind::InvalidData, e))
+        });
+        self.frames.done |= proof.is_err();
+        Some(proof)
+    }
+}
+
+impl Point {
+    /// Returns an iterator over the framed points of `group` in `r`, see
+    /// PointReader. Pass `&mut r` to keep using the stream afterwards.
+    pub fn read_all_from<R: Read>(r: R, group: &Group) -> PointReader<'_, R> {
+        PointReader {
+            frames: FrameReader { r, done: false },
+            group,
+        }
+    }
+}
+
+impl Proof {
+    /// Returns an iterator over the framed proofs of `group` in `r`, see
+    /// ProofReader. Pass `&mut r` to keep using the stream afterwards.
+    pub fn read_all_from<R: Read>(r: R, group: &Group) -> ProofReader<'_, R> {
+        ProofReader {
+            frames: FrameReader { r, done: false },
+            group,
+        }
+    }
+}
+
+/// Iterator over the raw frames of a stream shared by the readers, which stops
+/// at the end of the stream or after the first error.
+#[derive(Debug)]
+struct FrameReader<R> {
+    r: R,
+    done: bool,
+}
+
+impl<R: Read> Iterator for FrameReader<R> {
+    type Item = io::Result<Vec<u8>>;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        if self.done {
+            return None;
+        }
+
+        let frame = read_frame_or_eof(&mut self.r).transpose();
+        self.done = !matches!(frame, Some(Ok(_)));
+        frame
+    }
+}
+
+/// Result of the verification of the record number `index`, counting from
+/// zero, of `Group::verify_stream`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct StreamResult {
+    pub index: usize,
+    pub result: Result<bool, Error>,
+}
+
+/// Graceful shutdown of `Group::verify_stream_with_shutdown`, e.g. when a
+/// server terminates: the stream stops reading new records but the records
+/// already read are still verified and their results sent. Use one per
+/// stream.
+#[derive(Debug, Default)]
+pub struct StreamShutdown {
+    closing: AtomicBool,
+    abandoned: AtomicBool,
+    finished: Mutex<bool>,
+    finished_changed: Condvar,
+}
+
+impl StreamShutdown {
+    pub fn new() -> StreamShutdown {
+        Default::default()
+    }
+
+    /// Stops reading new records without waiting for the ones already read.
+    /// A read in progress is not interrupted, the stream stops once it
+    /// returns.
+    pub fn close(self: &Self) {
+        self.closing.store(true, Ordering::Relaxed);
+    }
+
+    /// Closes the stream and waits until the records already read are
+    /// verified, their results sent and the results channel closed. Past
+    /// `timeout`, the records not verified yet are abandoned without result
+    /// and `Error::Timeout` is returned; the verifications in progress still
+    /// finish in the background.
+    pub fn shutdown(self: &Self, timeout: Duration) -> Result<(), Error> {
+        self.close();
+
+        let finished = self.finished.lock().unwrap();
+        let (finished, _) = self
+            .finished_changed
+            .wait_timeout_while(finished, timeout, |finished| !*finished)
+            .unwrap();
+        if *finished {
+            return Ok(());
+        }
+        self.abandoned.store(true, Ordering::Relaxed);
+        Err(Error::Timeout)
+    }
+
+    fn finish(self: &Self) {
+        *self.finished.lock().unwrap() = true;
+        self.finished_changed.notify_all();
+    }
+}
+
+impl Group {
+    /// Reads records of framed `y1`, `y2` and proof (see `write_to`) from `r`
+    /// until its end and verifies them with `workers` threads (at least one).
+    /// A StreamResult is sent to `results` for every record, in the order the
+    /// verifications finish; records that don't deserialize get an error
+    /// there too. At most `workers` records are read ahead of the workers, so
+    /// a slow consumer of `results` slows the reading down instead of
+    /// filling the memory.
+    ///
+    /// Returns the number of records read. Reading stops with an error of
+    /// kind `Interrupted` when `cancel` is set, and with the error of `r` if
+    /// the stream ends in the middle of a record or fails.
+    pub fn verify_stream<R: Read>(
+        self: &Self,
+        r: &mut R,
+        workers: usize,
+        cancel: &AtomicBool,
+        results: &mpsc::SyncSender<StreamResult>,
+    ) -> io::Result<usize> {
+        self.run_stream(r, workers, cancel, None, results)
+    }
+
+    /// Same as `verify_stream` but the reading stops without error when
+    /// `shutdown` is closed, and `results` is dropped once the results of all
+    /// the records read were sent, so that its receiver sees the end of the
+    /// stream. `StreamShutdown::shutdown` waits for that.
+    pub fn verify_stream_with_shutdown<R: Read>(
+        self: &Self,
+        r: &mut R,
+        workers: usize,
+        shutdown: &StreamShutdown,
+        results: mpsc::SyncSender<StreamResult>,
+    ) -> io::Result<usize> {
+        let cancel = AtomicBool::new(false);
+        let outcome = self.run_stream(r, workers, &cancel, Some(shutdown), &results);
+        drop(results);
+        shutdown.finish();
+        outcome
+    }
+
+    fn run_stream<R: Read>(
+        self: &Self,
+        r: &mut R,
+        workers: usize,
+        cancel: &AtomicBool,
+        shutdown: Option<&StreamShutdown>,
+        results: &mpsc::SyncSender<StreamResult>,
+    ) -> io::Result<usize> {
+        let workers = workers.max(1);
+        let (jobs, queue) = mpsc::sync_channel::<(usize, [Vec<u8>; 3])>(workers);
+        let queue = Mutex::new(queue);
+        // set when `results` has no receiver anymore
+        let closed = AtomicBool::new(false);
+
+        std::thread::scope(|scope| {
+            for _ in 0..workers {
+                scope.spawn(|| loop {
+                    let job = queue.lock().unwrap().recv();
+                    let Ok((index, record)) = job else {
+                        break;
+                    };
+                    // the queue is drained even when nobody listens so the
+                    // reader never blocks on it
+                    let abandoned = shutdown.is_some_and(|s| s.abandoned.load(Ordering::Relaxed));
+                    if closed.load(Ordering::Relaxed) || abandoned {
+                        continue;
+                    }
+
+                    let result = self.verify_record(record);
+                    if results.send(StreamResult { index, result }).is_err() {
+                        closed.store(true, Ordering::Relaxed);
+                    }
+                });
+            }
+
+            let mut count = 0;
+            let outcome = loop {
+                if cancel.load(Ordering::Relaxed) {
+                    break Err(io::Error::new(io::ErrorKind::Interrupted, Error::Cancelled));
+                }
+                let closing = shutdown.is_some_and(|s| s.closing.load(Ordering::Relaxed));
+                if closed.load(Ordering::Relaxed) || closing {
+                    break Ok(count);
+                }
+
+                match read_record(r) {
+                    Ok(Some(record)) => {
+                        jobs.send((count, record))
+                            .expect("The verification workers stopped");
+                        count += 1;
+                    }
+                    Ok(None) => break Ok(count),
+                    Err(e) => break Err(e),
+                }
+            };
+
+            // lets the workers finish once the queue is empty
+            drop(jobs);
+            outcome
+        })
+    }
+
+    fn verify_record(self: &Self, record: [Vec<u8>; 3]) -> Result<bool, Error> {
+        let [y1, y2, proof] = record;
+        let y1 = Point::deserialize(y1, self)?;
+        let y2 = Point::deserialize(y2, self)?;
+        let proof = Proof::deserialize(proof, self)?;
+        self.verify_proof(&y1, &y2, &proof)
+    }
+}
+
+/// Reads the three frames of a record of `Group::verify_stream`, or `None` if
+/// the stream ends before it.
+fn read_record<R: Read>(r: &mut R) -> io::Result<Option<[Vec<u8>; 3]>> {
+    let Some(y1) = read_frame_or_eof(r)? else {
+        return Ok(None);
+    };
+    Ok(Some([y1, read_frame(r)?, read_frame(r)?]))
+}
+
+fn write_frame<W: Write>(w: &mut W, payload: &[u8]) -> io::Result<u64> {
+    let len = u32::try_from(payload.len())
+        .map_err(|_| io::Error::new(io::ErrorKind::InvalidInput, "payload too large"))?;
+
+    w.write_all(&len.to_be_bytes())?;
+    w.write_all(payload)?;
+    Ok(4 + payload.len() as u64)
+}
+
+fn read_frame<R: Read>(r: &mut R) -> io::Result<Vec<u8>> {
+    read_frame_or_eof(r)?.ok_or_else(|| io::ErrorKind::UnexpectedEof.into())
+}
+
+/// Same as `read_frame` but returns `None` if the stream ends before the
+/// frame, and an error only if it ends in the middle of it.
+fn read_frame_or_eof<R: Read>(r: &mut R) -> io::Result<Option<Vec<u8>>> {
+    let mut len = [0u8; 4];
+    let mut filled = 0;
+    while filled < len.len() {
+        match r.read(&mut len[filled..]) {
+            Ok(0) if filled == 0 => return Ok(None),
+            Ok(0) => return Err(io::ErrorKind::UnexpectedEof.into()),
+            Ok(n) => filled += n,
+            Err(e) if e.kind() == io::ErrorKind::Interrupted => {}
+            Err(e) => return Err(e),
+        }
+    }
+    let len = u32::from_be_bytes(len) as u64;
+    if len > max_serialized_size() as u64 {
+        return Err(io::Error::new(
+            io::ErrorKind::InvalidData,
+            Error::SizeLimitExceeded,
+        ));
+    }
+
+    // The length isn't trusted to preallocate the buffer
+    let mut payload = Vec::new();
+    r.take(len).read_to_end(&mut payload)?;
+    if payload.len() as u64 != len {
+        return Err(io::ErrorKind::UnexpectedEof.into());
+    }
+    Ok(Some(payload))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use num_bigint::BigUint;
+
+    #[test]
+    fn test_stream_proofs() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, _) = group.generate_key().unwrap();
+            let proofs = [
+                group.create_proof(&x).unwrap(),
+                group.create_proof(&x).unwrap(),
+            ];
+
+            let mut buffer = Vec::new();
+            let mut written = y1.write_to(&mut buffer).unwrap();
+            for proof in &proofs {
+                written += proof.write_to(&mut buffer, &group).unwrap();
+            }
+            assert_eq!(written, buffer.len() as u64);
+
+            let mut reader = &buffer[..];
+            assert_eq!(Point::read_from(&mut reader, &group).unwrap(), y1);
+            for proof in &proofs {
+                assert_eq!(Proof::read_from(&mut reader, &group).unwrap(), *proof);
+            }
+
+            let err = Proof::read_from(&mut reader, &group).unwrap_err();
+            assert_eq!(err.kind(), io::ErrorKind::UnexpectedEof);
+        }
+    }
+
+    #[test]
+    fn test_read_all_from() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let proofs = [
+                group.create_proof(&x).unwrap(),
+                group.create_proof(&x).unwrap(),
+            ];
+
+            let mut buffer = Vec::new();
+            y1.write_to(&mut buffer).unwrap();
+            y2.write_to(&mut buffer).unwrap();
+            let points: Vec<Point> = Point::read_all_from(&buffer[..], &group)
+                .collect::<io::Result<_>>()
+                .unwrap();
+            assert_eq!(points, [y1.clone(), y2.clone()]);
+
+            let mut buffer = Vec::new();
+            for proof in &proofs {
+                proof.write_to(&mut buffer, &group).unwrap();
+            }
+            let read: Vec<Proof> = Proof::read_all_from(&buffer[..], &group)
+                .collect::<io::Result<_>>()
+                .unwrap();
+            assert_eq!(read, proofs);
+
+            // an empty stream has no items
+            assert_eq!(Point::read_all_from(&[][..], &group).count(), 0);
+
+            // the iteration ends after the first error
+            buffer.pop();
+            let mut reader = Proof::read_all_from(&buffer[..], &group);
+            assert_eq!(reader.next().unwrap().unwrap(), proofs[0]);
+            let err = reader.next().unwrap().unwrap_err();
+            assert_eq!(err.kind(), io::ErrorKind::UnexpectedEof);
+            assert!(reader.next().is_none());
+        }
+
+        let mut buffer = Vec::new();
+        write_frame(&mut buffer, &[]).unwrap();
+        write_frame(&mut buffer, &[1]).unwrap();
+        let mut reader = Point::read_all_from(&buffer[..], &Group::Scalar);
+        let err = reader.next().unwrap().unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::InvalidData);
+        assert!(reader.next().is_none());
+    }
+
+    #[test]
+    fn test_verify_stream() {
+        let group = Group::EllipticCurve;
+        let mut buffer = Vec::new();
+        for i in 0..5 {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let mut proof = group.create_proof(&x).unwrap();
+            if i == 3 {
+                proof.s += 1u32;
+            }
+            y1.write_to(&mut buffer).unwrap();
+            y2.write_to(&mut buffer).unwrap();
+            proof.write_to(&mut buffer, &group).unwrap();
+        }
+
+        let cancel = AtomicBool::new(false);
+        let (sender, receiver) = mpsc::sync_channel(1);
+        let collector = std::thread::spawn(move || receiver.iter().collect::<Vec<_>>());
+        let count = group
+            .verify_stream(&mut &buffer[..], 2, &cancel, &sender)
+            .unwrap();
+        drop(sender);
+        assert_eq!(count, 5);
+
+        let mut results = collector.join().unwrap();
+        results.sort_by_key(|result| result.index);
+        let valid: Vec<_> = results.iter().map(|result| result.result).collect();
+        assert_eq!(valid, [Ok(true), Ok(true), Ok(true), Ok(false), Ok(true)]);
+
+        // a stream ending in the middle of a record
+        let (sender, _receiver) = mpsc::sync_channel(8);
+        let truncated = &buffer[..buffer.len() - 1];
+        let err = group
+            .verify_stream(&mut &truncated[..], 2, &cancel, &sender)
+            .unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::UnexpectedEof);
+
+        cancel.store(true, Ordering::Relaxed);
+        let err = group
+            .verify_stream(&mut &buffer[..], 2, &cancel, &sender)
+            .unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::Interrupted);
+    }
+
+    /// Reader calling `on_limit` once `limit` bytes were read.
+    struct LimitReader<'a, F> {
+        data: &'a [u8],
+        limit: usize,
+        on_limit: F,
+    }
+
+    impl<F: Fn()> Read for LimitReader<'_, F> {
+        fn read(&mut self, buf: &mut [u8]) -> io::Result<usize> {
+            let len = buf.len().min(self.limit);
+            let n = self.data.read(&mut buf[..len])?;
+            self.limit -= n;
+            if self.limit == 0 {
+                (self.on_limit)();
+            }
+            Ok(n)
+        }
+    }
+
+    #[test]
+    fn test_verify_stream_with_shutdown() {
+        let group = Group::Scalar;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let mut buffer = Vec::new();
+        let mut ends = Vec::new();
+        for _ in 0..6 {
+            y1.write_to(&mut buffer).unwrap();
+            y2.write_to(&mut buffer).unwrap();
+            group
+                .create_proof(&x)
+                .unwrap()
+                .write_to(&mut buffer, &group)
+                .unwrap();
+            ends.push(buffer.len());
+        }
+
+        // closed after the second record: its results are still sent, then
+        // the channel is closed
+        let shutdown = StreamShutdown::new();
+        let mut reader = LimitReader {
+            data: &buffer,
+            limit: ends[1],
+            on_limit: || shutdown.close(),
+        };
+        let (sender, receiver) = mpsc::sync_channel(1);
+        let collector = std::thread::spawn(move || receiver.iter().collect::<Vec<_>>());
+        let count = group
+            .verify_stream_with_shutdown(&mut reader, 2, &shutdown, sender)
+            .unwrap();
+        assert_eq!(count, 2);
+        let results = collector.join().unwrap();
+        assert_eq!(results.len(), 2);
+        assert!(results.iter().all(|result| result.result == Ok(true)));
+        assert_eq!(shutdown.shutdown(Duration::ZERO), Ok(()));
+
+        // nobody receives the results of the 4 records read, so the draining
+        // can't finish
+        let shutdown = StreamShutdown::new();
+        let (sender, receiver) = mpsc::sync_channel(0);
+        let (read, has_read) = mpsc::channel();
+        let mut reader = LimitReader {
+            data: &buffer,
+            limit: ends[3],
+            on_limit: move || {
+                let _ = read.send(());
+            },
+        };
+        std::thread::scope(|scope| {
+            let stream = scope
+                .spawn(|| group.verify_stream_with_shutdown(&mut reader, 2, &shutdown, sender));
+            has_read.recv().unwrap();
+            assert_eq!(
+                shutdown.shutdown(Duration::from_millis(50)),
+                Err(Error::Timeout)
+            );
+            drop(receiver);
+            assert_eq!(stream.join().unwrap().unwrap(), 4);
+        });
+    }
+
+    #[test]
+    fn test_stream_invalid_input() {
+        let group = Group::Scalar;
+
+        // truncated payload
+        let mut buffer = Vec::new();
+        Point::Scalar(BigUint::from(2892u32))
+            .write_to(&mut buffer)
+            .unwrap();
+        buffer.pop();
+        let err = Point::read_from(&mut &buffer[..], &group).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::UnexpectedEof);
+
+        // empty payload
+        let err = Point::read_from(&mut &[0u8, 0, 0, 0][..], &group).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::InvalidData);
+
+        // huge length, rejected before reading the data behind it
+        let err = Proof::read_from(&mut &[0xffu8, 0xff, 0xff, 0xff][..], &group).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::InvalidData);
+        let err = err.into_inner().unwrap().downcast::<Error>().unwrap();
+        assert_eq!(*err, Error::SizeLimitExceeded);
+
+        // length within the limit without the data behind it
+        let err = Proof::read_from(&mut &[0u8, 0, 0xff, 0xff][..], &group).unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::UnexpectedEof);
+    }
+}
@@ -0,0 +1,223 @@
+//! Default timeouts of the slow operations of a group, so that the
+//! applications that want them set them once instead of at each call site.
+//! The timeouts are part of the group value: they are copied to the clones
+//! made afterwards, and the other instances of the same group, e.g. created
+//! again from the same parameters, keep their own.
+//!
+//! An operation with a timeout runs in a pool of `available_parallelism`
+//! threads and returns `Error::Timeout` if it isn't finished in time. A
+//! running operation can't be interrupted: it keeps its thread until it is
+//! done, its late result is dropped and a secret copied for it is overwritten
+//! with zeros. Operations still waiting for a thread when their caller gives
+//! up are never run, so a burst of slow operations delays the following ones
+//! but never piles up threads.
+use std::panic::{self, AssertUnwindSafe};
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::mpsc::{self, Receiver, RecvTimeoutError, Sender};
+use std::sync::{Arc, Mutex, OnceLock};
+use std::thread;
+use std::time::Duration;
+
+use crate::{Error, Group};
+
+/// Operations that can be given a timeout with `Group::set_operation_timeout`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Operation {
+    /// `Group::generate_key`, which behaves like `generate_key_timeout`.
+    GenerateKey,
+    /// `Group::create_proof`.
+    CreateProof,
+    /// `Group::verify_proof`.
+    Verify,
+}
+
+impl Group {
+    /// Sets the timeout of `operation` for this group. A zero duration, the
+    /// default, means no timeout and no thread.
+    pub fn set_operation_timeout(self: &mut Self, operation: Operation, timeout: Duration) {
+        self.timeouts[operation as usize] = timeout;
+    }
+
+    /// Same as `set_operation_timeout` but returns the group, e.g. to
+    /// configure it where it is created.
+    pub fn with_operation_timeout(
+        mut self: Self,
+        operation: Operation,
+        timeout: Duration,
+    ) -> Group {
+        self.set_operation_timeout(operation, timeout);
+        self
+    }
+
+    /// Returns the timeout of `operation`, see `set_operation_timeout`.
+    pub fn operation_timeout(self: &Self, operation: Operation) -> Duration {
+        self.timeouts[operation as usize]
+    }
+}
+
+type Job = Box<dyn FnOnce() + Send>;
+
+/// Sender of the jobs to the threads of the pool, started on the first use.
+fn pool() -> &'static Mutex<Sender<Job>> {
+    static POOL: OnceLock<Mutex<Sender<Job>>> = OnceLock::new();
+    POOL.get_or_init(|| {
+        let (sender, receiver) = mpsc::channel::<Job>();
+        let receiver = Arc::new(Mutex::new(receiver));
+        let threads = thread::available_parallelism().map_or(4, |n| n.get());
+        for _ in 0..threads {
+            let receiver = Arc::clone(&receiver);
+            thread::spawn(move || work(&receiver));
+        }
+        Mutex::new(sender)
+    })
+}
+
+fn work(receiver: &Mutex<Receiver<Job>>) {
+    loop {
+        let job = match receiver.lock().unwrap().recv() {
+            Ok(job) => job,
+            Err(_) => return,
+        };
+        // a panic is reported to the caller by the job, the thread goes on
+        let _ = panic::catch_unwind(AssertUnwindSafe(job));
+    }
+}
+
+/// Runs `f` in the pool unless `abandoned` is set before it starts.
+pub(crate) fn spawn<F>(abandoned: Arc<AtomicBool>, f: F)
+where
+    F: FnOnce() + Send + 'static,
+{
+    let job: Job = Box::new(move || {
+        if !abandoned.load(Ordering::Relaxed) {
+            f();
+        }
+    });
+    // the threads never stop, so the receiver is always there
+    let _ = pool().lock().unwrap().send(job);
+}
+
+/// Runs `f` in the pool and waits for it at most `timeout`. A panic of `f` is
+/// resumed in the caller, like if it was called directly.
+pub(crate) fn run_with_timeout<T, F>(timeout: Duration, f: F) -> Result<T, Error>
+where
+    T: Send + 'static,
+    F: FnOnce() -> Result<T, Error> + Send + 'static,
+{
+    let (sender, receiver) = mpsc::channel();
+    let abandoned = Arc::new(AtomicBool::new(false));
+    spawn(Arc::clone(&abandoned), move || {
+        // the receiver is gone if the caller stopped waiting
+        let _ = sender.send(panic::catch_unwind(AssertUnwindSafe(f)));
+    });
+
+    match receiver.recv_timeout(timeout) {
+        Ok(Ok(result)) => result,
+        Ok(Err(payload)) => panic::resume_unwind(payload),
+        Err(RecvTimeoutError::Timeout) => {
+            abandoned.store(true, Ordering::Relaxed);
+            Err(Error::Timeout)
+        }
+        Err(RecvTimeoutError::Disconnected) => {
+            unreachable!("The operation thread exited without a result")
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_run_with_timeout() {
+        let timeout = Duration::from_secs(60);
+        assert_eq!(run_with_timeout(timeout, || Ok(7)), Ok(7));
+        assert_eq!(
+            run_with_timeout(timeout, || Err::<(), _>(Error::InvalidProof)),
+            Err(Error::InvalidProof)
+        );
+
+        let late = run_with_timeout(Duration::from_millis(10), || {
+            thread::sleep(Duration::from_secs(1));
+            Ok(())
+        });
+        assert_eq!(late, Err(Error::Timeout));
+
+        let panicked = panic::catch_unwind(|| {
+            run_with_timeout(timeout, || -> Result<(), Error> { panic!("failed") })
+        });
+        assert!(panicked.is_err());
+        // the thread of the panic is still usable
+        assert_eq!(run_with_timeout(timeout, || Ok(7)), Ok(7));
+    }
+
+    #[test]
+    fn test_abandoned_operations_not_run() {
+        let threads = thread::available_parallelism().map_or(4, |n| n.get());
+        let (release, blocked) = mpsc::channel::<()>();
+        let blocked = Arc::new(Mutex::new(blocked));
+        let (started, busy) = mpsc::channel();
+        // all the threads of the pool busy until released
+        for _ in 0..threads {
+            let (blocked, started) = (Arc::clone(&blocked), started.clone());
+            spawn(Arc::new(AtomicBool::new(false)), move || {
+                started.send(()).unwrap();
+                let _ = blocked
+                    .lock()
+                    .unwrap()
+                    .recv_timeout(Duration::from_secs(10));
+            });
+        }
+        for _ in 0..threads {
+            busy.recv().unwrap();
+        }
+
+        let ran = Arc::new(AtomicBool::new(false));
+        let flag = Arc::clone(&ran);
+        let late = run_with_timeout(Duration::from_millis(10), move || {
+            flag.store(true, Ordering::Relaxed);
+            Ok(())
+        });
+        assert_eq!(late, Err(Error::Timeout));
+
+        for _ in 0..threads {
+            let _ = release.send(());
+        }
+        assert_eq!(run_with_timeout(Duration::from_secs(60), || Ok(7)), Ok(7));
+        assert!(!ran.load(Ordering::Relaxed));
+    }
+
+    #[test]
+    fn test_operation_timeout() {
+        let mut group = Group::new_with_params(&[23], &[11], &[4], &[9]).unwrap();
+        assert_eq!(group.operation_timeout(Operation::Verify), Duration::ZERO);
+        group.set_operation_timeout(Operation::Verify, Duration::from_secs(3600));
+        assert_eq!(
+            group.clone().operation_timeout(Operation::Verify),
+            Duration::from_secs(3600)
+        );
+        assert_eq!(
+            group.operation_timeout(Operation::CreateProof),
+            Duration::ZERO
+        );
+        // the other instances of the same group keep their own timeouts
+        let same = Group::new_with_params(&[23], &[11], &[4], &[9]).unwrap();
+        assert_eq!(same.operation_timeout(Operation::Verify), Duration::ZERO);
+        let named = Group::named(crate::GroupId::Modp2048)
+            .with_operation_timeout(Operation::Verify, Duration::from_secs(60));
+        assert_eq!(
+            named.operation_timeout(Operation::Verify),
+            Duration::from_secs(60)
+        );
+
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+        assert!(group.verify_proof(&y1, &y2, &proof).unwrap());
+        let mut tampered = proof;
+        tampered.s += 1u32;
+        assert!(!group.verify_proof(&y1, &y2, &tampered).unwrap());
+
+        group.set_operation_timeout(Operation::Verify, Duration::ZERO);
+        assert_eq!(group.operation_timeout(Operation::Verify), Duration::ZERO);
+    }
+}
@@ -0,0 +1,131 @@
+//! Record of a run of the interactive protocol, e.g. to store every
+//! authentication attempt, attach it to an audit record or replay it against
+//! a verifier in tests.
+use num_bigint::BigUint;
+
+use crate::{
+    check_serialized_size, read_length_prefixed, write_length_prefixed, Commitment, Error, Group,
+    Point, Proof,
+};
+
+/// The commitment sent by the prover, the challenge of the verifier and the
+/// response `s` of the prover.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Transcript {
+    pub commitment: Commitment,
+    pub challenge: BigUint,
+    pub response: BigUint,
+}
+
+impl Transcript {
+    /// Records the run in which the verifier sent `challenge` for
+    /// `commitment` and received `response` from `Group::respond`. Only the
+    /// `s` of the response is kept, the verifier holds the rest.
+    pub fn new(commitment: &Commitment, challenge: &BigUint, response: &Proof) -> Transcript {
+        Transcript {
+            commitment: commitment.clone(),
+            challenge: challenge.clone(),
+            response: response.s.clone(),
+        }
+    }
+
+    /// Serializes the Transcript structure to an array of bytes: the
+    /// serialized commitment, then the challenge and the response in
+    /// big-endian, all preceded by their 4-byte big-endian length.
+    pub fn serialize(self: &Self) -> Vec<u8> {
+        let mut v = Vec::new();
+        write_length_prefixed(&mut v, &self.commitment.serialize());
+        write_length_prefixed(&mut v, &self.challenge.to_bytes_be());
+        write_length_prefixed(&mut v, &self.response.to_bytes_be());
+        v
+    }
+
+    /// Deserializes the Transcript structure from an array of bytes. Empty,
+    /// truncated or oversized inputs return an error.
+    pub fn deserialize(v: Vec<u8>, group: &Group) -> Result<Transcript, Error> {
+        check_serialized_size(v.len())?;
+        let mut data = &v[..];
+
+        let commitment = Commitment::deserialize(read_length_prefixed(&mut data)?.to_vec(), group)?;
+        let challenge = BigUint::from_bytes_be(read_length_prefixed(&mut data)?);
+        let response = BigUint::from_bytes_be(read_length_prefixed(&mut data)?);
+
+        if !data.is_empty() {
+            return Err(Error::InvalidSerialization);
+        }
+
+        Ok(Transcript {
+            commitment,
+            challenge,
+            response,
+        })
+    }
+}
+
+impl Group {
+    /// Checks the recorded run like `verify_interactive` did when it
+    /// happened. Whether the challenge was random and the transcript fresh is
+    /// up to the verifier that recorded it.
+    pub fn verify_transcript(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+        transcript: &Transcript,
+    ) -> Result<bool, Error> {
+        let proof = Proof {
+            r1: transcript.commitment.r1.clone(),
+            r2: transcript.commitment.r2.clone(),
+            c: transcript.challenge.clone(),
+            s: transcript.response.clone(),
+        };
+        self.verify_interactive(
+            y1,
+            y2,
+            &transcript.commitment,
+            &transcript.challenge,
+            &proof,
+        )
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_transcript() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let (k, commitment) = group.commit().unwrap();
+            let c = group.challenge();
+            let response = group.respond(&commitment, &k, &c, &x);
+
+            let transcript = Transcript::new(&commitment, &c, &response);
+            assert!(group.verify_transcript(&y1, &y2, &transcript).unwrap());
+
+            let v = transcript.serialize();
+            let read = Transcript::deserialize(v.clone(), &group).unwrap();
+            assert_eq!(read, transcript);
+            assert!(group.verify_transcript(&y1, &y2, &read).unwrap());
+            for len in 0..v.len() {
+                assert!(Transcript::deserialize(v[..len].to_vec(), &group).is_err());
+            }
+        }
+    }
+
+    #[test]
+    fn test_tampered_transcript() {
+        let group = Group::EllipticCurve;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let (k, commitment) = group.commit().unwrap();
+        let c = group.challenge();
+        let transcript = Transcript::new(&commitment, &c, &group.respond(&commitment, &k, &c, &x));
+
+        let mut other = transcript.clone();
+        other.challenge += 1u32;
+        assert!(!group.verify_transcript(&y1, &y2, &other).unwrap());
+        let mut other = transcript;
+        other.response += 1u32;
+        assert!(!group.verify_transcript(&y1, &y2, &other).unwrap());
+    }
+}
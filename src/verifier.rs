@@ -0,0 +1,489 @@
+//! Verification of many proofs of the same group with precomputed tables. The
+//! constants of the group and the multiples `2^i * g` and `2^i * h` (powers for
+//! integer groups) are computed once, so the fixed-base half of each check
+//! costs additions only.
+use num::traits::{One, Zero};
+use num_bigint::BigUint;
+use std::time::Instant;
+
+use crate::secp256k1::Secp256k1Point;
+use crate::{
+    ct_eq_biguint, ct_eq_secp256k1, fiat_shamir_challenge, get_constants, is_on_curve,
+    record_verification, ChallengeHash, Error, Group, Point, Proof, PublicKey,
+};
+
+/// Multiples `2^i * base` of a fixed point for `i` up to the bit length of the
+/// order of the group.
+#[derive(Debug, Clone)]
+enum FixedBaseTable {
+    Scalar(Vec<BigUint>),
+    EllipticCurve(Vec<Secp256k1Point>),
+}
+
+impl FixedBaseTable {
+    fn new(base: &Point, p: &BigUint, q: &BigUint) -> FixedBaseTable {
+        let bits = q.bits() as usize;
+        match base {
+            Point::Scalar(base) => {
+                let mut table = vec![base.clone()];
+                for i in 1..bits {
+                    table.push((&table[i - 1] * &table[i - 1]) % p);
+                }
+                FixedBaseTable::Scalar(table)
+            }
+            Point::ECPoint(x, y) => {
+                let mut table = vec![Secp256k1Point::from_bigint(x, y)];
+                for i in 1..bits {
+                    table.push(table[i - 1].clone() + table[i - 1].clone());
+                }
+                FixedBaseTable::EllipticCurve(table)
+            }
+        }
+    }
+
+    /// Computes `base^exp mod p` for an exponent already reduced modulo `q`.
+    fn pow_scalar(table: &[BigUint], exp: &BigUint, p: &BigUint) -> BigUint {
+        let mut result = BigUint::from(1u32);
+        for (i, power) in table.iter().enumerate() {
+            if exp.bit(i as u64) {
+                result = (result * power) % p;
+            }
+        }
+        result
+    }
+
+    /// Computes `exp * base` for an exponent already reduced modulo `n`.
+    fn scale_elliptic_curve(table: &[Secp256k1Point], exp: &BigUint) -> Secp256k1Point {
+        let mut result = Secp256k1Point::Zero;
+        for (i, multiple) in table.iter().enumerate() {
+            if exp.bit(i as u64) {
+                result = result + multiple.clone();
+            }
+        }
+        result
+    }
+}
+
+/// Verifier of the proofs created with `create_proof` for a single group. It
+/// holds no mutable state, so it can be shared between threads.
+#[derive(Debug, Clone)]
+pub struct Verifier {
+    p: BigUint,
+    q: BigUint,
+    g: Point,
+    h: Point,
+    g_table: FixedBaseTable,
+    h_table: FixedBaseTable,
+}
+
+impl Verifier {
+    /// Same as `Group::verify_proof` with the group of the verifier.
+    pub fn verify(self: &Self, y1: &Point, y2: &Point, proof: &Proof) -> Result<bool, Error> {
+        let start = Instant::now();
+        let result = self.check(y1, y2, proof);
+        record_verification(y1, y2, proof, &result, start.elapsed());
+        result
+    }
+
+    fn check(self: &Self, y1: &Point, y2: &Point, proof: &Proof) -> Result<bool, Error> {
+        let (p, q) = (&self.p, &self.q);
+
+        let points = [&self.g, &self.h, y1, y2, &proof.r1, &proof.r2];
+        let c = fiat_shamir_challenge(&points, q, ChallengeHash::default(), &[]);
+
+        // g and h have order q, so s can be reduced to the size of the tables
+        let s = &proof.s % q;
+        let valid = match (&self.g_table, &self.h_table, y1, y2, &proof.r1, &proof.r2) {
+            (
+                FixedBaseTable::Scalar(g_table),
+                FixedBaseTable::Scalar(h_table),
+                Point::Scalar(y1),
+                Point::Scalar(y2),
+                Point::Scalar(r1),
+                Point::Scalar(r2),
+            ) => {
+                let gs = FixedBaseTable::pow_scalar(g_table, &s, p);
+                let hs = FixedBaseTable::pow_scalar(h_table, &s, p);
+                let condition_1 = ct_eq_biguint(r1, &((gs * y1.modpow(&proof.c, p)) % p));
+                let condition_2 = ct_eq_biguint(r2, &((hs * y2.modpow(&proof.c, p)) % p));
+                condition_1 & condition_2
+            }
+            (
+                FixedBaseTable::EllipticCurve(g_table),
+                FixedBaseTable::EllipticCurve(h_table),
+                Point::ECPoint(y1x, y1y),
+                Point::ECPoint(y2x, y2y),
+                Point::ECPoint(r1x, r1y),
+                Point::ECPoint(r2x, r2y),
+            ) => {
+                let points = [(y1x, y1y), (y2x, y2y), (r1x, r1y), (r2x, r2y)];
+                if !points.iter().all(|(x, y)| is_on_curve(x, y)) {
+                    return Err(Error::InvalidPoint);
+                }
+
+                let y1 = Secp256k1Point::from_bigint(y1x, y1y);
+                let y2 = Secp256k1Point::from_bigint(y2x, y2y);
+                let r1 = Secp256k1Point::from_bigint(r1x, r1y);
+                let r2 = Secp256k1Point::from_bigint(r2x, r2y);
+
+                let sg = FixedBaseTable::scale_elliptic_curve(g_table, &s);
+                let sh = FixedBaseTable::scale_elliptic_curve(h_table, &s);
+                let cy1 = y1.scale(proof.c.clone());
+                let cy2 = y2.scale(proof.c.clone());
+                ct_eq_secp256k1(&r1, &(sg + cy1)) & ct_eq_secp256k1(&r2, &(sh + cy2))
+            }
+            _ => return Err(Error::InvalidArguments),
+        };
+
+        Ok(ct_eq_biguint(&c, &proof.c) & valid)
+    }
+}
+
+/// Tables of the multiples of the public values `(y1, y2)` of a key for
+/// `Verifier::verify_with_precomputed`, worth it for the few keys verified
+/// over and over, e.g. fixed identities of services.
+#[derive(Debug, Clone)]
+pub struct PrecomputedKey {
+    y1: Point,
+    y2: Point,
+    y1_table: FixedBaseTable,
+    y2_table: FixedBaseTable,
+}
+
+impl PrecomputedKey {
+    pub fn public_key(self: &Self) -> (&Point, &Point) {
+        (&self.y1, &self.y2)
+    }
+}
+
+impl Verifier {
+    /// Precomputes the tables of the public values `(y1, y2)` of a key, which
+    /// must be elements of the group of the verifier. The key must only be
+    /// used with this verifier.
+    pub fn precompute_public_key(
+        self: &Self,
+        y1: &Point,
+        y2: &Point,
+    ) -> Result<PrecomputedKey, Error> {
+        let elements = [y1, y2].iter().all(|y| match (&self.g, y) {
+            (Point::Scalar(_), Point::Scalar(y)) => {
+                !y.is_zero() && *y < self.p && y.modpow(&self.q, &self.p).is_one()
+            }
+            (Point::ECPoint(..), Point::ECPoint(x, y)) => is_on_curve(x, y),
+            _ => false,
+        });
+        if !elements {
+            return Err(Error::InvalidPoint);
+        }
+
+        Ok(PrecomputedKey {
+            y1: y1.clone(),
+            y2: y2.clone(),
+            y1_table: FixedBaseTable::new(y1, &self.p, &self.q),
+            y2_table: FixedBaseTable::new(y2, &self.p, &self.q),
+        })
+    }
+
+    /// Same as `verify` for a precomputed key: both halves of each check
+    /// cost additions only.
+    pub fn verify_with_precomputed(
+        self: &Self,
+        key: &PrecomputedKey,
+        proof: &Proof,
+    ) -> Result<bool, Error> {
+        let start = Instant::now();
+        let result = self.check_with_precomputed(key, proof);
+        record_verification(&key.y1, &key.y2, proof, &result, start.elapsed());
+        result
+    }
+
+    fn check_with_precomputed(
+        self: &Self,
+        key: &PrecomputedKey,
+        proof: &Proof,
+    ) -> Result<bool, Error> {
+        let (p, q) = (&self.p, &self.q);
+
+        let points = [&self.g, &self.h, &key.y1, &key.y2, &proof.r1, &proof.r2];
+        let c = fiat_shamir_challenge(&points, q, ChallengeHash::default(), &[]);
+
+        // all the bases have order q, so the exponents can be reduced to the
+        // size of the tables
+        let s = &proof.s % q;
+        let proof_c = &proof.c % q;
+        let tables = (&self.g_table, &self.h_table, &key.y1_table, &key.y2_table);
+        let valid = match (tables, &proof.r1, &proof.r2) {
+            (
+                (
+                    FixedBaseTable::Scalar(g_table),
+                    FixedBaseTable::Scalar(h_table),
+                    FixedBaseTable::Scalar(y1_table),
+                    FixedBaseTable::Scalar(y2_table),
+                ),
+                Point::Scalar(r1),
+                Point::Scalar(r2),
+            ) => {
+                let gs = FixedBaseTable::pow_scalar(g_table, &s, p);
+                let hs = FixedBaseTable::pow_scalar(h_table, &s, p);
+                let y1c = FixedBaseTable::pow_scalar(y1_table, &proof_c, p);
+                let y2c = FixedBaseTable::pow_scalar(y2_table, &proof_c, p);
+                ct_eq_biguint(r1, &((gs * y1c) % p)) & ct_eq_biguint(r2, &((hs * y2c) % p))
+            }
+            (
+                (
+                    FixedBaseTable::EllipticCurve(g_table),
+                    FixedBaseTable::EllipticCurve(h_table),
+                    FixedBaseTable::EllipticCurve(y1_table),
+                    FixedBaseTable::EllipticCurve(y2_table),
+                ),
+                Point::ECPoint(r1x, r1y),
+                Point::ECPoint(r2x, r2y),
+            ) => {
+                if !is_on_curve(r1x, r1y) || !is_on_curve(r2x, r2y) {
+                    return Err(Error::InvalidPoint);
+                }
+
+                let r1 = Secp256k1Point::from_bigint(r1x, r1y);
+                let r2 = Secp256k1Point::from_bigint(r2x, r2y);
+
+                let sg = FixedBaseTable::scale_elliptic_curve(g_table, &s);
+                let sh = FixedBaseTable::scale_elliptic_curve(h_table, &s);
+                let cy1 = FixedBaseTable::scale_elliptic_curve(y1_table, &proof_c);
+                let cy2 = FixedBaseTable::scale_elliptic_curve(y2_table, &proof_c);
+                ct_eq_secp256k1(&r1, &(sg + cy1)) & ct_eq_secp256k1(&r2, &(sh + cy2))
+            }
+            _ => return Err(Error::InvalidArguments),
+        };
+
+        Ok(ct_eq_biguint(&c, &proof.c) & valid)
+    }
+}
+
+/// Verifier of the proofs of a single key, e.g. a busy identity, holding the
+/// tables of the group and of the key, see `Group::new_single_key_verifier`.
+/// It holds no mutable state, so it can be shared between threads.
+#[derive(Debug, Clone)]
+pub struct SingleKeyVerifier {
+    verifier: Verifier,
+    key: PrecomputedKey,
+}
+
+impl SingleKeyVerifier {
+    /// Same as `Group::verify_proof` with the key of the verifier.
+    pub fn verify(self: &Self, proof: &Proof) -> Result<bool, Error> {
+        self.verifier.verify_with_precomputed(&self.key, proof)
+    }
+
+    pub fn public_key(self: &Self) -> (&Point, &Point) {
+        self.key.public_key()
+    }
+}
+
+/// A group that can only verify, for services that must not be able to
+/// generate keys or create proofs even by mistake: it has none of the methods
+/// of `Group` that use secrets, and the group it wraps can't be taken back.
+#[derive(Debug, Clone)]
+pub struct VerifierGroup {
+    group: Group,
+}
+
+impl VerifierGroup {
+    /// Same as `Group::new_with_params`, with the same checks and errors.
+    pub fn new_with_params(p: &[u8], q: &[u8], g: &[u8], h: &[u8]) -> Result<VerifierGroup, Error> {
+        Group::new_with_params(p, q, g, h).map(VerifierGroup::from)
+    }
+
+    /// Same as `Group::verify_proof`.
+    pub fn verify_proof(self: &Self, y1: &Point, y2: &Point, proof: &Proof) -> Result<bool, Error> {
+        self.group.verify_proof(y1, y2, proof)
+    }
+
+    /// Same as `Point::deserialize` with the group.
+    pub fn deserialize_point(self: &Self, v: Vec<u8>) -> Result<Point, Error> {
+        Point::deserialize(v, &self.group)
+    }
+
+    /// Same as `Proof::deserialize` with the group.
+    pub fn deserialize_proof(self: &Self, v: Vec<u8>) -> Result<Proof, Error> {
+        Proof::deserialize(v, &self.group)
+    }
+
+    /// Same as `Group::fingerprint`.
+    pub fn fingerprint(self: &Self) -> [u8; 32] {
+        self.group.fingerprint()
+    }
+}
+
+impl From<Group> for VerifierGroup {
+    fn from(group: Group) -> VerifierGroup {
+        VerifierGroup { group }
+    }
+}
+
+impl Group {
+    /// Creates a Verifier for the group, worth it when verifying many proofs:
+    /// the precomputation costs about as much as a single verification.
+    pub fn new_verifier(self: &Self) -> Verifier {
+        let (p, q, g, h) = get_constants(self);
+        let g_table = FixedBaseTable::new(&g, &p, &q);
+        let h_table = FixedBaseTable::new(&h, &p, &q);
+
+        Verifier {
+            p,
+            q,
+            g,
+            h,
+            g_table,
+            h_table,
+        }
+    }
+
+    /// Creates a SingleKeyVerifier of the proofs of `key`, which must be an
+    /// element of the group. It precomputes the tables of both the group and
+    /// the key, so only worth it for keys verified many times.
+    pub fn new_single_key_verifier(
+        self: &Self,
+        key: &PublicKey,
+    ) -> Result<SingleKeyVerifier, Error> {
+        let verifier = self.new_verifier();
+        let key = verifier.precompute_public_key(&key.y1, &key.y2)?;
+        Ok(SingleKeyVerifier { verifier, key })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_verifier_group() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let proof = group.create_proof(&x).unwrap();
+
+            let verifier = VerifierGroup::from(group.clone());
+            assert_eq!(verifier.fingerprint(), group.fingerprint());
+            let y1 = verifier.deserialize_point(y1.serialize()).unwrap();
+            let y2 = verifier.deserialize_point(y2.serialize()).unwrap();
+            let proof = verifier.deserialize_proof(proof.serialize(&group)).unwrap();
+            assert!(verifier.verify_proof(&y1, &y2, &proof).unwrap());
+        }
+
+        let (p, q, g, h) = Group::Scalar.params();
+        let verifier = VerifierGroup::new_with_params(&p, &q, &g, &h).unwrap();
+        assert_eq!(verifier.fingerprint(), Group::Scalar.fingerprint());
+        assert!(matches!(
+            VerifierGroup::new_with_params(&p, &q, &g, &g),
+            Err(Error::SameGenerators)
+        ));
+    }
+
+    #[test]
+    fn test_verify_with_precomputed() {
+        let custom = Group::new_with_params(&[23], &[11], &[4], &[9]).unwrap();
+        for group in [Group::Scalar, Group::EllipticCurve, custom] {
+            let verifier = group.new_verifier();
+            let (x, y1, y2) = group.generate_key().unwrap();
+            let key = verifier.precompute_public_key(&y1, &y2).unwrap();
+            assert_eq!(key.public_key(), (&y1, &y2));
+
+            let proof = group.create_proof(&x).unwrap();
+            assert!(verifier.verify_with_precomputed(&key, &proof).unwrap());
+
+            let (other, _, _) = group.generate_key().unwrap();
+            let proof = group.create_proof(&other).unwrap();
+            assert_eq!(
+                verifier.verify_with_precomputed(&key, &proof),
+                group.verify_proof(&y1, &y2, &proof)
+            );
+
+            let mut wrong = group.create_proof(&x).unwrap();
+            wrong.s += 1u32;
+            assert_eq!(
+                verifier.verify_with_precomputed(&key, &wrong),
+                group.verify_proof(&y1, &y2, &wrong)
+            );
+        }
+
+        let verifier = Group::EllipticCurve.new_verifier();
+        let (_, y1, y2) = Group::EllipticCurve.generate_key().unwrap();
+        let key = verifier.precompute_public_key(&y1, &y2).unwrap();
+        let (x, _, _) = Group::Scalar.generate_key().unwrap();
+        let proof = Group::Scalar.create_proof(&x).unwrap();
+        assert_eq!(
+            verifier.verify_with_precomputed(&key, &proof),
+            Err(Error::InvalidArguments)
+        );
+    }
+
+    #[test]
+    fn test_single_key_verifier() {
+        for group in [Group::Scalar, Group::EllipticCurve] {
+            let private_key = group.generate_private_key().unwrap();
+            let public_key = private_key.public_key(&group).unwrap();
+            let verifier = group.new_single_key_verifier(&public_key).unwrap();
+            assert_eq!(verifier.public_key(), (&public_key.y1, &public_key.y2));
+
+            let proofs: Vec<Proof> = (0..8)
+                .map(|_| group.create_proof_with_key(&private_key).unwrap())
+                .collect();
+            std::thread::scope(|scope| {
+                for proof in &proofs {
+                    let verifier = &verifier;
+                    scope.spawn(move || assert!(verifier.verify(proof).unwrap()));
+                }
+            });
+
+            let mut wrong = proofs[0].clone();
+            wrong.s += 1u32;
+            assert_eq!(
+                verifier.verify(&wrong),
+                group.verify_proof(&public_key.y1, &public_key.y2, &wrong)
+            );
+        }
+
+        let (_, y1, y2) = Group::Scalar.generate_key().unwrap();
+        let key = PublicKey { y1, y2 };
+        assert!(matches!(
+            Group::EllipticCurve.new_single_key_verifier(&key),
+            Err(Error::InvalidPoint)
+        ));
+    }
+
+    #[test]
+    fn test_verifier() {
+        let custom = Group::new_with_params(&[23], &[11], &[4], &[9]).unwrap();
+        for group in [Group::Scalar, Group::EllipticCurve, custom] {
+            let verifier = group.new_verifier();
+            let (x, y1, y2) = group.generate_key().unwrap();
+
+            let proof = group.create_proof(&x).unwrap();
+            assert!(verifier.verify(&y1, &y2, &proof).unwrap());
+
+            let (_, other_y1, other_y2) = group.generate_key().unwrap();
+            assert_eq!(
+                verifier.verify(&other_y1, &other_y2, &proof),
+                group.verify_proof(&other_y1, &other_y2, &proof)
+            );
+
+            let mut wrong = proof.clone();
+            wrong.s += 1u32;
+            assert_eq!(
+                verifier.verify(&y1, &y2, &wrong),
+                group.verify_proof(&y1, &y2, &wrong)
+            );
+        }
+
+        let verifier = Group::Scalar.new_verifier();
+        let (x, y1, y2) = Group::EllipticCurve.generate_key().unwrap();
+        assert!(matches!(
+            verifier.precompute_public_key(&y1, &y2),
+            Err(Error::InvalidPoint)
+        ));
+        let proof = Group::EllipticCurve.create_proof(&x).unwrap();
+        assert_eq!(
+            verifier.verify(&y1, &y2, &proof),
+            Err(Error::InvalidArguments)
+        );
+    }
+}
@@ -0,0 +1,80 @@
+//! Guards the number of heap allocations of a single `verify_proof`, so that
+//! a change making the verification allocate much more is caught by the
+//! tests. It runs in its own test binary as it replaces the global allocator.
+use chaum_pedersen_zkp::{Group, GroupId};
+use std::alloc::{GlobalAlloc, Layout, System};
+use std::cell::Cell;
+
+/// System allocator counting the allocations of the current thread.
+struct CountingAllocator;
+
+thread_local! {
+    static ALLOCATIONS: Cell<usize> = const { Cell::new(0) };
+}
+
+unsafe impl GlobalAlloc for CountingAllocator {
+    unsafe fn alloc(&self, layout: Layout) -> *mut u8 {
+        ALLOCATIONS.with(|n| n.set(n.get() + 1));
+        System.alloc(layout)
+    }
+
+    unsafe fn dealloc(&self, ptr: *mut u8, layout: Layout) {
+        System.dealloc(ptr, layout)
+    }
+
+    unsafe fn realloc(&self, ptr: *mut u8, layout: Layout, size: usize) -> *mut u8 {
+        ALLOCATIONS.with(|n| n.set(n.get() + 1));
+        System.realloc(ptr, layout, size)
+    }
+}
+
+#[global_allocator]
+static ALLOCATOR: CountingAllocator = CountingAllocator;
+
+/// Returns the smallest number of allocations of `f` over a few runs.
+fn allocations<F: FnMut()>(mut f: F) -> usize {
+    (0..5)
+        .map(|_| {
+            let before = ALLOCATIONS.with(Cell::get);
+            f();
+            ALLOCATIONS.with(Cell::get) - before
+        })
+        .min()
+        .unwrap()
+}
+
+/// Largest number of allocations of a verification measured per group over
+/// six runs, in debug and release builds alike. The integer groups allocate
+/// the intermediate numbers of a few exponentiations; the arithmetic of
+/// secp256k1 allocates new numbers at every step of its scalar
+/// multiplications and inversions, hence its much higher count. The counts
+/// vary by up to 20% between runs with the lengths of the random numbers and
+/// depend on the version of `num-bigint`: measure them again with the output
+/// of this test when upgrading it.
+const MEASURED_ALLOCATIONS: [(&str, usize); 3] = [
+    ("scalar", 250),
+    ("modp2048", 41_710),
+    ("secp256k1", 5_005_071),
+];
+
+/// Allocations allowed over the measured counts, in percent: above the
+/// variation between runs, so that only real regressions fail.
+const HEADROOM_PERCENT: usize = 25;
+
+#[test]
+fn test_verify_proof_allocations() {
+    let groups = [
+        Group::Scalar,
+        Group::named(GroupId::Modp2048),
+        Group::EllipticCurve,
+    ];
+    for (group, (name, measured)) in groups.iter().zip(MEASURED_ALLOCATIONS) {
+        let max = measured + measured * HEADROOM_PERCENT / 100;
+        let (x, y1, y2) = group.generate_key().unwrap();
+        let proof = group.create_proof(&x).unwrap();
+
+        let n = allocations(|| assert!(group.verify_proof(&y1, &y2, &proof).unwrap()));
+        println!("verify_proof in {}: {} allocations", name, n);
+        assert!(n <= max, "{} allocations in {}, at most {}", n, name, max);
+    }
+}